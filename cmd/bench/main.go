@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hengfeiyang/lsmdb/internal/pkg/bench"
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+)
+
+func main() {
+	var opts bench.LoadOpts
+	path := flag.String("path", "./data", "database directory")
+	flag.IntVar(&opts.Concurrency, "c", 8, "number of workers")
+	flag.IntVar(&opts.Ops, "n", 0, "total operations, 0 means run for -d")
+	flag.DurationVar(&opts.Duration, "d", 10*time.Second, "run time when -n is 0")
+	flag.IntVar(&opts.ReadWeight, "read", 80, "relative weight of reads")
+	flag.IntVar(&opts.WriteWeight, "write", 20, "relative weight of writes")
+	flag.IntVar(&opts.DeleteWeight, "delete", 0, "relative weight of deletes")
+	flag.IntVar(&opts.KeySpace, "keys", 100000, "number of distinct keys")
+	flag.IntVar(&opts.ValueSize, "size", 100, "bytes of each written value")
+	flag.Int64Var(&opts.Seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+
+	store, err := db.Open(*path, db.BlockKeyNum, db.TableBlockNum)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := bench.Benchmark(store, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("ops=%d reads=%d writes=%d deletes=%d errors=%d elapsed=%v\n", res.Ops, res.Reads, res.Writes, res.Deletes, res.Errors, res.Elapsed)
+	fmt.Printf("throughput=%.0f ops/s p50=%v p90=%v p99=%v max=%v\n", res.Throughput, res.P50, res.P90, res.P99, res.Max)
+}
@@ -1,7 +1,18 @@
 package main
 
-import "github.com/hengfeiyang/lsmdb/internal/server"
+import (
+	"log"
+
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+	"github.com/hengfeiyang/lsmdb/internal/server"
+)
 
 func main() {
-	server.New().Run(":8080")
+	var err error
+	if db.DB, err = db.Open("./data", db.BlockKeyNum, db.TableBlockNum); err != nil {
+		log.Fatal(err)
+	}
+	if err := server.New().Run(":8080"); err != nil {
+		log.Fatal(err)
+	}
 }
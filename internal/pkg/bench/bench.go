@@ -0,0 +1,166 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+)
+
+// Store is the key value interface under load, *db.MEMSSTable implements it
+type Store interface {
+	Set(key, val string) error
+	Query(key string) (string, error)
+	Delete(key string) error
+}
+
+// LoadOpts describe the load, an operation is a read, write or delete picked by the weights
+type LoadOpts struct {
+	Concurrency  int           // number of workers
+	Ops          int           // total operations, 0 means run for Duration
+	Duration     time.Duration // run time when Ops is 0
+	ReadWeight   int           // relative weight of reads
+	WriteWeight  int           // relative weight of writes
+	DeleteWeight int           // relative weight of deletes
+	KeySpace     int           // keys are picked uniformly from KeySpace keys
+	ValueSize    int           // bytes of each written value
+	Seed         int64         // seed of the random key and operation choice
+}
+
+func (o LoadOpts) validate() error {
+	if o.Concurrency < 1 {
+		return fmt.Errorf("invalid concurrency: %d", o.Concurrency)
+	}
+	if o.Ops < 0 || (o.Ops == 0 && o.Duration <= 0) {
+		return errors.New("either ops or duration must be set")
+	}
+	if o.ReadWeight < 0 || o.WriteWeight < 0 || o.DeleteWeight < 0 || o.ReadWeight+o.WriteWeight+o.DeleteWeight == 0 {
+		return errors.New("weights must not be negative and at least one must be set")
+	}
+	if o.KeySpace < 1 {
+		return fmt.Errorf("invalid key space: %d", o.KeySpace)
+	}
+	if o.ValueSize < 0 {
+		return fmt.Errorf("invalid value size: %d", o.ValueSize)
+	}
+	return nil
+}
+
+// Result is the throughput and latency of a load, a read of a missing key is not an error
+type Result struct {
+	Ops        int64         // operations done
+	Reads      int64         // reads done
+	Writes     int64         // writes done
+	Deletes    int64         // deletes done
+	Errors     int64         // operations failed
+	Elapsed    time.Duration // wall time of the load
+	Throughput float64       // operations per second
+	P50        time.Duration // latency percentiles of all operations
+	P90        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+}
+
+// worker is the counters and latencies of one goroutine, merged after the load
+type worker struct {
+	reads, writes, deletes, errors int64
+	latencies                      []time.Duration
+}
+
+// Benchmark run the load against the store and report throughput and latency percentiles
+func Benchmark(store Store, opts LoadOpts) (Result, error) {
+	if err := opts.validate(); err != nil {
+		return Result{}, err
+	}
+	value := strings.Repeat("v", opts.ValueSize)
+	remaining := int64(opts.Ops)
+	deadline := time.Now().Add(opts.Duration)
+	next := func() bool {
+		if opts.Ops > 0 {
+			return atomic.AddInt64(&remaining, -1) >= 0
+		}
+		return time.Now().Before(deadline)
+	}
+
+	workers := make([]*worker, opts.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range workers {
+		w := new(worker)
+		workers[i] = w
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			w.run(store, opts, value, rand.New(rand.NewSource(seed)), next)
+		}(opts.Seed + int64(i))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	res := Result{Elapsed: elapsed}
+	latencies := make([]time.Duration, 0)
+	for _, w := range workers {
+		res.Reads += w.reads
+		res.Writes += w.writes
+		res.Deletes += w.deletes
+		res.Errors += w.errors
+		latencies = append(latencies, w.latencies...)
+	}
+	res.Ops = res.Reads + res.Writes + res.Deletes
+	if elapsed > 0 {
+		res.Throughput = float64(res.Ops) / elapsed.Seconds()
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	res.P50 = percentile(latencies, 50)
+	res.P90 = percentile(latencies, 90)
+	res.P99 = percentile(latencies, 99)
+	res.Max = percentile(latencies, 100)
+	return res, nil
+}
+
+func (w *worker) run(store Store, opts LoadOpts, value string, r *rand.Rand, next func() bool) {
+	total := opts.ReadWeight + opts.WriteWeight + opts.DeleteWeight
+	for next() {
+		key := fmt.Sprintf("bench-%d", r.Intn(opts.KeySpace))
+		op := r.Intn(total)
+		var err error
+		begin := time.Now()
+		switch {
+		case op < opts.ReadWeight:
+			if _, err = store.Query(key); err == db.ErrKeyNotFound {
+				err = nil
+			}
+			w.reads++
+		case op < opts.ReadWeight+opts.WriteWeight:
+			err = store.Set(key, value)
+			w.writes++
+		default:
+			err = store.Delete(key)
+			w.deletes++
+		}
+		w.latencies = append(w.latencies, time.Since(begin))
+		if err != nil {
+			w.errors++
+		}
+	}
+}
+
+// percentile return the latency at p percent of sorted latencies, 0 if there is none
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+)
+
+func TestBenchmarkSmoke(t *testing.T) {
+	store, err := db.Open(t.TempDir(), 16, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	opts := LoadOpts{
+		Concurrency:  4,
+		Ops:          400,
+		ReadWeight:   2,
+		WriteWeight:  2,
+		DeleteWeight: 1,
+		KeySpace:     50,
+		ValueSize:    32,
+		Seed:         1,
+	}
+	res, err := Benchmark(store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Ops != 400 || res.Reads+res.Writes+res.Deletes != res.Ops {
+		t.Fatalf("%d ops, %d reads, %d writes, %d deletes, want 400 ops", res.Ops, res.Reads, res.Writes, res.Deletes)
+	}
+	if res.Reads == 0 || res.Writes == 0 || res.Deletes == 0 {
+		t.Fatalf("the mix was not run: %d reads, %d writes, %d deletes", res.Reads, res.Writes, res.Deletes)
+	}
+	if res.Errors != 0 {
+		t.Fatalf("%d operations failed", res.Errors)
+	}
+	if res.Elapsed <= 0 || res.Throughput <= 0 {
+		t.Fatalf("elapsed %v, throughput %v", res.Elapsed, res.Throughput)
+	}
+	if res.P50 <= 0 || res.P50 > res.P90 || res.P90 > res.P99 || res.P99 > res.Max {
+		t.Fatalf("percentiles out of order: p50 %v, p90 %v, p99 %v, max %v", res.P50, res.P90, res.P99, res.Max)
+	}
+}
+
+func TestBenchmarkDuration(t *testing.T) {
+	store, err := db.Open(t.TempDir(), 1024, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	res, err := Benchmark(store, LoadOpts{Concurrency: 2, Duration: 50 * time.Millisecond, WriteWeight: 1, KeySpace: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Ops == 0 || res.Writes != res.Ops || res.Elapsed < 50*time.Millisecond {
+		t.Fatalf("%d ops, %d writes in %v", res.Ops, res.Writes, res.Elapsed)
+	}
+}
+
+func TestLoadOptsValidate(t *testing.T) {
+	valid := LoadOpts{Concurrency: 1, Ops: 1, ReadWeight: 1, KeySpace: 1}
+	for name, mutate := range map[string]func(*LoadOpts){
+		"no concurrency":  func(o *LoadOpts) { o.Concurrency = 0 },
+		"no ops":          func(o *LoadOpts) { o.Ops = 0 },
+		"negative ops":    func(o *LoadOpts) { o.Ops = -1 },
+		"no weights":      func(o *LoadOpts) { o.ReadWeight = 0 },
+		"negative weight": func(o *LoadOpts) { o.DeleteWeight = -1 },
+		"no key space":    func(o *LoadOpts) { o.KeySpace = 0 },
+		"negative value":  func(o *LoadOpts) { o.ValueSize = -1 },
+	} {
+		opts := valid
+		mutate(&opts)
+		if _, err := Benchmark(nil, opts); err == nil {
+			t.Fatalf("%s: accepted", name)
+		}
+	}
+	if err := valid.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
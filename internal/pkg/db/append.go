@@ -0,0 +1,26 @@
+package db
+
+// Append add suffix to the end of the value of key in one write lock, a missing or deleted key is
+// taken as empty so the key is created with suffix as its value
+func (t *MEMSSTable) Append(key, suffix string) error {
+	if err := checkRootKeys(key); err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.waitWriteStall(); err != nil {
+		return err
+	}
+
+	cur := ""
+	v, err := t.getLocked(key)
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+	if err == nil && v.Command != CommandTypeDelete {
+		if cur, err = t.value(v); err != nil {
+			return err
+		}
+	}
+	return t.commandLocked(&Command{Key: key, Value: cur + suffix, Command: CommandTypeSet}, false)
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	appendTo := func(key, suffix string) {
+		t.Helper()
+		if err := db.Append(key, suffix); err != nil {
+			t.Fatalf("append %q to %s: %v", suffix, key, err)
+		}
+	}
+	// a missing key is created
+	appendTo("missing", "first")
+	expectValue(t, db, "missing", "first")
+
+	mustSet(t, db, "log", "a")
+	appendTo("log", "b")
+	// the value is read from disk too
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	appendTo("log", "c")
+	expectValue(t, db, "log", "abc")
+
+	// a deleted key is taken as empty
+	if err := db.Delete("log"); err != nil {
+		t.Fatal(err)
+	}
+	appendTo("log", "new")
+	expectValue(t, db, "log", "new")
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectValue(t, db, "log", "new")
+	expectValue(t, db, "missing", "first")
+}
+
+func TestConcurrentAppend(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 4, 2)
+	defer db.Close()
+	const writers, appends = 4, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < appends; i++ {
+				if err := db.Append("k", "x"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// no append is lost to another writer
+	expectValue(t, db, "k", strings.Repeat("x", writers*appends))
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+type BackgroundFlushOptions struct {
+	ImmutableNum int           // flush when the number of immutable tables exceeds N, 0 means disabled
+	Interval     time.Duration // flush all memory data every interval, 0 means disabled
+}
+
+type backgroundFlusher struct {
+	opts   BackgroundFlushOptions
+	signal chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// notify wake up the flusher after a table switch or a write stall, never block the writer
+func (f *backgroundFlusher) notify() {
+	if f == nil {
+		return
+	}
+	select {
+	case f.signal <- struct{}{}:
+	default:
+	}
+}
+
+// StartBackgroundFlush start a goroutine flush memory data by immutable table number or time interval
+func (t *MEMSSTable) StartBackgroundFlush(opts BackgroundFlushOptions) error {
+	if opts.ImmutableNum <= 0 && opts.Interval <= 0 {
+		return errors.New("background flush needs ImmutableNum or Interval")
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.flusher != nil {
+		return errors.New("background flush already started")
+	}
+	t.flusher = &backgroundFlusher{
+		opts:   opts,
+		signal: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.backgroundFlush(t.flusher)
+	return nil
+}
+
+// StopBackgroundFlush stop the background flush goroutine and wait it exit
+func (t *MEMSSTable) StopBackgroundFlush() {
+	t.lock.Lock()
+	f := t.flusher
+	t.flusher = nil
+	t.lock.Unlock()
+	if f == nil {
+		return
+	}
+	close(f.stop)
+	<-f.done
+}
+
+func (t *MEMSSTable) backgroundFlush(f *backgroundFlusher) {
+	defer close(f.done)
+
+	var tick <-chan time.Time
+	if f.opts.Interval > 0 {
+		ticker := time.NewTicker(f.opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-f.signal:
+			// a stalled writer waits for a flush whatever the threshold
+			t.lock.RLock()
+			n := len(t.immutable)
+			stalled := t.maxImmutable > 0 && n >= t.maxImmutable
+			t.lock.RUnlock()
+			if !stalled && (f.opts.ImmutableNum <= 0 || n <= f.opts.ImmutableNum) {
+				continue
+			}
+			for {
+				more, err := t.FlushOne()
+				if err != nil {
+					log.Printf("background flush error: %v", err)
+					break
+				}
+				// the active table is left to fill up
+				t.lock.RLock()
+				n = len(t.immutable)
+				t.lock.RUnlock()
+				if !more || n == 0 {
+					break
+				}
+			}
+		case <-tick:
+			t.lock.RLock()
+			empty := t.activeTable.Len() == 0 && len(t.immutable) == 0
+			t.lock.RUnlock()
+			if empty {
+				continue
+			}
+			if err := t.Flush(); err != nil {
+				log.Printf("background flush error: %v", err)
+			}
+		}
+	}
+}
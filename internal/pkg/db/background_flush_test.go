@@ -0,0 +1,54 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackgroundFlushByImmutableNum(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	if err := db.StartBackgroundFlush(BackgroundFlushOptions{ImmutableNum: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// 3 keys leave one immutable table, the 5th key the second one
+	for i := 0; i < 5; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), "v")
+	}
+	waitFor(t, "a background flush", func() bool {
+		return len(tableFiles(t, dir)) > 0
+	})
+	for i := 0; i < 5; i++ {
+		expectValue(t, db, fmt.Sprintf("k%d", i), "v")
+	}
+}
+
+func TestBackgroundFlushByInterval(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 100, 1)
+	defer db.Close()
+	if err := db.StartBackgroundFlush(BackgroundFlushOptions{Interval: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "k", "v")
+	waitFor(t, "a background flush", func() bool {
+		return len(tableFiles(t, dir)) > 0
+	})
+	expectValue(t, db, "k", "v")
+}
+
+func TestStartBackgroundFlushOptions(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	if err := db.StartBackgroundFlush(BackgroundFlushOptions{}); err == nil {
+		t.Fatal("background flush without a trigger is started")
+	}
+	if err := db.StartBackgroundFlush(BackgroundFlushOptions{ImmutableNum: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.StartBackgroundFlush(BackgroundFlushOptions{ImmutableNum: 1}); err == nil {
+		t.Fatal("background flush is started twice")
+	}
+}
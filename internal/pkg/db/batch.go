@@ -0,0 +1,108 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Batch is a group of commands written atomically, all of them or none are applied
+type Batch struct {
+	cmds []*Command
+}
+
+func NewBatch() *Batch {
+	return new(Batch)
+}
+
+func (b *Batch) Set(key, val string) {
+	b.cmds = append(b.cmds, &Command{Key: key, Value: val, Command: CommandTypeSet})
+}
+
+func (b *Batch) Delete(key string) {
+	b.cmds = append(b.cmds, &Command{Key: key, Command: CommandTypeDelete})
+}
+
+func (b *Batch) Len() int {
+	return len(b.cmds)
+}
+
+// Write apply the batch atomically, the batch is one wal record so a torn write drops all of it
+func (t *MEMSSTable) Write(b *Batch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	for _, c := range b.cmds {
+		if err := checkRootKeys(c.Key); err != nil {
+			return err
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.waitWriteStall(); err != nil {
+		return err
+	}
+	return t.writeLocked(b)
+}
+
+// writeLocked is Write for the caller holding the lock after the write stall
+func (t *MEMSSTable) writeLocked(b *Batch) error {
+	if err := t.checkKeySize(b.cmds); err != nil {
+		return err
+	}
+	if err := t.checkValues(b.cmds); err != nil {
+		return err
+	}
+	delta, err := t.checkQuota(b.cmds)
+	if err != nil {
+		return err
+	}
+	cmds := make([]*Command, len(b.cmds))
+	for i := range b.cmds {
+		c, err := t.separateValue(b.cmds[i])
+		if err != nil {
+			return err
+		}
+		cmds[i] = t.checksumValue(c)
+	}
+	if err := t.appendWAL(wrapBatch(cmds)); err != nil {
+		return err
+	}
+	for i := range cmds {
+		t.apply(cmds[i])
+		t.stats.addUser(b.cmds[i])
+	}
+	t.quota.keys += delta
+	return nil
+}
+
+// wrapBatch encode commands into one command for wal
+func wrapBatch(cmds []*Command) *Command {
+	buf := bytes.NewBuffer(nil)
+	for _, c := range cmds {
+		n, body := c.Bytes()
+		binary.Write(buf, binary.LittleEndian, uint32(n))
+		buf.Write(body)
+	}
+	return &Command{Value: buf.String(), Command: CommandTypeBatch}
+}
+
+// unwrapBatch return the commands of a batch, or the command itself
+func unwrapBatch(c *Command) []*Command {
+	if c.Command != CommandTypeBatch {
+		return []*Command{c}
+	}
+	cmds := make([]*Command, 0)
+	data := []byte(c.Value)
+	for len(data) >= 4 {
+		n := binary.LittleEndian.Uint32(data)
+		if uint64(len(data)-4) < uint64(n) {
+			break
+		}
+		cmd := new(Command)
+		cmd.Restore(data[4 : 4+n])
+		cmds = append(cmds, cmd)
+		data = data[4+n:]
+	}
+	return cmds
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// blockCacheOverhead is the bytes counted for each command of a cached block besides its key and value
+const blockCacheOverhead = 48
+
+// blockCache is a LRU cache of restored disk blocks bounded by their bytes, a nil cache caches nothing,
+// blocks of a pinned table count against the capacity but are never evicted
+type blockCache struct {
+	lock     sync.Mutex
+	capacity uint64
+	used     uint64
+	ll       *list.List // blocks which can be evicted, the most recent in front
+	items    map[blockCacheKey]*blockCacheEntry
+	pinned   map[string]bool // names of the pinned tables
+}
+
+type blockCacheKey struct {
+	table string
+	block uint32
+}
+
+type blockCacheEntry struct {
+	key   blockCacheKey
+	block *SSTable
+	size  uint64
+	elem  *list.Element // nil while the table is pinned
+}
+
+func newBlockCache(capacity uint64) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[blockCacheKey]*blockCacheEntry),
+		pinned:   make(map[string]bool),
+	}
+}
+
+// blockSize return the bytes a block is counted for
+func blockSize(block *SSTable) uint64 {
+	size := uint64(0)
+	for _, c := range block.data {
+		size += uint64(len(c.Key)+len(c.Value)) + blockCacheOverhead
+	}
+	return size
+}
+
+func (c *blockCache) get(table string, block uint32) *SSTable {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.items[blockCacheKey{table, block}]
+	if !ok {
+		return nil
+	}
+	if e.elem != nil {
+		c.ll.MoveToFront(e.elem)
+	}
+	return e.block
+}
+
+func (c *blockCache) add(table string, block uint32, b *SSTable) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := blockCacheKey{table, block}
+	if _, ok := c.items[key]; ok {
+		return
+	}
+	e := &blockCacheEntry{key: key, block: b, size: blockSize(b)}
+	if !c.pinned[table] {
+		e.elem = c.ll.PushFront(e)
+	}
+	c.items[key] = e
+	c.used += e.size
+	c.evict()
+}
+
+// evict drop the least recently used blocks until the cache fits, pinned blocks stay even if they
+// alone exceed the capacity, caller must hold the lock
+func (c *blockCache) evict() {
+	for c.used > c.capacity && c.ll.Len() > 0 {
+		c.removeEntry(c.ll.Back().Value.(*blockCacheEntry))
+	}
+}
+
+func (c *blockCache) removeEntry(e *blockCacheEntry) {
+	if e.elem != nil {
+		c.ll.Remove(e.elem)
+	}
+	delete(c.items, e.key)
+	c.used -= e.size
+}
+
+// pin make the cached and later added blocks of the table non-evictable
+func (c *blockCache) pin(table string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pinned[table] = true
+	for _, e := range c.items {
+		if e.key.table == table && e.elem != nil {
+			c.ll.Remove(e.elem)
+			e.elem = nil
+		}
+	}
+}
+
+// unpin make the blocks of the table evictable again, the cache is trimmed to its capacity
+func (c *blockCache) unpin(table string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pinned, table)
+	for _, e := range c.items {
+		if e.key.table == table && e.elem == nil {
+			e.elem = c.ll.PushFront(e)
+		}
+	}
+	c.evict()
+}
+
+// removeTable drop the blocks and the pin of a removed table
+func (c *blockCache) removeTable(table string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pinned, table)
+	for _, e := range c.items {
+		if e.key.table == table {
+			c.removeEntry(e)
+		}
+	}
+}
+
+// EnableBlockCache cache restored disk blocks read by query up to capacity bytes of keys and values,
+// the least recently used blocks are evicted first, 0 disables the cache and drops every pin
+func (t *MEMSSTable) EnableBlockCache(capacity uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if capacity == 0 {
+		t.blockCache = nil
+		return
+	}
+	t.blockCache = newBlockCache(capacity)
+}
+
+// PinTable load every block of the disk table of id into the block cache and keep them until UnpinTable,
+// the pinned bytes count against the capacity so other blocks are evicted first, a pin is dropped when
+// compaction removes the table
+func (t *MEMSSTable) PinTable(id uint64) error {
+	t.lock.Lock()
+	cache := t.blockCache
+	if cache == nil {
+		t.lock.Unlock()
+		return errors.New("PinTable: block cache is not enabled")
+	}
+	var table *tableIndex
+	for {
+		table = nil
+		for _, ti := range groupSparseIndex(t.sparseIndex) {
+			if tid, ok := tableID(ti.name); ok && tid == id {
+				table = ti
+			}
+		}
+		if table == nil {
+			t.lock.Unlock()
+			return fmt.Errorf("PinTable: table %d not found", id)
+		}
+		if !t.tablesBusy([]*tableIndex{table}) {
+			break
+		}
+		t.compactCond.Wait()
+	}
+	// reserved like a compaction input, so the table is not removed before it is pinned
+	t.reserveTables([]*tableIndex{table})
+	t.lock.Unlock()
+	defer func() {
+		t.lock.Lock()
+		t.releaseTables([]*tableIndex{table})
+		t.lock.Unlock()
+	}()
+
+	cache.pin(table.name)
+	blocks, err := table.loadBlocks()
+	if err != nil {
+		cache.unpin(table.name)
+		return err
+	}
+	for i, index := range table.indexes {
+		cache.add(table.name, index.BlockIndex, blocks[i])
+	}
+	return nil
+}
+
+// UnpinTable make the cached blocks of the disk table of id evictable again
+func (t *MEMSSTable) UnpinTable(id uint64) {
+	t.lock.RLock()
+	cache := t.blockCache
+	var name string
+	for _, index := range t.sparseIndex {
+		if tid, ok := tableID(index.TableName); ok && tid == id {
+			name = index.TableName
+		}
+	}
+	t.lock.RUnlock()
+	if cache != nil && name != "" {
+		cache.unpin(name)
+	}
+}
+
+// uncacheTable drop the cached blocks of a removed table
+func (t *MEMSSTable) uncacheTable(name string) {
+	t.lock.RLock()
+	cache := t.blockCache
+	t.lock.RUnlock()
+	cache.removeTable(name)
+}
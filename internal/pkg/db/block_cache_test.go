@@ -0,0 +1,90 @@
+package db
+
+import (
+	"testing"
+)
+
+// cachedBlocks return the number of cached blocks of each table and the cached bytes
+func cachedBlocks(db *MEMSSTable) (map[string]int, uint64) {
+	c := db.blockCache
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	blocks := make(map[string]int)
+	for key := range c.items {
+		blocks[key.table]++
+	}
+	return blocks, c.used
+}
+
+func TestPinTableUnderCachePressure(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 2)
+	defer db.Close()
+	if err := db.PinTable(1); err == nil {
+		t.Fatal("pinned a table without a block cache")
+	}
+	groups := [][]string{{"a1", "a2", "a3", "a4"}, {"m1", "m2", "m3", "m4"}, {"x1", "x2", "x3", "x4"}}
+	files := flushDisjoint(t, db, dir, groups...)
+	// a block of two keys and values is 104 bytes, the cache holds 3 of the 6 blocks
+	db.EnableBlockCache(312)
+	infos, err := db.ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PinTable(12345); err == nil {
+		t.Fatal("pinned a missing table")
+	}
+	if err := db.PinTable(infos[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if blocks, _ := cachedBlocks(db); blocks[files[0]] != 2 {
+		t.Fatalf("%d blocks of the pinned table cached, want 2", blocks[files[0]])
+	}
+
+	// the blocks of the other tables evict each other, the pinned ones stay
+	for round := 0; round < 2; round++ {
+		for _, group := range groups[1:] {
+			for _, key := range group {
+				expectValue(t, db, key, key)
+			}
+		}
+	}
+	blocks, used := cachedBlocks(db)
+	if blocks[files[0]] != 2 || blocks[files[1]]+blocks[files[2]] != 1 || used > 312 {
+		t.Fatalf("cached blocks %v of %d bytes, want the 2 pinned blocks and one other", blocks, used)
+	}
+	m := &fakeMetrics{counts: make(map[string]int)}
+	db.SetMetrics(m)
+	for _, key := range groups[0] {
+		expectValue(t, db, key, key)
+	}
+	if n := m.take()[MetricBlockRead]; n != 0 {
+		t.Fatalf("%d block reads of the pinned table, want them served from the cache", n)
+	}
+	db.SetMetrics(nil)
+
+	// unpinned, they are evicted like any other block
+	db.UnpinTable(infos[0].ID)
+	for _, group := range groups[1:] {
+		for _, key := range group {
+			expectValue(t, db, key, key)
+		}
+	}
+	if blocks, used := cachedBlocks(db); blocks[files[0]] != 0 || used > 312 {
+		t.Fatalf("cached blocks %v of %d bytes after unpin, want none of the unpinned table", blocks, used)
+	}
+
+	// a compaction removing a pinned table drops its blocks and the pin
+	if err := db.PinTable(infos[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	db.blockCache.lock.Lock()
+	pinned := len(db.blockCache.pinned)
+	db.blockCache.lock.Unlock()
+	if blocks, _ := cachedBlocks(db); pinned != 0 || blocks[files[1]] != 0 {
+		t.Fatalf("%d pins, %d blocks of a removed table left", pinned, blocks[files[1]])
+	}
+}
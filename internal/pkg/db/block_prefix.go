@@ -0,0 +1,215 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// blockPrefixFlag mark a block whose keys are stored with prefix compression in the block length
+const blockPrefixFlag uint32 = 1 << 30
+
+// blockFlags is the mask of all flags in the block length
+const blockFlags = blockRawFlag | blockPrefixFlag
+
+var errPrefixBlock = errors.New("corrupted prefix compressed block")
+
+// prefixBytes encode the sorted commands with prefix compressed keys, the block header is the restart
+// interval, a command stores the length of the prefix shared with the previous key and the rest of its
+// key, every restart commands the full key is stored and its offset after the header is recorded at
+// the end of the block, so a lookup can binary search them
+//
+// | restart interval |
+// | shared | unshared | valueLength | commandType | key suffix | value | crc32 if flagged | seq if flagged |
+// | restart offset | ... | restart offset | restart count |
+func (t *SSTable) prefixBytes(restart int) []byte {
+	varint := make([]byte, binary.MaxVarintLen64)
+	header := varint[:binary.PutUvarint(varint, uint64(restart))]
+	buf := bytes.NewBuffer(append([]byte{}, header...))
+	restarts := make([]uint32, 0, len(t.data)/restart+1)
+	var prev string
+	for i, c := range t.data {
+		shared := 0
+		if i%restart == 0 {
+			restarts = append(restarts, uint32(buf.Len()-len(header)))
+		} else {
+			for shared < len(prev) && shared < len(c.Key) && prev[shared] == c.Key[shared] {
+				shared++
+			}
+		}
+		for _, v := range []int{shared, len(c.Key) - shared, len(c.Value)} {
+			buf.Write(varint[:binary.PutUvarint(varint, uint64(v))])
+		}
+		typ := c.Command
+		if c.hasChecksum {
+			typ |= commandChecksumFlag
+		}
+		if c.seq != 0 {
+			typ |= commandSeqFlag
+		}
+		buf.WriteByte(byte(typ))
+		buf.WriteString(c.Key[shared:])
+		buf.WriteString(c.Value)
+		if c.hasChecksum {
+			binary.Write(buf, binary.LittleEndian, c.checksum)
+		}
+		if c.seq != 0 {
+			binary.Write(buf, binary.LittleEndian, c.seq)
+		}
+		prev = c.Key
+	}
+	for _, offset := range restarts {
+		binary.Write(buf, binary.LittleEndian, offset)
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(len(restarts)))
+	return buf.Bytes()
+}
+
+// prefixBlock is a decoder of a prefix compressed block
+type prefixBlock struct {
+	interval int      // a full key every interval commands
+	data     []byte   // commands without the header and the restart offsets
+	restarts []uint32 // offset of each command with a full key
+}
+
+func newPrefixBlock(data []byte) (*prefixBlock, error) {
+	interval, h := binary.Uvarint(data)
+	if h <= 0 || interval == 0 || len(data) < h+4 {
+		return nil, errPrefixBlock
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	end := len(data) - 4 - 4*n
+	if n < 0 || end < h {
+		return nil, errPrefixBlock
+	}
+	b := &prefixBlock{interval: int(interval), data: data[h:end], restarts: make([]uint32, n)}
+	end -= h
+	for i := range b.restarts {
+		b.restarts[i] = binary.LittleEndian.Uint32(data[h+end+4*i:])
+		if int(b.restarts[i]) > end {
+			return nil, errPrefixBlock
+		}
+	}
+	return b, nil
+}
+
+// next decode the command at pos with the previous key, return the command and the offset after it
+func (b *prefixBlock) next(pos int, prev string) (*Command, int, error) {
+	var lengths [3]uint64
+	for i := range lengths {
+		v, n := binary.Uvarint(b.data[pos:])
+		if n <= 0 {
+			return nil, 0, errPrefixBlock
+		}
+		lengths[i] = v
+		pos += n
+	}
+	shared, unshared, valueLength := lengths[0], lengths[1], lengths[2]
+	if shared > uint64(len(prev)) || pos >= len(b.data) || unshared+valueLength > uint64(len(b.data)-pos-1) {
+		return nil, 0, errPrefixBlock
+	}
+	c := &Command{Command: CommandType(b.data[pos])}
+	pos++
+	c.hasChecksum = c.Command&commandChecksumFlag != 0
+	hasSeq := c.Command&commandSeqFlag != 0
+	c.Command &^= commandFlags
+	c.Key = prev[:shared] + string(b.data[pos:pos+int(unshared)])
+	pos += int(unshared)
+	c.Value = string(b.data[pos : pos+int(valueLength)])
+	pos += int(valueLength)
+	if c.hasChecksum {
+		if pos+4 > len(b.data) {
+			return nil, 0, errPrefixBlock
+		}
+		c.checksum = binary.LittleEndian.Uint32(b.data[pos:])
+		pos += 4
+	}
+	if hasSeq {
+		if pos+8 > len(b.data) {
+			return nil, 0, errPrefixBlock
+		}
+		c.seq = binary.LittleEndian.Uint64(b.data[pos:])
+		pos += 8
+	}
+	return c, pos, nil
+}
+
+// all decode every command of the block, the restart offsets must match the interval
+func (b *prefixBlock) all() (CommandData, error) {
+	data := make(CommandData, 0)
+	var prev string
+	for pos := 0; pos < len(b.data); {
+		if len(data)%b.interval == 0 {
+			if r := len(data) / b.interval; r >= len(b.restarts) || int(b.restarts[r]) != pos {
+				return nil, errPrefixBlock
+			}
+		}
+		c, next, err := b.next(pos, prev)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, c)
+		prev, pos = c.Key, next
+	}
+	if (len(data)+b.interval-1)/b.interval != len(b.restarts) {
+		return nil, errPrefixBlock
+	}
+	return data, nil
+}
+
+// query binary search the restart keys and scan from the last restart not after key, return the
+// last command of key, nil if the block does not contain it
+func (b *prefixBlock) query(key string) (*Command, error) {
+	var searchErr error
+	i := sort.Search(len(b.restarts), func(i int) bool {
+		c, _, err := b.next(int(b.restarts[i]), "")
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return c.Key > key
+	}) - 1
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	if i < 0 {
+		return nil, nil
+	}
+	var found *Command
+	var prev string
+	for pos := int(b.restarts[i]); pos < len(b.data); {
+		c, next, err := b.next(pos, prev)
+		if err != nil {
+			return nil, err
+		}
+		if c.Key > key {
+			break
+		}
+		if c.Key == key {
+			found = c
+		}
+		prev, pos = c.Key, next
+	}
+	return found, nil
+}
+
+// restoreBlock restore the block data from its encoding, prefix is true for a prefix compressed block
+func restoreBlock(data []byte, prefix bool) (*SSTable, error) {
+	block := NewSSTable()
+	if !prefix {
+		if err := block.Restore(data); err != nil {
+			return nil, err
+		}
+		return block, nil
+	}
+	b, err := newPrefixBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	if block.data, err = b.all(); err != nil {
+		return nil, err
+	}
+	block.sorted = true
+	return block, nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// prefixKeys return n sorted keys sharing a long prefix, with their values
+func prefixKeys(n int) map[string]string {
+	prefix := strings.Repeat("tenant/0042/user/", 4)
+	values := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		values[fmt.Sprintf("%s%05d", prefix, i)] = fmt.Sprintf("v%d", i)
+	}
+	return values
+}
+
+// sortedBlock return a sorted block of the keys and values, each with a sequence number
+func sortedBlock(values map[string]string) *SSTable {
+	block := NewSSTable()
+	var seq uint64
+	for key, val := range values {
+		seq++
+		block.Append(&Command{Key: key, Value: val, seq: seq})
+	}
+	block.Sort()
+	return block
+}
+
+func TestPrefixKeys(t *testing.T) {
+	values := prefixKeys(100)
+	block := sortedBlock(values)
+	full, _ := block.Bytes()
+	data := block.prefixBytes(defaultKeyRestartInterval)
+	if len(data) >= full/2 {
+		t.Fatalf("prefix compressed block is %d bytes, full keys take %d", len(data), full)
+	}
+	restored, err := restoreBlock(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != block.Len() {
+		t.Fatalf("restored %d commands, want %d", restored.Len(), block.Len())
+	}
+	for i, c := range restored.data {
+		want := block.data[i]
+		if c.Key != want.Key || c.Value != want.Value || c.seq != want.seq {
+			t.Fatalf("command %d: %+v, want %+v", i, c, want)
+		}
+	}
+
+	// the tables are smaller and every key is found on disk, lz4 is still applied to the blocks
+	prefixed, prefixedSize := flushWithCodec(t, CodecConfig{PrefixKeys: true}, values)
+	defer prefixed.Close()
+	plain, plainSize := flushWithCodec(t, CodecConfig{}, values)
+	defer plain.Close()
+	if prefixedSize >= plainSize {
+		t.Fatalf("prefix compressed tables are %d bytes, plain tables are %d", prefixedSize, plainSize)
+	}
+	for key, val := range values {
+		expectValue(t, prefixed, key, val)
+	}
+	expectNotFound(t, prefixed, strings.Repeat("tenant/0042/user/", 4))
+	expectNotFound(t, prefixed, strings.Repeat("tenant/0042/user/", 4)+"00050x")
+
+	// the flag is in each block, a store opened without PrefixKeys reads them
+	dir := prefixed.rootPath
+	if err := prefixed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	prefixed = openTestDB(t, dir, 100, 10)
+	for key, val := range values {
+		expectValue(t, prefixed, key, val)
+	}
+}
+
+func TestCorruptedPrefixBlock(t *testing.T) {
+	data := sortedBlock(prefixKeys(20)).prefixBytes(4)
+	for _, bad := range [][]byte{
+		nil,
+		{0},
+		data[:len(data)-1],
+		data[:len(data)/2],
+	} {
+		if _, err := restoreBlock(bad, true); err == nil {
+			t.Fatalf("restored a corrupted block of %d bytes", len(bad))
+		}
+	}
+}
+
+func TestKeyRestartInterval(t *testing.T) {
+	values := prefixKeys(100)
+	block := sortedBlock(values)
+	prevSize := 0
+	for _, restart := range []int{1, 2, 5, 16, 100} {
+		data := block.prefixBytes(restart)
+		b, err := newPrefixBlock(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the interval is read from the block header
+		if b.interval != restart || len(b.restarts) != (len(values)+restart-1)/restart {
+			t.Fatalf("interval %d: header %d, %d restarts", restart, b.interval, len(b.restarts))
+		}
+		if prevSize != 0 && len(data) >= prevSize {
+			t.Fatalf("interval %d: block is %d bytes, not smaller than %d of a shorter interval", restart, len(data), prevSize)
+		}
+		prevSize = len(data)
+		for key, val := range values {
+			c, err := b.query(key)
+			if err != nil || c == nil || c.Value != val {
+				t.Fatalf("interval %d: query %s: %+v, %v", restart, key, c, err)
+			}
+		}
+		for _, key := range []string{"", "a", strings.Repeat("tenant/0042/user/", 4) + "000005", "z"} {
+			if c, err := b.query(key); err != nil || c != nil {
+				t.Fatalf("interval %d: query of missing %q: %+v, %v", restart, key, c, err)
+			}
+		}
+	}
+
+	// tables flushed with each interval of the codec, 0 means the default, are read back
+	for _, restart := range []int{0, 1, 7} {
+		db, _ := flushWithCodec(t, CodecConfig{PrefixKeys: true, KeyRestartInterval: restart}, values)
+		for key, val := range values {
+			expectValue(t, db, key, val)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,107 @@
+package db
+
+import "hash/fnv"
+
+const bloomBitsPerKey = 10
+const bloomHashNum = 7
+
+// Hasher hash keys for the bloom filter, the two halves of the result are used for double hashing
+type Hasher interface {
+	Hash(key string) uint64
+}
+
+// fnvHasher is the default hasher, 64-bit FNV-1a
+type fnvHasher struct{}
+
+func (fnvHasher) Hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// bloomFilter answer whether a key may exist, it never has false negative
+type bloomFilter struct {
+	bits   []uint64
+	k      uint32
+	hasher Hasher
+}
+
+func newBloomFilter(keyNum int, hasher Hasher) *bloomFilter {
+	if keyNum < 1 {
+		keyNum = 1
+	}
+	if hasher == nil {
+		hasher = fnvHasher{}
+	}
+	n := (keyNum*bloomBitsPerKey + 63) / 64
+	return &bloomFilter{bits: make([]uint64, n), k: bloomHashNum, hasher: hasher}
+}
+
+func (f *bloomFilter) hash(key string) (uint32, uint32) {
+	sum := f.hasher.Hash(key)
+	return uint32(sum), uint32(sum >> 32)
+}
+
+func (f *bloomFilter) Add(key string) {
+	h1, h2 := f.hash(key)
+	m := uint32(len(f.bits) * 64)
+	for i := uint32(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % m
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (f *bloomFilter) MayContain(key string) bool {
+	h1, h2 := f.hash(key)
+	m := uint32(len(f.bits) * 64)
+	for i := uint32(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) Reset() {
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+}
+
+// EnableMemoryFilter keep a bloom filter of the keys in memory tables, so a query for a key
+// not in memory skips scanning the active and immutable tables, keyNum is the expected key number
+func (t *MEMSSTable) EnableMemoryFilter(keyNum int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.memFilter = newBloomFilter(keyNum, t.bloomHasher)
+	t.rebuildMemoryFilter()
+}
+
+// SetBloomHasher change the hash function of the bloom filter, nil means the default FNV-1a,
+// an enabled memory filter is rebuilt with the new hasher
+func (t *MEMSSTable) SetBloomHasher(h Hasher) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.bloomHasher = h
+	if t.memFilter != nil {
+		t.memFilter = newBloomFilter(len(t.memFilter.bits)*64/bloomBitsPerKey, h)
+		t.rebuildMemoryFilter()
+	}
+}
+
+// rebuildMemoryFilter add keys of all memory tables to the filter, caller must hold the lock
+func (t *MEMSSTable) rebuildMemoryFilter() {
+	if t.memFilter == nil {
+		return
+	}
+	t.memFilter.Reset()
+	for i := range t.activeTable.data {
+		t.memFilter.Add(t.activeTable.data[i].Key)
+	}
+	for _, table := range t.immutable {
+		for i := range table.data {
+			t.memFilter.Add(table.data[i].Key)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	f := newBloomFilter(100, nil)
+	for i := 0; i < 100; i++ {
+		f.Add(fmt.Sprintf("key%d", i))
+	}
+	for i := 0; i < 100; i++ {
+		if key := fmt.Sprintf("key%d", i); !f.MayContain(key) {
+			t.Fatalf("false negative for %s", key)
+		}
+	}
+	f.Reset()
+	if f.MayContain("key0") {
+		t.Fatal("reset filter still holds key0")
+	}
+}
+
+func TestMemoryFilterSkipsImmutables(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	db.SetMaxImmutableTables(4, false)
+	mustSet(t, db, "old", "disk")
+	mustSet(t, db, "gone", "disk")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.EnableMemoryFilter(64)
+	mustSet(t, db, "a", "1")
+	mustSet(t, db, "b", "2")
+	if err := db.Delete("gone"); err != nil {
+		t.Fatal(err)
+	}
+	db.RotateMemtable()
+	mustSet(t, db, "c", "3")
+
+	// a command planted behind the filter's back is only found when the immutables are scanned
+	db.lock.Lock()
+	if len(db.immutable) == 0 {
+		db.lock.Unlock()
+		t.Fatal("no immutable table")
+	}
+	db.immutable[0].Append(&Command{Key: "ghost", Value: "x", Command: CommandTypeSet})
+	db.lock.Unlock()
+	expectNotFound(t, db, "ghost")
+
+	// keys set or deleted in memory are never excluded
+	expectValue(t, db, "a", "1")
+	expectValue(t, db, "b", "2")
+	expectValue(t, db, "c", "3")
+	expectNotFound(t, db, "gone")
+	expectValue(t, db, "old", "disk")
+}
+
+// countingHasher is FNV-1a counting its calls
+type countingHasher struct {
+	n int
+}
+
+func (h *countingHasher) Hash(key string) uint64 {
+	h.n++
+	return fnvHasher{}.Hash(key)
+}
+
+func TestBloomHasher(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	mustSet(t, db, "a1", "a")
+	mustSet(t, db, "b1", "b")
+	db.EnableMemoryFilter(64)
+	h := &countingHasher{}
+	db.SetBloomHasher(h)
+	// the filter is rebuilt with the new hasher
+	if h.n == 0 {
+		t.Fatal("the memory filter was not rebuilt with the hasher")
+	}
+	expectValue(t, db, "a1", "a")
+	expectValue(t, db, "b1", "b")
+	expectNotFound(t, db, "c1")
+
+	// tables flushed with the hasher are filtered by it
+	if err := db.SetPrefixExtractor(func(key string) string { return key[:1] }); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	calls := h.n
+	expectEntries(t, db.PrefixScan("a"), []string{"a1=a"})
+	expectEntries(t, db.PrefixScan("c"), []string{})
+	if h.n == calls {
+		t.Fatal("the prefix filters do not use the hasher")
+	}
+	expectValue(t, db, "a1", "a")
+
+	db.SetBloomHasher(nil)
+	expectEntries(t, db.PrefixScan("b"), []string{"b1=b"})
+	expectNotFound(t, db, "c1")
+}
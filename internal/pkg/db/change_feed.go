@@ -0,0 +1,77 @@
+package db
+
+import (
+	"log"
+	"sync"
+)
+
+// Change is a committed set or delete with its sequence number
+type Change struct {
+	Key   string
+	Value string // empty for a delete
+	Type  CommandType
+	Seq   uint64
+}
+
+// Subscribe return a channel of every set and delete applied after it, in sequence order, a change is
+// delivered after its wal write is done by the sync policy, a subscriber more than walStreamBuffer
+// changes behind is dropped and its channel closed, writers never wait for it, cancel unsubscribes
+// and closes the channel
+func (t *MEMSSTable) Subscribe() (<-chan Change, func()) {
+	t.lock.Lock()
+	id, ch := t.subscribe()
+	t.lock.Unlock()
+
+	out := make(chan Change)
+	done := make(chan struct{})
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			t.unsubscribe(id)
+		})
+	}
+	go func() {
+		defer close(out)
+		for {
+			var rec walRecord
+			var ok bool
+			select {
+			case <-done:
+				return
+			case rec, ok = <-ch:
+				if !ok {
+					return
+				}
+			}
+			c, err := t.change(&rec)
+			if err != nil {
+				log.Printf("change feed: %v", err)
+				cancel()
+				return
+			}
+			select {
+			case <-done:
+				return
+			case out <- c:
+			}
+		}
+	}()
+	return out, cancel
+}
+
+// change convert a record to a change, a value in the value log is read
+func (t *MEMSSTable) change(rec *walRecord) (Change, error) {
+	c := Change{Key: rec.Command.Key, Type: rec.Command.Command, Seq: rec.Seq}
+	switch rec.Command.Command {
+	case CommandTypeValuePointer:
+		val, err := t.value(rec.Command)
+		if err != nil {
+			return c, err
+		}
+		c.Value, c.Type = val, CommandTypeSet
+	case CommandTypeSet:
+		c.Value = rec.Command.Value
+	}
+	return c, nil
+}
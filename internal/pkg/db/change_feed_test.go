@@ -0,0 +1,108 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// nextChange receive a change or fail after a few seconds
+func nextChange(t *testing.T, ch <-chan Change) (Change, bool) {
+	t.Helper()
+	select {
+	case c, ok := <-ch:
+		return c, ok
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change delivered")
+		return Change{}, false
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	mustSet(t, db, "before", "v")
+	ch, cancel := db.Subscribe()
+	mustSet(t, db, "a", "1")
+	mustSet(t, db, "b", "2")
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBatch()
+	b.Set("c", "3")
+	b.Delete("b")
+	if err := db.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	// a failed write is not delivered
+	f := injectWALFault(db)
+	f.writeErr = errInjected
+	if err := db.Set("lost", "v"); err == nil {
+		t.Fatal("set with a failing wal write succeeded")
+	}
+	f.writeErr = nil
+	mustSet(t, db, "d", "4")
+
+	for _, want := range []Change{
+		{Key: "a", Value: "1", Type: CommandTypeSet, Seq: 2},
+		{Key: "b", Value: "2", Type: CommandTypeSet, Seq: 3},
+		{Key: "a", Type: CommandTypeDelete, Seq: 4},
+		{Key: "c", Value: "3", Type: CommandTypeSet, Seq: 5},
+		{Key: "b", Type: CommandTypeDelete, Seq: 6},
+		{Key: "d", Value: "4", Type: CommandTypeSet, Seq: 7},
+	} {
+		if got, ok := nextChange(t, ch); !ok || got != want {
+			t.Fatalf("change %+v, %v, want %+v", got, ok, want)
+		}
+	}
+
+	cancel()
+	cancel()
+	mustSet(t, db, "after", "v")
+	for {
+		c, ok := nextChange(t, ch)
+		if !ok {
+			break
+		}
+		if c.Key == "after" {
+			t.Fatalf("change %+v delivered after unsubscribe", c)
+		}
+	}
+}
+
+func TestSubscribeSlowSubscriber(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 100, 10)
+	defer db.Close()
+	ch, cancel := db.Subscribe()
+	defer cancel()
+	// writers do not wait for a subscriber which does not read, it is dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*walStreamBuffer; i++ {
+			if err := db.Set(fmt.Sprintf("k%04d", i), "v"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("writers wait for a slow subscriber")
+	}
+	n := 0
+	for {
+		c, ok := nextChange(t, ch)
+		if !ok {
+			break
+		}
+		if want := fmt.Sprintf("k%04d", n); c.Key != want {
+			t.Fatalf("change %d is %s, want %s", n, c.Key, want)
+		}
+		n++
+	}
+	if n == 0 || n >= 2*walStreamBuffer {
+		t.Fatalf("slow subscriber got %d of %d changes, want it dropped", n, 2*walStreamBuffer)
+	}
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+const manifestFilename = "MANIFEST"
+
+// Manifest describe the files of a database directory
+type Manifest struct {
+	Tables    []string `json:"tables"`     // disk sstable files
+	WAL       string   `json:"wal"`        // wal file
+	ValueLogs []string `json:"value_logs"` // value log segment files, empty if not enabled
+	Seq       uint64   `json:"seq"`        // sequence number of the last command
+}
+
+// writeManifest write the manifest to dir atomically
+func writeManifest(dir string, m *Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmpName := dir + "/" + manifestFilename + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, dir+"/"+manifestFilename)
+}
+
+// Checkpoint flush memory data and create a point-in-time copy of the database in destDir,
+// disk sstables are hardlinked when possible, the wal and value log are copied because they are still appended
+func (t *MEMSSTable) Checkpoint(destDir string) error {
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	// no flush and no write during linking
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	fs, err := os.ReadDir(t.rootPath)
+	if err != nil {
+		return err
+	}
+	m := &Manifest{Tables: make([]string, 0), Seq: t.seq}
+	for _, f := range fs {
+		if path.Ext(f.Name()) != ".sdb" {
+			continue
+		}
+		if err := linkOrCopyFile(t.rootPath+"/"+f.Name(), destDir+"/"+f.Name()); err != nil {
+			return fmt.Errorf("checkpoint %s: %v", f.Name(), err)
+		}
+		m.Tables = append(m.Tables, f.Name())
+	}
+	if t.vlog != nil {
+		// sealed segments are never written again, only the last one is copied
+		names := t.vlog.filenames()
+		for i, name := range names {
+			link := linkOrCopyFile
+			if i == len(names)-1 {
+				link = copyFile
+			}
+			if err := link(name, destDir+"/"+path.Base(name)); err != nil {
+				return fmt.Errorf("checkpoint %s: %v", path.Base(name), err)
+			}
+			m.ValueLogs = append(m.ValueLogs, path.Base(name))
+		}
+	}
+	m.WAL = path.Base(t.wal.filename)
+	if err := t.wal.Flush(); err != nil {
+		return err
+	}
+	if err := copyFile(t.wal.filename, destDir+"/"+m.WAL); err != nil {
+		return fmt.Errorf("checkpoint %s: %v", m.WAL, err)
+	}
+
+	return writeManifest(destDir, m)
+}
+
+func linkOrCopyFile(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+func copyFile(src, dst string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(df, sf); err != nil {
+		df.Close()
+		return err
+	}
+	if err := df.Sync(); err != nil {
+		df.Close()
+		return err
+	}
+	return df.Close()
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	if err := db.EnableValueLog(16); err != nil {
+		t.Fatal(err)
+	}
+	big := largeValue("big", 100)
+	mustSet(t, db, "a", "1")
+	mustSet(t, db, "b", "2")
+	mustSet(t, db, "big", big)
+	dest := t.TempDir() + "/checkpoint"
+	if err := db.Checkpoint(dest); err != nil {
+		t.Fatal(err)
+	}
+
+	// later writes and a compaction do not reach the checkpoint
+	mustSet(t, db, "a", "changed")
+	if err := db.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "c", "3")
+	mustSet(t, db, "big", largeValue("new", 100))
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(dest + "/" + manifestFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Tables) == 0 || m.WAL == "" || len(m.ValueLogs) == 0 {
+		t.Fatalf("manifest %+v misses files", m)
+	}
+	for _, name := range append(append(m.Tables, m.WAL), m.ValueLogs...) {
+		if _, err := os.Stat(dest + "/" + name); err != nil {
+			t.Fatalf("manifest file %s: %v", name, err)
+		}
+	}
+
+	cp := openTestDB(t, dest, 2, 1)
+	defer cp.Close()
+	if err := cp.EnableValueLog(16); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, cp, "a", "1")
+	expectValue(t, cp, "b", "2")
+	expectValue(t, cp, "big", big)
+	expectNotFound(t, cp, "c")
+	expectValue(t, db, "a", "changed")
+}
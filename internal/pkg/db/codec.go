@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pierrec/lz4"
+)
+
+// CodecConfig control the lz4 compression of disk blocks, lz4 frames record their own
+// block size, so tables written with any config are readable
+type CodecConfig struct {
+	CompressionLevel int  // higher is better compression, 0 is fastest
+	BlockMaxSize     int  // lz4 block size, one of 64KB, 256KB, 1MB, 4MB, 0 means 4MB
+	CompressWAL      bool // compress each wal record, a record is kept raw if it does not get smaller
+	PrefixKeys       bool // store block keys with prefix compression
+	// with PrefixKeys a full key is stored every N keys, lookups binary search them, default 16
+	KeyRestartInterval int
+}
+
+const defaultKeyRestartInterval = 16
+
+// restartInterval return the key restart interval of prefix compressed blocks, 0 if keys are not compressed
+func (c CodecConfig) restartInterval() int {
+	if !c.PrefixKeys {
+		return 0
+	}
+	if c.KeyRestartInterval == 0 {
+		return defaultKeyRestartInterval
+	}
+	return c.KeyRestartInterval
+}
+
+func (c CodecConfig) validate() error {
+	switch c.BlockMaxSize {
+	case 0, 64 << 10, 256 << 10, 1 << 20, 4 << 20:
+	default:
+		return fmt.Errorf("invalid lz4 block max size: %d", c.BlockMaxSize)
+	}
+	if c.CompressionLevel < 0 {
+		return fmt.Errorf("invalid lz4 compression level: %d", c.CompressionLevel)
+	}
+	if c.KeyRestartInterval < 0 {
+		return fmt.Errorf("invalid key restart interval: %d", c.KeyRestartInterval)
+	}
+	return nil
+}
+
+func (c CodecConfig) newWriter(w io.Writer) *lz4.Writer {
+	lz4w := lz4.NewWriter(w)
+	lz4w.Header.CompressionLevel = c.CompressionLevel
+	lz4w.Header.BlockMaxSize = c.BlockMaxSize
+	return lz4w
+}
+
+// SetCodec change the compression of tables flushed and wal records written after it
+func (t *MEMSSTable) SetCodec(c CodecConfig) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.codec = c
+	t.wal.compress = c.CompressWAL
+	return nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+// flushWithCodec flush the same keys with the codec to a new store and return its table bytes
+func flushWithCodec(t *testing.T, c CodecConfig, values map[string]string) (*MEMSSTable, int64) {
+	t.Helper()
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 100, 10)
+	if err := db.SetCodec(c); err != nil {
+		t.Fatal(err)
+	}
+	for key, val := range values {
+		mustSet(t, db, key, val)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, name := range tableFiles(t, dir) {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += fi.Size()
+	}
+	return db, size
+}
+
+func TestCodecCompressionLevel(t *testing.T) {
+	words := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel"}
+	r := rand.New(rand.NewSource(1))
+	values := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		var b strings.Builder
+		for j := 0; j < 40; j++ {
+			b.WriteString(words[r.Intn(len(words))])
+		}
+		values[fmt.Sprintf("key%04d", i)] = b.String()
+	}
+
+	fast, fastSize := flushWithCodec(t, CodecConfig{}, values)
+	defer fast.Close()
+	high, highSize := flushWithCodec(t, CodecConfig{CompressionLevel: 9, BlockMaxSize: 64 << 10}, values)
+	if highSize >= fastSize {
+		t.Fatalf("level 9 tables are %d bytes, level 0 tables are %d", highSize, fastSize)
+	}
+	for key, val := range values {
+		expectValue(t, fast, key, val)
+		expectValue(t, high, key, val)
+	}
+
+	// the lz4 frames describe themselves, a store opened with the default codec reads them
+	dir := high.rootPath
+	if err := high.Close(); err != nil {
+		t.Fatal(err)
+	}
+	high = openTestDB(t, dir, 100, 10)
+	defer high.Close()
+	for key, val := range values {
+		expectValue(t, high, key, val)
+	}
+}
+
+func TestCodecValidate(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	for _, c := range []CodecConfig{
+		{BlockMaxSize: 1000},
+		{CompressionLevel: -1},
+		{PrefixKeys: true, KeyRestartInterval: -1},
+	} {
+		if err := db.SetCodec(c); err == nil {
+			t.Fatalf("SetCodec(%+v) succeeded", c)
+		}
+	}
+}
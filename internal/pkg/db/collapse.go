@@ -0,0 +1,131 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// CollapseKey rewrite the disk tables containing key to keep only its newest version,
+// the key is dropped from disk if its newest version is in memory or is a tombstone
+func (t *MEMSSTable) CollapseKey(key string) error {
+	// reserve before the flushLock, a compaction takes the flushLock to commit its reserved tables
+	t.lock.Lock()
+	tables := t.reserveAllTables()
+	t.lock.Unlock()
+	defer func() {
+		t.lock.Lock()
+		t.releaseTables(tables)
+		t.lock.Unlock()
+	}()
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+
+	t.lock.RLock()
+	newestInMemory := t.activeTable.Query(key)
+	for i := len(t.immutable) - 1; newestInMemory == nil && i >= 0; i-- {
+		newestInMemory = t.immutable[i].Query(key)
+	}
+	t.lock.RUnlock()
+
+	// a read as of a sequence before the newest version misses the versions dropped for it
+	var dropped uint64
+	if newestInMemory != nil {
+		dropped = newestInMemory.seq
+	}
+	// newest table first, the first table containing the key holds the newest version
+	keep := newestInMemory == nil
+	for i := len(tables) - 1; i >= 0; i-- {
+		blocks, err := tables[i].loadBlocks()
+		if err != nil {
+			return err
+		}
+		var newest *Command
+		blockPos := -1
+		for j := range blocks {
+			if v := blocks[j].Query(key); v != nil {
+				newest = v
+				blockPos = j
+			}
+		}
+		if newest == nil {
+			continue
+		}
+		for j := range blocks {
+			blocks[j] = blocks[j].without(key)
+		}
+		if keep && newest.Command != CommandTypeDelete {
+			blocks[blockPos].Append(newest)
+			blocks[blockPos].Sort()
+		}
+		if keep {
+			dropped = newest.seq
+		}
+		keep = false
+		if err := t.rewriteTable(tables[i], blocks, dropped); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rewriteTable replace a disk table with the blocks, the new table keeps the seq of the old one,
+// dropped is the sequence before which a read may miss the commands left out of blocks
+func (t *MEMSSTable) rewriteTable(table *tableIndex, blocks []*SSTable, dropped uint64) error {
+	empty := true
+	for i := range blocks {
+		if blocks[i].Len() > 0 {
+			empty = false
+			break
+		}
+	}
+
+	var sparseIndex []SparseIndex
+	if !empty {
+		metaInfo, _, err := readTableMetaInfo(table.name)
+		if err != nil {
+			return err
+		}
+		t.lock.Lock()
+		filename := fmt.Sprintf("%s/%d.sdb", t.rootPath, t.id)
+		t.id++
+		t.lock.Unlock()
+		newMetaInfo := &SSTableMetaInfo{
+			Version:       metaInfoVersion,
+			Seq:           table.seq,
+			BlockKeyNum:   metaInfo.BlockKeyNum,
+			TableBlockNum: metaInfo.TableBlockNum,
+			DroppedSeq:    metaInfo.DroppedSeq,
+		}
+		if dropped > newMetaInfo.DroppedSeq {
+			newMetaInfo.DroppedSeq = dropped
+		}
+		if sparseIndex, _, err = writeTableFile(filename, blocks, newMetaInfo, t.codec, 0); err != nil {
+			return err
+		}
+		atomic.AddUint64(&t.stats.compactionBytes, newMetaInfo.fileSize())
+		t.lock.Lock()
+		t.addPrefixFilter(filename, blocks)
+		t.lock.Unlock()
+	}
+
+	t.lock.Lock()
+	t.replaceTableIndex(table.name, sparseIndex)
+	removed := t.retireTables([]string{table.name})
+	if dropped > t.droppedSeq {
+		t.droppedSeq = dropped
+	}
+	t.lock.Unlock()
+	return t.removeTableFiles(removed)
+}
+
+// readTableMetaInfo read the meta info of the disk table file
+func readTableMetaInfo(filename string) (*SSTableMetaInfo, int, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return readMetaInfo(f)
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+// tablesHolding return the number of disk tables holding a command of key
+func tablesHolding(t *testing.T, db *MEMSSTable, key string) int {
+	t.Helper()
+	db.lock.RLock()
+	tables := groupSparseIndex(db.sparseIndex)
+	db.lock.RUnlock()
+	n := 0
+	for _, table := range tables {
+		blocks, err := table.loadBlocks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range blocks {
+			if block.Query(key) != nil {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// overwrite set key in n flushed tables, each with another key which keeps the table alive
+func overwrite(t *testing.T, db *MEMSSTable, key string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		mustSet(t, db, key, fmt.Sprintf("v%d", i))
+		mustSet(t, db, fmt.Sprintf("other%d", i), "x")
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollapseKey(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	overwrite(t, db, "hot", 4)
+	if n := tablesHolding(t, db, "hot"); n != 4 {
+		t.Fatalf("hot in %d tables, want 4", n)
+	}
+	if err := db.CollapseKey("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if n := tablesHolding(t, db, "hot"); n != 1 {
+		t.Fatalf("hot in %d tables after collapse, want 1", n)
+	}
+	expectValue(t, db, "hot", "v3")
+	for i := 0; i < 4; i++ {
+		expectValue(t, db, fmt.Sprintf("other%d", i), "x")
+	}
+	db.Close()
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectValue(t, db, "hot", "v3")
+	if n := tablesHolding(t, db, "hot"); n != 1 {
+		t.Fatalf("hot in %d tables after reopen, want 1", n)
+	}
+}
+
+func TestCollapseKeyTombstone(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	overwrite(t, db, "hot", 3)
+	if err := db.Delete("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CollapseKey("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if n := tablesHolding(t, db, "hot"); n != 0 {
+		t.Fatalf("deleted hot in %d tables after collapse, want 0", n)
+	}
+	expectNotFound(t, db, "hot")
+	expectValue(t, db, "other0", "x")
+}
+
+func TestCollapseKeyNewestInMemory(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	overwrite(t, db, "hot", 3)
+	mustSet(t, db, "hot", "memory")
+	if err := db.CollapseKey("hot"); err != nil {
+		t.Fatal(err)
+	}
+	if n := tablesHolding(t, db, "hot"); n != 0 {
+		t.Fatalf("hot in %d tables after collapse, want 0", n)
+	}
+	expectValue(t, db, "hot", "memory")
+}
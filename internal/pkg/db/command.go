@@ -10,21 +10,61 @@ type CommandType uint8
 const (
 	CommandTypeSet CommandType = iota
 	CommandTypeDelete
+	CommandTypeValuePointer // set command, the value is a pointer to the value log
+	CommandTypeWriteID      // only in wal, the key is a write id and the value is the wrapped command
+	CommandTypeBatch        // only in wal, the value is the encoded commands of an atomic batch
+	CommandTypeSequence     // only in wal, the first record of a rotated wal, the value is the sequence number of the next command
+	CommandTypeWriteIDs     // only in wal, written by rotation after the sequence number, the value is the encoded recent write ids
 )
 
+// commandChecksumFlag mark a command followed by the crc32 of its value in the command type byte
+const commandChecksumFlag CommandType = 0x80
+
+// commandSeqFlag mark a command of a disk table followed by its sequence number, after the crc32 if both are set
+const commandSeqFlag CommandType = 0x40
+
+// commandFlags is the mask of all flags in the command type byte
+const commandFlags = commandChecksumFlag | commandSeqFlag
+
 type Command struct {
-	Key     string
-	Value   string
-	Command CommandType
+	Key         string
+	Value       string
+	Command     CommandType
+	checksum    uint32 // crc32 of the value, only if hasChecksum
+	hasChecksum bool
+	seq         uint64 // sequence number given when the command is applied, 0 if unknown as in tables before version 7
 }
 
+// Bytes encode the command without its sequence number, as it is written to wal
 func (t *Command) Bytes() (int, []byte) {
+	return t.encode(false)
+}
+
+// tableBytes encode the command with its sequence number if it is known, as it is written to a disk table
+func (t *Command) tableBytes() (int, []byte) {
+	return t.encode(t.seq != 0)
+}
+
+func (t *Command) encode(withSeq bool) (int, []byte) {
 	buf := bytes.NewBuffer(nil)
-	binary.Write(buf, binary.LittleEndian, t.Command)
+	typ := t.Command
+	if t.hasChecksum {
+		typ |= commandChecksumFlag
+	}
+	if withSeq {
+		typ |= commandSeqFlag
+	}
+	binary.Write(buf, binary.LittleEndian, typ)
 	binary.Write(buf, binary.LittleEndian, uint32(len(t.Key)))
 	buf.Write([]byte(t.Key))
 	binary.Write(buf, binary.LittleEndian, uint32(len(t.Value)))
 	buf.Write([]byte(t.Value))
+	if t.hasChecksum {
+		binary.Write(buf, binary.LittleEndian, t.checksum)
+	}
+	if withSeq {
+		binary.Write(buf, binary.LittleEndian, t.seq)
+	}
 	return buf.Len(), buf.Bytes()
 }
 
@@ -32,10 +72,19 @@ func (t *Command) Restore(data []byte) {
 	var n uint32
 	buf := bytes.NewBuffer(data)
 	binary.Read(buf, binary.LittleEndian, &t.Command)
+	t.hasChecksum = t.Command&commandChecksumFlag != 0
+	hasSeq := t.Command&commandSeqFlag != 0
+	t.Command &^= commandFlags
 	binary.Read(buf, binary.LittleEndian, &n)
 	t.Key = string(buf.Next(int(n)))
 	binary.Read(buf, binary.LittleEndian, &n)
 	t.Value = string(buf.Next(int(n)))
+	if t.hasChecksum {
+		binary.Read(buf, binary.LittleEndian, &t.checksum)
+	}
+	if hasSeq {
+		binary.Read(buf, binary.LittleEndian, &t.seq)
+	}
 	buf = nil
 }
 
@@ -0,0 +1,432 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+type CompactionOptions struct {
+	MinThreshold int     // merge when at least N tables have similar size, default 4
+	MaxThreshold int     // merge at most N tables at once, default 32
+	BucketLow    float64 // a table is similar if its size >= average size of the bucket * BucketLow, default 0.5
+	BucketHigh   float64 // a table is similar if its size <= average size of the bucket * BucketHigh, default 1.5
+	// a table whose share of tombstones is at least TombstoneRatio is merged with all older tables first,
+	// so its tombstones are dropped, 0 disables it
+	TombstoneRatio float64
+	// Policy picks the tables to merge instead of TombstoneRatio and size-tiered buckets, nil uses them
+	Policy CompactionPolicy
+}
+
+func (o *CompactionOptions) setDefaults() {
+	if o.MinThreshold <= 0 {
+		o.MinThreshold = 4
+	}
+	if o.MaxThreshold <= 0 {
+		o.MaxThreshold = 32
+	}
+	if o.BucketLow <= 0 {
+		o.BucketLow = 0.5
+	}
+	if o.BucketHigh <= 0 {
+		o.BucketHigh = 1.5
+	}
+}
+
+func (o *CompactionOptions) validate() error {
+	if o.MinThreshold < 2 {
+		return errors.New("compaction MinThreshold must be at least 2")
+	}
+	if o.MaxThreshold < o.MinThreshold {
+		return errors.New("compaction MaxThreshold must not be less than MinThreshold")
+	}
+	if o.BucketLow > 1 || o.BucketHigh < 1 {
+		return errors.New("compaction bucket must contain the average size")
+	}
+	if o.TombstoneRatio < 0 || o.TombstoneRatio > 1 {
+		return errors.New("compaction TombstoneRatio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Compact merge disk tables of similar size by size-tiered strategy until no bucket reaches MinThreshold,
+// only tables adjacent in seq order are merged so the newer version of a key still wins, tables reserved
+// by another compaction are skipped, with opts.Policy the policy picks the tables instead
+func (t *MEMSSTable) Compact(opts CompactionOptions) error {
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if opts.Policy != nil {
+		return t.compactByPolicy(opts.Policy)
+	}
+
+	for {
+		t.lock.Lock()
+		tables := groupSparseIndex(t.sparseIndex)
+		bucket, bottom, err := pickTombstones(tables, t.compacting, opts)
+		if err == nil && len(bucket) == 0 {
+			bucket, bottom, err = pickSizeTiered(tables, t.compacting, opts)
+		}
+		if err != nil || len(bucket) == 0 {
+			t.lock.Unlock()
+			return err
+		}
+		t.reserveTables(bucket)
+		t.lock.Unlock()
+
+		err = t.mergeTables(bucket, bottom)
+		t.lock.Lock()
+		t.releaseTables(bucket)
+		t.lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// MajorCompact flush memory tables and merge every disk table into one table without tombstones,
+// the inputs are replaced in one sparse index swap like any compaction
+func (t *MEMSSTable) MajorCompact() error {
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	// reserve after the flush, the flushLock is taken again to commit the merge
+	t.lock.Lock()
+	tables := t.reserveAllTables()
+	t.lock.Unlock()
+	defer func() {
+		t.lock.Lock()
+		t.releaseTables(tables)
+		t.lock.Unlock()
+	}()
+	if len(tables) == 0 {
+		return nil
+	}
+	return t.mergeTables(tables, true)
+}
+
+// pickSizeTiered return the first run of adjacent tables of similar size reaching MinThreshold,
+// a busy table breaks the run, bottom reports whether the run contains the oldest table
+func pickSizeTiered(tables []*tableIndex, busy map[string]bool, opts CompactionOptions) ([]*tableIndex, bool, error) {
+	sizes := make([]int64, len(tables))
+	skip := make([]bool, len(tables))
+	for i, table := range tables {
+		// a busy table may be removed by its compaction already
+		if skip[i] = busy[table.name]; skip[i] {
+			continue
+		}
+		fi, err := os.Stat(table.name)
+		if err != nil {
+			return nil, false, err
+		}
+		sizes[i] = fi.Size()
+	}
+	start, end := sizeTieredRun(sizes, skip, opts)
+	if start == end {
+		return nil, false, nil
+	}
+	return tables[start:end], start == 0, nil
+}
+
+// sizeTieredRun return the first run [start, end) of adjacent sizes which are similar and reach
+// MinThreshold, a skipped size breaks the run, start == end if there is none
+func sizeTieredRun(sizes []int64, skip []bool, opts CompactionOptions) (int, int) {
+	start := 0
+	var total int64
+	for i := 0; i < len(sizes); i++ {
+		if skip[i] {
+			if i-start >= opts.MinThreshold {
+				return start, i
+			}
+			start = i + 1
+			total = 0
+			continue
+		}
+		size := sizes[i]
+		if i > start {
+			avg := float64(total) / float64(i-start)
+			if float64(size) < avg*opts.BucketLow || float64(size) > avg*opts.BucketHigh || i-start >= opts.MaxThreshold {
+				if i-start >= opts.MinThreshold {
+					return start, i
+				}
+				start = i
+				total = 0
+			}
+		}
+		total += size
+	}
+	if len(sizes)-start >= opts.MinThreshold {
+		return start, len(sizes)
+	}
+	return 0, 0
+}
+
+// pickTombstones return the oldest table whose tombstone ratio reaches TombstoneRatio with all older
+// tables, the run is bottom so the merge drops the tombstones, tables before meta info version 5 have
+// no ratio stored and are not picked
+func pickTombstones(tables []*tableIndex, busy map[string]bool, opts CompactionOptions) ([]*tableIndex, bool, error) {
+	if opts.TombstoneRatio <= 0 {
+		return nil, false, nil
+	}
+	for i := range tables {
+		if busy[tables[i].name] {
+			// a run without the oldest table must keep its tombstones
+			return nil, false, nil
+		}
+		metaInfo, _, err := readTableMetaInfo(tables[i].name)
+		if err != nil {
+			return nil, false, err
+		}
+		if metaInfo.TombstoneCount > 0 && metaInfo.tombstoneRatio() >= opts.TombstoneRatio {
+			return tables[:i+1], true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// tablesBusy report whether any of the tables is reserved by a compaction, caller must hold the lock
+func (t *MEMSSTable) tablesBusy(tables []*tableIndex) bool {
+	for _, table := range tables {
+		if t.compacting[table.name] {
+			return true
+		}
+	}
+	return false
+}
+
+// reserveTables mark the tables as input of a compaction, caller must hold the lock
+func (t *MEMSSTable) reserveTables(tables []*tableIndex) {
+	for _, table := range tables {
+		t.compacting[table.name] = true
+	}
+}
+
+// releaseTables unmark the tables and wake up waiters of reserved tables, caller must hold the lock
+func (t *MEMSSTable) releaseTables(tables []*tableIndex) {
+	for _, table := range tables {
+		delete(t.compacting, table.name)
+	}
+	t.compactCond.Broadcast()
+}
+
+// reserveAllTables wait for running compactions and reserve every current disk table, caller must hold the lock
+func (t *MEMSSTable) reserveAllTables() []*tableIndex {
+	for {
+		tables := groupSparseIndex(t.sparseIndex)
+		if !t.tablesBusy(tables) {
+			t.reserveTables(tables)
+			return tables
+		}
+		t.compactCond.Wait()
+	}
+}
+
+// mergeTables merge the tables in seq order into one new table keeping the newest version of each key,
+// tombstones are dropped if bottom is true because no older table holds the keys, caller must reserve the tables,
+// the merge waits for a slot of the compaction concurrency limit
+func (t *MEMSSTable) mergeTables(tables []*tableIndex, bottom bool) error {
+	release := t.acquireCompaction()
+	defer release()
+	start := time.Now()
+
+	var seq uint64
+	var read uint64
+	for _, table := range tables {
+		if table.seq > seq {
+			seq = table.seq
+		}
+		if fi, err := os.Stat(table.name); err == nil {
+			read += uint64(fi.Size())
+		}
+	}
+	it, err := newVersionIterator(tables)
+	if err != nil {
+		return err
+	}
+	// a read as of a sequence before a kept version misses the older versions dropped for it
+	t.lock.RLock()
+	dropped := t.droppedSeq
+	blockKeyNum, tableBlockNum := int(t.blockKeyNum), t.tableBlockNum
+	t.lock.RUnlock()
+	data := make(CommandData, 0)
+	var droppedKeys uint64
+	for it.Next() {
+		c := it.Versions()[0]
+		if (len(it.Versions()) > 1 || bottom && c.Command == CommandTypeDelete) && c.seq > dropped {
+			dropped = c.seq
+		}
+		droppedKeys += uint64(len(it.Versions()) - 1)
+		if bottom && c.Command == CommandTypeDelete {
+			droppedKeys++
+			continue
+		}
+		data = append(data, c)
+	}
+
+	names := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		names[table.name] = true
+	}
+	blocks := make([]*SSTable, 0, len(data)/blockKeyNum+1)
+	for i := 0; i < len(data); i += blockKeyNum {
+		j := i + blockKeyNum
+		if j > len(data) {
+			j = len(data)
+		}
+		block := NewSSTable()
+		block.data = data[i:j]
+		block.sorted = true
+		blocks = append(blocks, block)
+	}
+
+	var sparseIndex []SparseIndex
+	if len(blocks) > 0 {
+		t.lock.Lock()
+		filename := fmt.Sprintf("%s/%d.sdb", t.rootPath, t.id)
+		t.id++
+		t.lock.Unlock()
+		metaInfo := &SSTableMetaInfo{
+			Version:       metaInfoVersion,
+			Seq:           seq,
+			BlockKeyNum:   uint16(blockKeyNum),
+			TableBlockNum: tableBlockNum,
+			DroppedSeq:    dropped,
+		}
+		// values are moved out of mostly dead value log segments before the table points to them
+		t.vlogGCLock.Lock()
+		err = t.moveValues(filename, blocks, names)
+		t.vlogGCLock.Unlock()
+		if err == nil {
+			sparseIndex, _, err = writeTableFile(filename, blocks, metaInfo, t.codec, 0)
+		}
+		if err != nil {
+			t.lock.Lock()
+			delete(t.vlogRefs, filename)
+			t.lock.Unlock()
+			return err
+		}
+		atomic.AddUint64(&t.stats.compactionBytes, metaInfo.fileSize())
+		atomic.AddUint64(&t.stats.compactionWritten, metaInfo.fileSize())
+		t.lock.Lock()
+		t.addPrefixFilter(filename, blocks)
+		t.lock.Unlock()
+	}
+
+	// tables are not removed during a checkpoint or an integrity check
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+	t.lock.Lock()
+	indexes := make([]*SparseIndex, 0, len(t.sparseIndex))
+	for _, index := range t.sparseIndex {
+		if !names[index.TableName] {
+			indexes = append(indexes, index)
+		}
+	}
+	retired := make([]string, 0, len(names))
+	for name := range names {
+		retired = append(retired, name)
+	}
+	removed := t.retireTables(retired)
+	for i := range sparseIndex {
+		indexes = append(indexes, &sparseIndex[i])
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return indexes[i].TableSeq < indexes[j].TableSeq
+	})
+	t.sparseIndex = indexes
+	if dropped > t.droppedSeq {
+		t.droppedSeq = dropped
+	}
+	t.lock.Unlock()
+
+	if err := t.removeTableFiles(removed); err != nil {
+		return err
+	}
+	// the segments only the merged tables pointed into are removed
+	t.vlogGCLock.Lock()
+	err = t.collectValueLog()
+	t.vlogGCLock.Unlock()
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&t.stats.compactions, 1)
+	atomic.AddUint64(&t.stats.compactionRead, read)
+	atomic.AddUint64(&t.stats.compactionDropped, droppedKeys)
+	atomic.StoreInt64(&t.stats.lastCompaction, int64(time.Since(start)))
+	return nil
+}
+
+type backgroundCompactor struct {
+	opts   CompactionOptions
+	signal chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// notify wake up the compactor after a flush, never block the flusher
+func (c *backgroundCompactor) notify() {
+	if c == nil {
+		return
+	}
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+// StartBackgroundCompaction start a goroutine compact disk tables after flush, by opts.Policy if it is set
+func (t *MEMSSTable) StartBackgroundCompaction(opts CompactionOptions) error {
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.compactor != nil {
+		return errors.New("background compaction already started")
+	}
+	t.compactor = &backgroundCompactor{
+		opts:   opts,
+		signal: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.backgroundCompact(t.compactor)
+	// tables loaded from disk may need compaction already
+	t.compactor.notify()
+	return nil
+}
+
+// StopBackgroundCompaction stop the background compaction goroutine and wait it exit
+func (t *MEMSSTable) StopBackgroundCompaction() {
+	t.lock.Lock()
+	c := t.compactor
+	t.compactor = nil
+	t.lock.Unlock()
+	if c == nil {
+		return
+	}
+	close(c.stop)
+	<-c.done
+}
+
+func (t *MEMSSTable) backgroundCompact(c *backgroundCompactor) {
+	defer close(c.done)
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-c.signal:
+			if err := t.Compact(c.opts); err != nil {
+				log.Printf("background compaction error: %v", err)
+			}
+		}
+	}
+}
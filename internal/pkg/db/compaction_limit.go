@@ -0,0 +1,35 @@
+package db
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// defaultCompactionConcurrency is the number of merges running at once unless changed
+const defaultCompactionConcurrency = 1
+
+// SetCompactionConcurrency limit the number of merges running at once, background, manual, range
+// and major compactions share the limit and a merge over it waits for a running one to finish,
+// merges already waiting keep the limit they were queued with
+func (t *MEMSSTable) SetCompactionConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid compaction concurrency: %d", n)
+	}
+	t.lock.Lock()
+	t.compactSem = make(chan struct{}, n)
+	t.lock.Unlock()
+	return nil
+}
+
+// acquireCompaction wait for a free compaction slot and return the function releasing it
+func (t *MEMSSTable) acquireCompaction() func() {
+	t.lock.RLock()
+	sem := t.compactSem
+	t.lock.RUnlock()
+	sem <- struct{}{}
+	atomic.AddInt64(&t.stats.runningMerges, 1)
+	return func() {
+		atomic.AddInt64(&t.stats.runningMerges, -1)
+		<-sem
+	}
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompactionQueuesOverLimit(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	if err := db.SetCompactionConcurrency(0); err == nil {
+		t.Fatal("a concurrency of 0 is accepted")
+	}
+	flushRanges(t, db, 2)
+	// the only slot is taken, as by a running merge
+	release := db.acquireCompaction()
+	done := make(chan error, 1)
+	go func() {
+		done <- db.CompactRange("a", "b")
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("compaction over the limit returned %v, want it to wait", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if s := db.CompactionStats(); s.Compactions != 0 || s.Running != 1 {
+		t.Fatalf("%d merges finished, %d running while the slot is taken, want 0 and 1", s.Compactions, s.Running)
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s := db.CompactionStats(); s.Compactions != 1 || s.Running != 0 {
+		t.Fatalf("%d merges finished, %d running, want 1 and 0", s.Compactions, s.Running)
+	}
+	expectRanges(t, db, 2)
+}
+
+func TestCompactionConcurrencyLimit(t *testing.T) {
+	const limit, ranges = 2, 6
+	db := openTestDB(t, t.TempDir(), 100, 10)
+	defer db.Close()
+	if err := db.SetCompactionConcurrency(limit); err != nil {
+		t.Fatal(err)
+	}
+	// two tables in each of the disjoint ranges a, b, ...
+	for round := 0; round < 2; round++ {
+		for r := 0; r < ranges; r++ {
+			for i := 0; i < 300; i++ {
+				mustSet(t, db, fmt.Sprintf("%c%03d", 'a'+r, i), fmt.Sprintf("v%d", round))
+			}
+			if err := db.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var max int64
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			if n := db.CompactionStats().Running; n > atomic.LoadInt64(&max) {
+				atomic.StoreInt64(&max, n)
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	errs := make(chan error, ranges)
+	for r := 0; r < ranges; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			start := fmt.Sprintf("%c", 'a'+r)
+			errs <- db.CompactRange(start, start+"~")
+		}(r)
+	}
+	wg.Wait()
+	close(stop)
+	<-sampled
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := atomic.LoadInt64(&max); n == 0 || n > limit {
+		t.Fatalf("at most %d merges ran at once, want 1 to %d", n, limit)
+	}
+	if s := db.CompactionStats(); s.Compactions != ranges || s.Running != 0 {
+		t.Fatalf("%d merges finished, %d running, want %d and 0", s.Compactions, s.Running, ranges)
+	}
+	for r := 0; r < ranges; r++ {
+		expectValue(t, db, fmt.Sprintf("%c%03d", 'a'+r, 7), "v1")
+	}
+}
@@ -0,0 +1,78 @@
+package db
+
+import "fmt"
+
+// CompactionPolicy decide which disk tables to merge, Pick is given the tables oldest first and
+// return the ids of adjacent tables to merge into one, no id means nothing to merge, Compact calls
+// it again after each merge
+type CompactionPolicy interface {
+	Pick(tables []TableInfo) ([]uint64, error)
+}
+
+// SizeTieredPolicy merge the first run of adjacent tables of similar size reaching MinThreshold,
+// like Compact without a policy but without TombstoneRatio
+type SizeTieredPolicy struct {
+	Options CompactionOptions
+}
+
+func (p SizeTieredPolicy) Pick(tables []TableInfo) ([]uint64, error) {
+	opts := p.Options
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, len(tables))
+	for i, table := range tables {
+		sizes[i] = table.Size
+	}
+	start, end := sizeTieredRun(sizes, make([]bool, len(tables)), opts)
+	return tableIDs(tables[start:end]), nil
+}
+
+// LeveledPolicy keep each table at least Fanout times larger than the next newer one, so the tables
+// form levels growing by Fanout from the newest and a key is rewritten about Fanout times per level,
+// the oldest adjacent pair breaking it is merged first
+type LeveledPolicy struct {
+	Fanout int // default 10
+}
+
+func (p LeveledPolicy) Pick(tables []TableInfo) ([]uint64, error) {
+	fanout := p.Fanout
+	if fanout == 0 {
+		fanout = 10
+	}
+	if fanout < 2 {
+		return nil, fmt.Errorf("leveled compaction Fanout must be at least 2: %d", fanout)
+	}
+	for i := 1; i < len(tables); i++ {
+		if tables[i-1].Size < int64(fanout)*tables[i].Size {
+			return tableIDs(tables[i-1 : i+1]), nil
+		}
+	}
+	return nil, nil
+}
+
+func tableIDs(tables []TableInfo) []uint64 {
+	ids := make([]uint64, len(tables))
+	for i, table := range tables {
+		ids[i] = table.ID
+	}
+	return ids
+}
+
+// compactByPolicy merge the tables picked by the policy until it picks none
+func (t *MEMSSTable) compactByPolicy(policy CompactionPolicy) error {
+	for {
+		tables, err := t.ListTables()
+		if err != nil {
+			return err
+		}
+		ids, err := policy.Pick(tables)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := t.MergeTables(ids); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// pickOnce merge the second and the third table once, then nothing
+type pickOnce struct {
+	lock   sync.Mutex
+	picked []uint64
+	calls  int
+}
+
+func (p *pickOnce) Pick(tables []TableInfo) ([]uint64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.calls++
+	if p.picked != nil || len(tables) < 3 {
+		return nil, nil
+	}
+	p.picked = tableIDs(tables[1:3])
+	return p.picked, nil
+}
+
+type failingPolicy struct{}
+
+func (failingPolicy) Pick([]TableInfo) ([]uint64, error) {
+	return nil, errInjected
+}
+
+func flushTables(t *testing.T, db *MEMSSTable, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		mustSet(t, db, "k", fmt.Sprintf("v%d", i))
+		mustSet(t, db, fmt.Sprintf("k%d", i), "v")
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCustomCompactionPolicy(t *testing.T) {
+	for _, background := range []bool{false, true} {
+		dir := t.TempDir()
+		db := openTestDB(t, dir, 2, 1)
+		flushTables(t, db, 4)
+		before, err := db.ListTables()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &pickOnce{}
+		if background {
+			if err := db.StartBackgroundCompaction(CompactionOptions{Policy: p}); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "a background merge by the policy", func() bool {
+				return len(tableFiles(t, dir)) == 3
+			})
+			db.StopBackgroundCompaction()
+		} else if err := db.Compact(CompactionOptions{Policy: p}); err != nil {
+			t.Fatal(err)
+		}
+
+		// exactly the picked tables are merged, the ones around them are kept
+		if want := tableIDs(before[1:3]); !reflect.DeepEqual(p.picked, want) || !background && p.calls < 2 {
+			t.Fatalf("background %v: picked %v in %d calls, want %v then nothing", background, p.picked, p.calls, want)
+		}
+		after, err := db.ListTables()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != 3 || after[0].ID != before[0].ID || after[2].ID != before[3].ID {
+			t.Fatalf("background %v: tables %v after merging %v", background, tableIDs(after), p.picked)
+		}
+		for _, id := range p.picked {
+			if _, err := os.Stat(fmt.Sprintf("%s/%d.sdb", dir, id)); !os.IsNotExist(err) {
+				t.Fatalf("background %v: merged table %d is not removed: %v", background, id, err)
+			}
+		}
+		expectValue(t, db, "k", "v3")
+		for i := 0; i < 4; i++ {
+			expectValue(t, db, fmt.Sprintf("k%d", i), "v")
+		}
+		db.Close()
+	}
+}
+
+func TestCompactionPolicyError(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	flushTables(t, db, 2)
+	if err := db.Compact(CompactionOptions{Policy: failingPolicy{}}); !errors.Is(err, errInjected) {
+		t.Fatalf("compact with a failing policy: %v, want its error", err)
+	}
+}
+
+func TestShippedCompactionPolicies(t *testing.T) {
+	tables := func(sizes ...int64) []TableInfo {
+		infos := make([]TableInfo, len(sizes))
+		for i, size := range sizes {
+			infos[i] = TableInfo{ID: uint64(i + 1), Size: size}
+		}
+		return infos
+	}
+	for _, c := range []struct {
+		policy CompactionPolicy
+		sizes  []int64
+		want   []uint64
+	}{
+		{LeveledPolicy{}, []int64{10000, 1000, 100, 10}, nil},
+		{LeveledPolicy{}, []int64{10000, 5000, 100, 10}, []uint64{1, 2}},
+		{LeveledPolicy{}, []int64{10000, 1000, 100, 50}, []uint64{3, 4}},
+		{LeveledPolicy{Fanout: 2}, []int64{10000, 5000, 100, 10}, nil},
+		{SizeTieredPolicy{Options: CompactionOptions{MinThreshold: 3}}, []int64{1000, 10, 11, 9}, []uint64{2, 3, 4}},
+		{SizeTieredPolicy{Options: CompactionOptions{MinThreshold: 3}}, []int64{1000, 10, 11}, nil},
+	} {
+		got, err := c.policy.Pick(tables(c.sizes...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(c.want) || len(got) > 0 && !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%T%+v of %v picked %v, want %v", c.policy, c.policy, c.sizes, got, c.want)
+		}
+	}
+	if _, err := (LeveledPolicy{Fanout: 1}).Pick(tables(1, 1)); err == nil {
+		t.Fatal("a fanout of 1 is accepted")
+	}
+	if _, err := (SizeTieredPolicy{Options: CompactionOptions{MinThreshold: 1}}).Pick(tables(1, 1)); err == nil {
+		t.Fatal("a MinThreshold of 1 is accepted")
+	}
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// tableRange is the smallest and the largest key of a disk table
+type tableRange struct {
+	table *tableIndex
+	first string
+	last  string
+}
+
+// CompactRange merge the disk tables holding keys in [start, end) into one table, every such table
+// must lie inside the range so no other table holds an older version of its keys, compactions of
+// disjoint ranges run concurrently and never touch the same table
+func (t *MEMSSTable) CompactRange(start, end string) error {
+	if start >= end {
+		return fmt.Errorf("CompactRange: empty range [%q, %q)", start, end)
+	}
+	for {
+		ranges, err := t.tableRanges()
+		if err != nil {
+			return err
+		}
+		selected := make([]*tableIndex, 0)
+		for _, r := range ranges {
+			if r.last < start || r.first >= end {
+				continue
+			}
+			if r.first < start || r.last >= end {
+				return fmt.Errorf("CompactRange: table %s with keys [%q, %q] crosses the range [%q, %q)", r.table.name, r.first, r.last, start, end)
+			}
+			selected = append(selected, r.table)
+		}
+		if len(selected) < 2 {
+			return nil
+		}
+		done, err := t.compactTables(selected)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// CompactPartitions split the disk tables into partitions of overlapping key ranges and merge the
+// partitions concurrently, at most parallel at once and within the compaction concurrency limit, a
+// partition changed by another compaction is skipped
+func (t *MEMSSTable) CompactPartitions(parallel int) error {
+	if parallel < 1 {
+		return errors.New("CompactPartitions: parallel must be at least 1")
+	}
+	ranges, err := t.tableRanges()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, parallel)
+	for _, tables := range partitionTables(ranges) {
+		if len(tables) < 2 {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(tables []*tableIndex) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := t.compactTables(tables); err != nil {
+				errLock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errLock.Unlock()
+			}
+		}(tables)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// partitionTables group tables whose key ranges overlap, tables of a partition keep the seq order
+func partitionTables(ranges []tableRange) [][]*tableIndex {
+	sorted := make([]tableRange, len(ranges))
+	copy(sorted, ranges)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].first < sorted[j].first
+	})
+
+	partitions := make([][]*tableIndex, 0)
+	var last string
+	for i, r := range sorted {
+		if i == 0 || r.first > last {
+			partitions = append(partitions, make([]*tableIndex, 0))
+			last = r.last
+		}
+		if r.last > last {
+			last = r.last
+		}
+		partitions[len(partitions)-1] = append(partitions[len(partitions)-1], r.table)
+	}
+	for _, tables := range partitions {
+		sort.SliceStable(tables, func(i, j int) bool {
+			return tables[i].seq < tables[j].seq
+		})
+	}
+	return partitions
+}
+
+// tableRanges return the key range of each disk table, tables without keys are skipped
+func (t *MEMSSTable) tableRanges() ([]tableRange, error) {
+	for {
+		t.lock.RLock()
+		tables := groupSparseIndex(t.sparseIndex)
+		t.lock.RUnlock()
+
+		ranges, err := loadTableRanges(tables)
+		// a table is removed by a running compaction, take the tables again
+		if os.IsNotExist(err) {
+			continue
+		}
+		return ranges, err
+	}
+}
+
+// loadTableRanges take the key range of each table from its sparse index, tables written before the
+// range is stored in meta info load their blocks
+func loadTableRanges(tables []*tableIndex) ([]tableRange, error) {
+	ranges := make([]tableRange, 0, len(tables))
+	for _, table := range tables {
+		if index := table.indexes[0]; index.TableFirst != "" || index.TableLast != "" {
+			ranges = append(ranges, tableRange{table: table, first: index.TableFirst, last: index.TableLast})
+			continue
+		}
+		blocks, err := table.loadBlocks()
+		if err != nil {
+			return nil, err
+		}
+		r := tableRange{table: table}
+		empty := true
+		for _, block := range blocks {
+			if block.Len() == 0 {
+				continue
+			}
+			first, last := block.data[0].Key, block.data[block.Len()-1].Key
+			if empty || first < r.first {
+				r.first = first
+			}
+			if empty || last > r.last {
+				r.last = last
+			}
+			empty = false
+		}
+		if !empty {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges, nil
+}
+
+// compactTables wait for the tables reserved by another compaction and merge them, tombstones are dropped
+// because no table outside holds their keys, done is false if a table is already removed
+func (t *MEMSSTable) compactTables(tables []*tableIndex) (bool, error) {
+	t.lock.Lock()
+	for t.tablesBusy(tables) {
+		t.compactCond.Wait()
+	}
+	current := make(map[string]bool)
+	for _, index := range t.sparseIndex {
+		current[index.TableName] = true
+	}
+	for _, table := range tables {
+		if !current[table.name] {
+			t.lock.Unlock()
+			return false, nil
+		}
+	}
+	t.reserveTables(tables)
+	t.lock.Unlock()
+
+	err := t.mergeTables(tables, true)
+	t.lock.Lock()
+	t.releaseTables(tables)
+	t.lock.Unlock()
+	return true, err
+}
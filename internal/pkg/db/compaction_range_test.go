@@ -0,0 +1,97 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// flushRanges write n tables in each of the ranges a and m, key i of table j is set to its table
+func flushRanges(t *testing.T, db *MEMSSTable, n int) {
+	t.Helper()
+	for j := 0; j < n; j++ {
+		for _, prefix := range []string{"a", "m"} {
+			mustSet(t, db, fmt.Sprintf("%s%d", prefix, 0), fmt.Sprintf("t%d", j))
+			mustSet(t, db, fmt.Sprintf("%s%d", prefix, j+1), fmt.Sprintf("t%d", j))
+			if err := db.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func expectRanges(t *testing.T, db *MEMSSTable, n int) {
+	t.Helper()
+	for _, prefix := range []string{"a", "m"} {
+		expectValue(t, db, prefix+"0", fmt.Sprintf("t%d", n-1))
+		for j := 0; j < n; j++ {
+			expectValue(t, db, fmt.Sprintf("%s%d", prefix, j+1), fmt.Sprintf("t%d", j))
+		}
+	}
+}
+
+func TestConcurrentCompactRange(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	flushRanges(t, db, 3)
+	if err := db.CompactRange("a1", "z"); err == nil {
+		t.Fatal("compaction of a range crossed by a table succeeded")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, r := range [][2]string{{"a", "b"}, {"m", "n"}} {
+		wg.Add(1)
+		go func(start, end string) {
+			defer wg.Done()
+			errs <- db.CompactRange(start, end)
+		}(r[0], r[1])
+	}
+	// reads and writes go on during the compactions
+	for i := 0; i < 20; i++ {
+		mustSet(t, db, fmt.Sprintf("x%d", i), "x")
+		expectValue(t, db, "a0", "t2")
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(tableFiles(t, dir)); n != 2 {
+		t.Fatalf("%d tables after the compactions, want 2", n)
+	}
+	expectRanges(t, db, 3)
+	db.Close()
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectRanges(t, db, 3)
+}
+
+func TestCompactPartitions(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	flushRanges(t, db, 3)
+	ranges, err := db.tableRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	partitions := partitionTables(ranges)
+	if len(partitions) != 2 || len(partitions[0]) != 3 || len(partitions[1]) != 3 {
+		t.Fatalf("partitions of %d tables: %d", len(ranges), len(partitions))
+	}
+	if err := db.CompactPartitions(0); err == nil {
+		t.Fatal("CompactPartitions(0) succeeded")
+	}
+	if err := db.CompactPartitions(2); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tableFiles(t, dir)); n != 2 {
+		t.Fatalf("%d tables after the compactions, want 2", n)
+	}
+	expectRanges(t, db, 3)
+}
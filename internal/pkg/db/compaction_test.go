@@ -0,0 +1,201 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSizeTieredRun(t *testing.T) {
+	opts := CompactionOptions{MinThreshold: 3}
+	opts.setDefaults()
+	for _, c := range []struct {
+		sizes      []int64
+		skip       []int
+		start, end int
+	}{
+		{sizes: []int64{10, 10}, start: 0, end: 0},
+		{sizes: []int64{10, 11, 9}, start: 0, end: 3},
+		// a big table ends the run of small ones
+		{sizes: []int64{100, 10, 11, 9, 100}, start: 1, end: 4},
+		{sizes: []int64{10, 100, 10, 100}, start: 0, end: 0},
+		// a busy table breaks the run
+		{sizes: []int64{10, 10, 10, 10, 10}, skip: []int{2}, start: 0, end: 0},
+		{sizes: []int64{10, 10, 10, 10, 10}, skip: []int{1}, start: 2, end: 5},
+	} {
+		skip := make([]bool, len(c.sizes))
+		for _, i := range c.skip {
+			skip[i] = true
+		}
+		start, end := sizeTieredRun(c.sizes, skip, opts)
+		if start == end && c.start == c.end {
+			continue
+		}
+		if start != c.start || end != c.end {
+			t.Fatalf("run of %v skipping %v: [%d, %d), want [%d, %d)", c.sizes, c.skip, start, end, c.start, c.end)
+		}
+	}
+}
+
+func TestBackgroundCompaction(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	if err := db.StartBackgroundCompaction(CompactionOptions{MinThreshold: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.StartBackgroundCompaction(CompactionOptions{}); err == nil {
+		t.Fatal("a second background compaction started")
+	}
+	// 4 tables of similar size, k is overwritten in each of them
+	for i := 0; i < 4; i++ {
+		mustSet(t, db, "k", fmt.Sprintf("v%d", i))
+		mustSet(t, db, fmt.Sprintf("k%d", i), "v")
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "a background compaction", func() bool {
+		return len(tableFiles(t, dir)) == 1
+	})
+	expectValue(t, db, "k", "v3")
+	for i := 0; i < 4; i++ {
+		expectValue(t, db, fmt.Sprintf("k%d", i), "v")
+	}
+	db.StopBackgroundCompaction()
+	db.StopBackgroundCompaction()
+}
+
+func TestPickTombstones(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	flushPair := func(a, b string, del bool) {
+		t.Helper()
+		for _, key := range []string{a, b} {
+			if del {
+				if err := db.Delete(key); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				mustSet(t, db, key, key)
+			}
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flushPair("a", "b", false)
+	flushPair("c", "d", false)
+	flushPair("a", "b", true)
+	flushPair("e", "f", false)
+
+	opts := CompactionOptions{MinThreshold: 10, MaxThreshold: 10, TombstoneRatio: 0.5}
+	opts.setDefaults()
+	db.lock.Lock()
+	tables := groupSparseIndex(db.sparseIndex)
+	run, bottom, err := pickTombstones(tables, nil, opts)
+	// the oldest table is reserved, the run can not reach the bottom
+	busyRun, _, busyErr := pickTombstones(tables, map[string]bool{tables[0].name: true}, opts)
+	db.lock.Unlock()
+	if err != nil || busyErr != nil {
+		t.Fatal(err, busyErr)
+	}
+	if len(run) != 3 || !bottom || run[2].name != tables[2].name {
+		t.Fatalf("picked %d tables, bottom %v, want the 3 oldest up to the tombstones", len(run), bottom)
+	}
+	if len(busyRun) != 0 {
+		t.Fatalf("picked %d tables with the oldest one busy", len(busyRun))
+	}
+
+	// size-tiered would not merge 4 tables with MinThreshold 10, the tombstones are merged away
+	if err := db.Compact(opts); err != nil {
+		t.Fatal(err)
+	}
+	names := tableFiles(t, dir)
+	if len(names) != 2 {
+		t.Fatalf("%d tables after compaction, want 2", len(names))
+	}
+	for _, name := range names {
+		metaInfo, _, err := readTableMetaInfo(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metaInfo.TombstoneCount != 0 {
+			t.Fatalf("table %s keeps %d tombstones", name, metaInfo.TombstoneCount)
+		}
+	}
+	if n := tableKeyCount(t, db); n != 4 {
+		t.Fatalf("%d commands on disk, want 4", n)
+	}
+	expectNotFound(t, db, "a")
+	expectValue(t, db, "c", "c")
+	expectValue(t, db, "f", "f")
+}
+
+func TestMajorCompact(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 4, 2)
+	if err := db.MajorCompact(); err != nil {
+		t.Fatalf("major compaction of an empty store: %v", err)
+	}
+	want := make(map[string]string)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			key, val := fmt.Sprintf("k%02d", i), fmt.Sprintf("v%d-%d", i, round)
+			mustSet(t, db, key, val)
+			want[key] = val
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i += 3 {
+		key := fmt.Sprintf("k%02d", i)
+		if err := db.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, key)
+	}
+	// the memory tables are flushed first
+	mustSet(t, db, "new", "v")
+	want["new"] = "v"
+	if len(tableFiles(t, dir)) < 2 {
+		t.Fatal("expect more than one table before the compaction")
+	}
+
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	check := func(db *MEMSSTable) {
+		t.Helper()
+		names := tableFiles(t, dir)
+		if len(names) != 1 {
+			t.Fatalf("%d tables after a major compaction, want 1", len(names))
+		}
+		metaInfo, _, err := readTableMetaInfo(names[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metaInfo.TombstoneCount != 0 || metaInfo.KeyCount != uint64(len(want)) {
+			t.Fatalf("%d commands, %d tombstones, want %d live keys only", metaInfo.KeyCount, metaInfo.TombstoneCount, len(want))
+		}
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("k%02d", i)
+			if val, ok := want[key]; ok {
+				expectValue(t, db, key, val)
+			} else {
+				expectNotFound(t, db, key)
+			}
+		}
+		expectValue(t, db, "new", "v")
+	}
+	check(db)
+	if tmp, _ := filepath.Glob(dir + "/*.tmp"); len(tmp) != 0 {
+		t.Fatalf("temporary files left: %v", tmp)
+	}
+	db.Close()
+	db = openTestDB(t, dir, 4, 2)
+	defer db.Close()
+	check(db)
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"os"
+	"sort"
+)
+
+// CountRange estimate the number of live keys in [start, end), empty end means no upper bound,
+// memory tables are counted exactly, a disk block is counted by the average live keys of its table,
+// fully if its span lies in the range or half if it crosses a bound, a block spans from its first key
+// to the first key of the next block, so the estimate is off by about a block at each bound for tables
+// whose blocks do not overlap, a key in more than one table is counted once for each
+func (t *MEMSSTable) CountRange(start, end string) (uint64, error) {
+	if end != "" && start >= end {
+		return 0, nil
+	}
+	for {
+		t.lock.RLock()
+		tables := groupSparseIndex(t.sparseIndex)
+		memory := make([]CommandData, 0, len(t.immutable)+1)
+		for _, table := range t.immutable {
+			memory = append(memory, table.data)
+		}
+		active := make(CommandData, len(t.activeTable.data))
+		copy(active, t.activeTable.data)
+		memory = append(memory, active)
+		t.lock.RUnlock()
+
+		n, err := countTables(tables, start, end)
+		// a table is removed by a running compaction, take the tables again
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return n + countMemory(memory, start, end), nil
+	}
+}
+
+// countMemory count the keys in the range whose newest command in the memory tables is not a delete
+func countMemory(memory []CommandData, start, end string) uint64 {
+	live := make(map[string]bool)
+	for _, data := range memory {
+		for _, c := range data {
+			if c.Key >= start && (end == "" || c.Key < end) {
+				live[c.Key] = c.Command != CommandTypeDelete
+			}
+		}
+	}
+	var n uint64
+	for _, ok := range live {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// countTables estimate the live keys of disk tables in the range by block granularity
+func countTables(tables []*tableIndex, start, end string) (uint64, error) {
+	var total float64
+	for _, table := range tables {
+		if !table.indexes[0].tableOverlaps(start, end) {
+			continue
+		}
+		metaInfo, _, err := readTableMetaInfo(table.name)
+		if err != nil {
+			return 0, err
+		}
+		// tables before meta info version 4 have no key count, their blocks are assumed full
+		avg := float64(metaInfo.BlockKeyNum)
+		if metaInfo.Version >= 4 {
+			avg = float64(metaInfo.KeyCount-metaInfo.TombstoneCount) / float64(len(table.indexes))
+		}
+
+		keys := make([]string, len(table.indexes))
+		for i, index := range table.indexes {
+			keys[i] = index.Key
+		}
+		sort.Strings(keys)
+		last, lastKnown := table.indexes[0].TableLast, metaInfo.Version >= 3
+		for i, first := range keys {
+			if end != "" && first >= end {
+				break
+			}
+			inside := first >= start
+			switch {
+			case i+1 < len(keys):
+				// the next block starts after this block ends
+				next := keys[i+1]
+				if next <= start {
+					continue
+				}
+				inside = inside && (end == "" || next <= end)
+			case lastKnown:
+				if last < start {
+					continue
+				}
+				inside = inside && (end == "" || last < end)
+			default:
+				inside = inside && end == ""
+			}
+			if inside {
+				total += avg
+			} else {
+				total += avg / 2
+			}
+		}
+	}
+	return uint64(total + 0.5), nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCountRange(t *testing.T) {
+	const blockKeyNum = 10
+	db := openTestDB(t, t.TempDir(), blockKeyNum, 10)
+	defer db.Close()
+	for i := 0; i < 300; i++ {
+		mustSet(t, db, fmt.Sprintf("k%03d", i), "v")
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// memory tables are counted exactly, a deleted key is not live
+	for i := 300; i < 305; i++ {
+		mustSet(t, db, fmt.Sprintf("k%03d", i), "v")
+	}
+	if err := db.Delete("k304"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		start, end string
+		want       int
+	}{
+		{"k000", "k300", 300},
+		{"k050", "k150", 100},
+		{"k095", "k105", 10},
+		{"k123", "k277", 154},
+		{"", "", 304},
+		{"k250", "", 54},
+		{"k300", "k310", 4},
+		{"x", "", 0},
+	} {
+		n, err := db.CountRange(c.start, c.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the disk tables do not overlap, the estimate is off by about a block at each bound
+		if diff := int(n) - c.want; diff < -2*blockKeyNum || diff > 2*blockKeyNum {
+			t.Fatalf("count [%s, %s): %d, want %d within %d", c.start, c.end, n, c.want, 2*blockKeyNum)
+		}
+	}
+	if n, err := db.CountRange("k300", "k310"); err != nil || n != 4 {
+		t.Fatalf("count of memory keys: %d, %v, want exactly 4", n, err)
+	}
+	if n, err := db.CountRange("k2", "k1"); err != nil || n != 0 {
+		t.Fatalf("count of an empty range: %d, %v", n, err)
+	}
+}
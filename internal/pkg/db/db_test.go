@@ -0,0 +1,116 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+var errInjected = errors.New("injected fault")
+
+// openTestDB open a database in a temp dir which is removed after the test
+func openTestDB(t *testing.T, dir string, blockKeyNum, tableBlockNum uint16) *MEMSSTable {
+	t.Helper()
+	db, err := Open(dir, blockKeyNum, tableBlockNum)
+	if err != nil {
+		t.Fatalf("open %s: %v", dir, err)
+	}
+	return db
+}
+
+// crash release the database as a killed process would, memory tables are not flushed and the
+// buffered wal records are written as the os would have them
+func crash(t *testing.T, db *MEMSSTable) {
+	t.Helper()
+	db.StopBackgroundFlush()
+	db.StopBackgroundCompaction()
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if err := db.wal.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.wal.f.Close()
+	if db.vlog != nil {
+		db.vlog.Close()
+	}
+	db.unmapAll()
+	if err := unlockFile(db.fileLock); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tableFiles return the disk table files in dir by name
+func tableFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(dir + "/*.sdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func mustSet(t *testing.T, db *MEMSSTable, key, val string) {
+	t.Helper()
+	if err := db.Set(key, val); err != nil {
+		t.Fatalf("set %s: %v", key, err)
+	}
+}
+
+func expectValue(t *testing.T, db *MEMSSTable, key, want string) {
+	t.Helper()
+	got, err := db.Query(key)
+	if err != nil || got != want {
+		t.Fatalf("query %s: got %q, %v, want %q", key, got, err, want)
+	}
+}
+
+func expectNotFound(t *testing.T, db *MEMSSTable, key string) {
+	t.Helper()
+	if got, err := db.Query(key); err != ErrKeyNotFound {
+		t.Fatalf("query %s: got %q, %v, want ErrKeyNotFound", key, got, err)
+	}
+}
+
+// faultyFile is a wal file whose writes and syncs fail while the errors are set
+type faultyFile struct {
+	walFile
+	writeErr error
+	syncErr  error
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if f.writeErr != nil {
+		return 0, f.writeErr
+	}
+	return f.walFile.Write(p)
+}
+
+func (f *faultyFile) Sync() error {
+	if f.syncErr != nil {
+		return f.syncErr
+	}
+	return f.walFile.Sync()
+}
+
+// injectWALFault wrap the current wal file of the database with a faultyFile
+func injectWALFault(db *MEMSSTable) *faultyFile {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	f := &faultyFile{walFile: db.wal.f}
+	db.wal.f = f
+	return f
+}
+
+// waitFor poll cond until it holds or a few seconds pass
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDedupActiveTable(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 4, 1)
+	db.SetDedupActiveTable(true)
+	for i := 0; i < 1000; i++ {
+		mustSet(t, db, "k", fmt.Sprintf("v%d", i))
+	}
+	db.lock.RLock()
+	immutable, active := len(db.immutable), db.activeTable.Len()
+	db.lock.RUnlock()
+	if immutable != 0 || active != 1 {
+		t.Fatalf("1000 overwrites left %d immutable tables, %d active commands, want 0 and 1", immutable, active)
+	}
+	expectValue(t, db, "k", "v999")
+
+	// distinct keys still switch the table at blockKeyNum
+	for i := 0; i < 4; i++ {
+		mustSet(t, db, fmt.Sprintf("d%d", i), "v")
+	}
+	db.lock.RLock()
+	immutable = len(db.immutable)
+	db.lock.RUnlock()
+	if immutable != 1 {
+		t.Fatalf("%d immutable tables after 5 distinct keys, want 1", immutable)
+	}
+	crash(t, db)
+
+	// the wal keeps every write, the replay ends with the newest value
+	db = openTestDB(t, dir, 4, 1)
+	defer db.Close()
+	expectValue(t, db, "k", "v999")
+	if seq := db.LastSequence(); seq != 1004 {
+		t.Fatalf("last sequence %d, want 1004", seq)
+	}
+}
+
+func TestNoDedupActiveTable(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 4, 1)
+	defer db.Close()
+	for i := 0; i < 10; i++ {
+		mustSet(t, db, "k", fmt.Sprintf("v%d", i))
+	}
+	// without dedup every version counts toward the switch
+	db.lock.RLock()
+	immutable := len(db.immutable)
+	db.lock.RUnlock()
+	if immutable != 2 {
+		t.Fatalf("%d immutable tables after 10 versions, want 2", immutable)
+	}
+	expectValue(t, db, "k", "v9")
+}
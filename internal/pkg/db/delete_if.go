@@ -0,0 +1,38 @@
+package db
+
+// DeleteIf delete the key only if its current value equals expected, the check and the delete are in
+// one write lock, deleted is false without error if the value differs or the key is missing
+func (t *MEMSSTable) DeleteIf(key, expected string) (bool, error) {
+	if err := checkRootKeys(key); err != nil {
+		return false, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	// wait before the read, the lock is not released between the check and the delete
+	if err := t.waitWriteStall(); err != nil {
+		return false, err
+	}
+
+	v, err := t.getLocked(key)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if v.Command == CommandTypeDelete {
+		return false, nil
+	}
+	val, err := t.value(v)
+	if err != nil {
+		return false, err
+	}
+	if val != expected {
+		return false, nil
+	}
+
+	if err := t.commandLocked(&Command{Key: key, Command: CommandTypeDelete}, false); err != nil {
+		return false, err
+	}
+	return true, nil
+}
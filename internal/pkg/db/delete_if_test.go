@@ -0,0 +1,39 @@
+package db
+
+import "testing"
+
+func TestDeleteIf(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	mustSet(t, db, "k", "v")
+	mustSet(t, db, "other", "v")
+
+	expectDeleted := func(key, expected string, want bool) {
+		t.Helper()
+		deleted, err := db.DeleteIf(key, expected)
+		if err != nil || deleted != want {
+			t.Fatalf("delete %s if %q: %v, %v, want %v", key, expected, deleted, err, want)
+		}
+	}
+	expectDeleted("k", "w", false)
+	expectValue(t, db, "k", "v")
+	expectDeleted("missing", "", false)
+	expectNotFound(t, db, "missing")
+	expectDeleted("k", "v", true)
+	expectNotFound(t, db, "k")
+	// a deleted key does not match even an empty expected value
+	expectDeleted("k", "", false)
+
+	// the current value is checked when it is on disk too
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectDeleted("other", "w", false)
+	expectDeleted("other", "v", true)
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectNotFound(t, db, "k")
+	expectNotFound(t, db, "other")
+}
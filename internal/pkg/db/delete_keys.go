@@ -0,0 +1,40 @@
+package db
+
+// DeleteKeys delete the keys in one batch and return how many of them were live, the check and the
+// delete are in one write lock, a missing, deleted or repeated key is not counted and not written
+func (t *MEMSSTable) DeleteKeys(keys []string) (int, error) {
+	if err := checkRootKeys(keys...); err != nil {
+		return 0, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.waitWriteStall(); err != nil {
+		return 0, err
+	}
+
+	b := NewBatch()
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		v, err := t.getLocked(key)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if v.Command != CommandTypeDelete {
+			b.Delete(key)
+		}
+	}
+	if b.Len() == 0 {
+		return 0, nil
+	}
+	if err := t.writeLocked(b); err != nil {
+		return 0, err
+	}
+	return b.Len(), nil
+}
@@ -0,0 +1,38 @@
+package db
+
+import "testing"
+
+func TestDeleteKeys(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	for _, key := range []string{"a", "b", "c", "gone"} {
+		mustSet(t, db, key, key)
+	}
+	// a is on disk, the others in memory
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("gone"); err != nil {
+		t.Fatal(err)
+	}
+	seq := db.LastSequence()
+	n, err := db.DeleteKeys([]string{"a", "b", "a", "missing", "gone"})
+	if err != nil || n != 2 {
+		t.Fatalf("delete keys: %d, %v, want 2 live keys deleted", n, err)
+	}
+	expectNotFound(t, db, "a")
+	expectNotFound(t, db, "b")
+	expectValue(t, db, "c", "c")
+	if db.LastSequence() != seq+2 {
+		t.Fatalf("sequence %d, want %d after two deletes", db.LastSequence(), seq+2)
+	}
+	if n, err := db.DeleteKeys([]string{"a", "missing"}); err != nil || n != 0 {
+		t.Fatalf("delete keys already gone: %d, %v", n, err)
+	}
+	if n, err := db.DeleteKeys(nil); err != nil || n != 0 {
+		t.Fatalf("delete no key: %d, %v", n, err)
+	}
+	if db.LastSequence() != seq+2 {
+		t.Fatalf("sequence %d, want nothing written without a live key", db.LastSequence())
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package db
+
+import "os"
+
+// lockFile only create the file, file lock is not supported on this platform
+func lockFile(filename string) (*os.File, error) {
+	return os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+func unlockFile(f *os.File) error {
+	return f.Close()
+}
@@ -0,0 +1,59 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package db
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOpenLocked(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	if _, err := Open(dir, 2, 1); err != ErrDatabaseLocked {
+		t.Fatalf("second open: %v, want ErrDatabaseLocked", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the lock is released by Close
+	db = openTestDB(t, dir, 2, 1)
+	db.Close()
+}
+
+func TestImportDoesNotOpen(t *testing.T) {
+	if DB != nil {
+		t.Fatal("DB is opened by the package")
+	}
+	if _, err := os.Stat("./data"); !os.IsNotExist(err) {
+		t.Fatalf("./data is created by the package: %v", err)
+	}
+}
+
+func TestOpenAfterFailedOpen(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	if err := db.SetMaxKeySize(DefaultMaxKeySize * 2); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, strings.Repeat("k", DefaultMaxKeySize+10), "v")
+	filename := db.wal.filename
+	crash(t, db)
+
+	// the replay fails on the long key each time, not on the lock the first open held
+	for i := 0; i < 2; i++ {
+		if _, err := Open(dir, 2, 1); !errors.Is(err, ErrKeyTooLarge) {
+			t.Fatalf("open %d replaying a long key: %v, want ErrKeyTooLarge", i, err)
+		}
+	}
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	mustSet(t, db, "a", "1")
+	expectValue(t, db, "a", "1")
+}
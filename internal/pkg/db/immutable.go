@@ -0,0 +1,36 @@
+package db
+
+import "fmt"
+
+// immutable tables are ordered oldest first: a switched table is appended at the tail, flush writes
+// and removes tables from the head, and query reads from the tail so the newest command wins
+
+// pushImmutable append the table as the newest immutable table, caller must hold the lock
+func (t *MEMSSTable) pushImmutable(table *SSTable) {
+	if n := len(t.immutable); n > 0 && t.immutable[n-1].seq > table.seq {
+		panic(fmt.Sprintf("immutable table of seq %d pushed after seq %d", table.seq, t.immutable[n-1].seq))
+	}
+	t.immutable = append(t.immutable, table)
+}
+
+// oldestImmutables return at most n immutable tables from the oldest, in the order flush writes them
+func (t *MEMSSTable) oldestImmutables(n int) []*SSTable {
+	if n > len(t.immutable) {
+		n = len(t.immutable)
+	}
+	return t.immutable[:n]
+}
+
+// popImmutables remove the flushed tables, which must be the oldest immutable tables in order,
+// caller must hold the lock
+func (t *MEMSSTable) popImmutables(tables []*SSTable) {
+	if len(tables) > len(t.immutable) {
+		panic(fmt.Sprintf("pop %d immutable tables of %d", len(tables), len(t.immutable)))
+	}
+	for i, table := range tables {
+		if t.immutable[i] != table {
+			panic(fmt.Sprintf("flushed table %d is not the immutable table %d from the oldest", i, i))
+		}
+	}
+	t.immutable = t.immutable[len(tables):]
+}
@@ -0,0 +1,83 @@
+package db
+
+import "testing"
+
+// expectPanic fail unless f panics
+func expectPanic(t *testing.T, what string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("%s did not panic", what)
+		}
+	}()
+	f()
+}
+
+func TestFlushOldestImmutableFirst(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		mustSet(t, db, key, key)
+	}
+	db.lock.RLock()
+	immutable := len(db.immutable)
+	db.lock.RUnlock()
+	if immutable != 2 {
+		t.Fatalf("%d immutable tables, want 2", immutable)
+	}
+
+	// each flush writes the oldest immutable table, to a file of a higher id than the one before
+	var lastID uint64
+	for i, first := range []string{"a", "c"} {
+		if _, err := db.FlushOne(); err != nil {
+			t.Fatal(err)
+		}
+		files := tableFiles(t, dir)
+		if len(files) != i+1 {
+			t.Fatalf("%d tables after %d flushes", len(files), i+1)
+		}
+		var newest string
+		var newestID uint64
+		for _, name := range files {
+			if id, ok := tableID(name); ok && id >= newestID {
+				newest, newestID = name, id
+			}
+		}
+		if i > 0 && newestID <= lastID {
+			t.Fatalf("flush %d wrote id %d, not after %d", i+1, newestID, lastID)
+		}
+		lastID = newestID
+		metaInfo, _, err := readTableMetaInfo(newest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metaInfo.FirstKey != first {
+			t.Fatalf("flush %d wrote the table from %s, want the oldest from %s", i+1, metaInfo.FirstKey, first)
+		}
+	}
+}
+
+func TestImmutableOrderAsserts(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	older, newer := NewSSTable(), NewSSTable()
+	older.seq, newer.seq = 1, 2
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.pushImmutable(newer)
+	expectPanic(t, "an older table pushed after a newer one", func() {
+		db.pushImmutable(older)
+	})
+	expectPanic(t, "popping a table which is not the oldest", func() {
+		db.popImmutables([]*SSTable{older})
+	})
+	expectPanic(t, "popping more tables than there are", func() {
+		db.popImmutables([]*SSTable{newer, older})
+	})
+	db.popImmutables(db.oldestImmutables(5))
+	if len(db.immutable) != 0 {
+		t.Fatalf("%d immutable tables left", len(db.immutable))
+	}
+}
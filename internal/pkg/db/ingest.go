@@ -0,0 +1,95 @@
+package db
+
+import (
+	"fmt"
+	"math"
+)
+
+// IngestPrecedence decide which version of a key held by both databases is kept by Ingest
+type IngestPrecedence int
+
+const (
+	IngestOverwrite     IngestPrecedence = iota // the other database wins
+	IngestKeepExisting                          // a live key of this database is kept, a deleted one is replaced
+	IngestNewerSequence                         // the larger sequence number wins, a tie keeps this database
+)
+
+// Ingest write the live keys of the database in otherRoot into this one, a key in both databases is
+// resolved by precedence, the sequence numbers of two databases are counted apart, so IngestNewerSequence
+// is only meaningful for databases written in step, the other database must not be open, it is opened
+// and closed by Ingest so its wal is replayed and flushed, keys are read in order block by block and
+// written in batches of blockKeyNum keys, an error leaves the batches written before it
+func (t *MEMSSTable) Ingest(otherRoot string, precedence IngestPrecedence) error {
+	if precedence < IngestOverwrite || precedence > IngestNewerSequence {
+		return fmt.Errorf("invalid ingest precedence: %d", precedence)
+	}
+	t.lock.RLock()
+	blockKeyNum, tableBlockNum := t.blockKeyNum, t.tableBlockNum
+	t.lock.RUnlock()
+	other, err := Open(otherRoot, blockKeyNum, tableBlockNum)
+	if err != nil {
+		return fmt.Errorf("ingest %s: %w", otherRoot, err)
+	}
+	// values separated by the other database are read from its value log
+	if segments, err := valueLogSegments(otherRoot); err == nil && len(segments) > 0 {
+		if err := other.EnableValueLog(math.MaxInt32); err != nil {
+			other.Close()
+			return err
+		}
+	}
+
+	err = t.ingest(other, precedence, int(blockKeyNum))
+	if cerr := other.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ingest copy the live keys of other in batches of n keys
+func (t *MEMSSTable) ingest(other *MEMSSTable, precedence IngestPrecedence, n int) error {
+	it := other.Range("", "").(*mergeIterator)
+	defer it.Close()
+	cmds := make([]*Command, 0, n)
+	for {
+		more := it.Next()
+		if more {
+			cmds = append(cmds, &Command{Key: it.Key(), Value: it.Value(), Command: CommandTypeSet, seq: it.current.seq})
+		}
+		if len(cmds) == n || !more && len(cmds) > 0 {
+			if err := t.ingestBatch(cmds, precedence); err != nil {
+				return err
+			}
+			cmds = cmds[:0]
+		}
+		if !more {
+			return it.Err()
+		}
+	}
+}
+
+// ingestBatch write the commands which win over the existing versions in one batch
+func (t *MEMSSTable) ingestBatch(cmds []*Command, precedence IngestPrecedence) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.waitWriteStall(); err != nil {
+		return err
+	}
+	b := NewBatch()
+	for _, c := range cmds {
+		if precedence != IngestOverwrite {
+			v, err := t.getLocked(c.Key)
+			if err != nil && err != ErrKeyNotFound {
+				return err
+			}
+			if err == nil && (precedence == IngestKeepExisting && v.Command != CommandTypeDelete ||
+				precedence == IngestNewerSequence && v.seq >= c.seq) {
+				continue
+			}
+		}
+		b.Set(c.Key, c.Value)
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	return t.writeLocked(b)
+}
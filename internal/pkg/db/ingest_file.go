@@ -0,0 +1,189 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidTableFile = errors.New("invalid table file")
+
+// IngestFile add the sorted disk table at path as the newest table of the database without the memory
+// tables and the wal, the file is checked like VerifyIntegrity and must be of the current meta info version,
+// its commands must carry no sequence number nor value pointer, as written outside a database, the memory
+// tables are flushed first so commands written before are older, the blocks and sparse index are copied
+// and a new meta info gives the table the sequence number of the disk tables, reads as of an older
+// sequence number fail with ErrSequenceTooOld after it, path is not modified,
+// keys overlapping the database follow newest wins, a key of the table replaces the key in the disk tables
+// and a key written while the file is ingested stays newer than the table, the live keys of the quota count it
+func (t *MEMSSTable) IngestFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if _, problems := verifyTable(data); len(problems) > 0 {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidTableFile, filename, strings.Join(problems, "; "))
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	metaInfo, sparseIndex, err := readSparseIndex(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if metaInfo.Version != metaInfoVersion {
+		return fmt.Errorf("%w: %s: meta info version %d, expect %d", ErrInvalidTableFile, filename, metaInfo.Version, metaInfoVersion)
+	}
+	if len(sparseIndex) == 0 {
+		return fmt.Errorf("%w: %s: no block", ErrInvalidTableFile, filename)
+	}
+	cmds, err := checkIngestBlocks(data[:metaInfo.DataLength])
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidTableFile, filename, err)
+	}
+
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	// tables are not added during a checkpoint or an integrity check
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+	t.lock.Lock()
+	id := t.id
+	t.id++
+	// every command in memory is after the disk tables, so a wal replay never skips one for this table
+	seq := t.diskSeq
+	t.lock.Unlock()
+
+	name := fmt.Sprintf("%s/%d.sdb", t.rootPath, id)
+	newMetaInfo := *metaInfo
+	newMetaInfo.Seq = id
+	newMetaInfo.MinSeq = seq
+	newMetaInfo.MaxSeq = seq
+	newMetaInfo.DroppedSeq = seq
+	newMetaInfo.IndexLength = 0
+	indexes := make([]SparseIndex, len(sparseIndex))
+	for i := range sparseIndex {
+		indexes[i] = *sparseIndex[i]
+	}
+	if err := copyTableFile(name, data[:metaInfo.DataLength], indexes, &newMetaInfo); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delta, err := t.ingestKeysDelta(cmds)
+	if err != nil {
+		return err
+	}
+	for i := range indexes {
+		t.sparseIndex = append(t.sparseIndex, &indexes[i])
+	}
+	sort.SliceStable(t.sparseIndex, func(i, j int) bool {
+		return t.sparseIndex[i].TableSeq < t.sparseIndex[j].TableSeq
+	})
+	if seq > t.droppedSeq {
+		t.droppedSeq = seq
+	}
+	// cached values and deleted keys may be replaced by the table
+	if t.valueCache != nil {
+		t.valueCache = newValueCache(t.valueCache.size)
+	}
+	t.recentDeletes.reset()
+	t.quota.base += int64(newMetaInfo.fileSize())
+	t.quota.keys += delta
+	return nil
+}
+
+// ingestKeysDelta return the change of live keys after the commands of a table newer than the disk tables
+// are added, a key in the memory tables is newer and not changed, only counted with MaxKeys, caller must hold the lock
+func (t *MEMSSTable) ingestKeysDelta(cmds []*Command) (int64, error) {
+	if t.quota.limit.MaxKeys == 0 {
+		return 0, nil
+	}
+	var delta int64
+	for _, c := range cmds {
+		if t.memoryAtLocked(c.Key, math.MaxUint64) != nil {
+			continue
+		}
+		v, err := t.getLocked(c.Key)
+		if err != nil && err != ErrKeyNotFound {
+			return 0, err
+		}
+		before := err == nil && v.Command != CommandTypeDelete
+		if isSet := c.Command != CommandTypeDelete; isSet && !before {
+			delta++
+		} else if !isSet && before {
+			delta--
+		}
+	}
+	return delta, nil
+}
+
+// checkIngestBlocks check the commands of the blocks in data carry no sequence number nor value pointer,
+// and return the commands
+func checkIngestBlocks(data []byte) ([]*Command, error) {
+	var cmds []*Command
+	for pos := 0; pos < len(data); {
+		n := binary.LittleEndian.Uint32(data[pos:])
+		l := int(n &^ blockFlags)
+		block, err := decodeBlock(data[pos+4:pos+4+l], n&blockRawFlag != 0, n&blockPrefixFlag != 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range block.data {
+			if c.seq != 0 {
+				return nil, fmt.Errorf("key %q has sequence number %d of another database", c.Key, c.seq)
+			}
+			if c.Command == CommandTypeValuePointer {
+				return nil, fmt.Errorf("key %q points into the value log of another database", c.Key)
+			}
+		}
+		cmds = append(cmds, block.data...)
+		pos += 4 + l
+	}
+	return cmds, nil
+}
+
+// copyTableFile write the data of blocks and a new sparse index and meta info into a disk sstable file,
+// through a temp file as writeTableFile, the sparse index is given the file name and meta info
+func copyTableFile(filename string, data []byte, sparseIndex []SparseIndex, metaInfo *SSTableMetaInfo) error {
+	tmpName := filename + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = writeSparseIndexAndMetaInfo(f, sparseIndex, metaInfo)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, filename)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := syncDir(path.Dir(filename)); err != nil {
+		return err
+	}
+	for i := range sparseIndex {
+		sparseIndex[i].TableName = filename
+		sparseIndex[i].TableSeq = metaInfo.Seq
+		sparseIndex[i].setTableRange(metaInfo)
+	}
+	return nil
+}
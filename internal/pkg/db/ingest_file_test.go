@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeExternalTable write a table of the sorted keys outside a database, n keys a block, each key is its value
+func writeExternalTable(t *testing.T, filename string, n int, keys ...string) {
+	t.Helper()
+	var blocks []*SSTable
+	for i, key := range keys {
+		if i%n == 0 {
+			blocks = append(blocks, NewSSTable())
+		}
+		blocks[len(blocks)-1].Append(&Command{Key: key, Value: key, Command: CommandTypeSet})
+	}
+	metaInfo := &SSTableMetaInfo{Version: metaInfoVersion, BlockKeyNum: uint16(n), TableBlockNum: uint16(len(blocks))}
+	if _, _, err := writeTableFile(filename, blocks, metaInfo, CodecConfig{}, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIngestFile(t *testing.T) {
+	dir := t.TempDir()
+	external := filepath.Join(t.TempDir(), "bulk.sdb")
+	writeExternalTable(t, external, 2, "a", "c", "e", "g")
+	source, err := os.ReadFile(external)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := openTestDB(t, dir, 2, 1)
+	mustSet(t, db, "c", "old")
+	mustSet(t, db, "z", "memory")
+	seq := db.LastSequence()
+	if err := db.IngestFile(external); err != nil {
+		t.Fatal(err)
+	}
+	// the table is newer than the writes before it and older than the writes after it
+	for _, key := range []string{"a", "c", "e", "g"} {
+		expectValue(t, db, key, key)
+	}
+	expectValue(t, db, "z", "memory")
+	mustSet(t, db, "e", "new")
+	expectValue(t, db, "e", "new")
+	// the table takes the sequence number of the last command flushed before it
+	if _, err := db.QueryAt("c", seq-1); !isSequenceTooOld(err) {
+		t.Fatalf("read as of a sequence before the ingest: %v, want ErrSequenceTooOld", err)
+	}
+	if data, err := os.ReadFile(external); err != nil || string(data) != string(source) {
+		t.Fatalf("the ingested file is modified: %v", err)
+	}
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	expectValue(t, db, "a", "a")
+	expectValue(t, db, "c", "c")
+	expectValue(t, db, "e", "new")
+	expectValue(t, db, "z", "memory")
+
+	// a table of another database and a torn file are refused
+	otherDir := t.TempDir()
+	other := openTestDB(t, otherDir, 2, 1)
+	mustSet(t, other, "b", "other")
+	if err := other.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+	torn := filepath.Join(t.TempDir(), "torn.sdb")
+	if err := os.WriteFile(torn, source[:len(source)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	tables := len(tableFiles(t, dir))
+	for _, name := range []string{tableFiles(t, otherDir)[0], torn} {
+		if err := db.IngestFile(name); !errors.Is(err, ErrInvalidTableFile) {
+			t.Fatalf("ingest of %s: %v, want ErrInvalidTableFile", name, err)
+		}
+	}
+	if n := len(tableFiles(t, dir)); n != tables {
+		t.Fatalf("%d tables after refused ingests, want %d", n, tables)
+	}
+	expectNotFound(t, db, "b")
+	db.Close()
+}
+
+func TestIngestFileOverlap(t *testing.T) {
+	external := filepath.Join(t.TempDir(), "bulk.sdb")
+	block := NewSSTable()
+	block.Append(&Command{Key: "a", Value: "a", Command: CommandTypeSet})
+	block.Append(&Command{Key: "b", Command: CommandTypeDelete})
+	block.Append(&Command{Key: "c", Value: "c", Command: CommandTypeSet})
+	block.Append(&Command{Key: "d", Value: "d", Command: CommandTypeSet})
+	metaInfo := &SSTableMetaInfo{Version: metaInfoVersion, BlockKeyNum: 4, TableBlockNum: 1}
+	if _, _, err := writeTableFile(external, []*SSTable{block}, metaInfo, CodecConfig{}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	mustSet(t, db, "a", "old")
+	mustSet(t, db, "b", "old")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetQuota(Quota{MaxKeys: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.IngestFile(external); err != nil {
+		t.Fatal(err)
+	}
+	// the newest command wins, a set replaces the flushed key, a delete removes it and a set revives a deleted key
+	expectValue(t, db, "a", "a")
+	expectNotFound(t, db, "b")
+	expectValue(t, db, "c", "c")
+	expectValue(t, db, "d", "d")
+	// a, c and d are live, so one more key fits the quota and a second does not
+	mustSet(t, db, "e", "e")
+	if err := db.Set("f", "f"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("set over the key quota after an ingest: %v, want ErrQuotaExceeded", err)
+	}
+}
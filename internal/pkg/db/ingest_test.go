@@ -0,0 +1,64 @@
+package db
+
+import "testing"
+
+func TestIngest(t *testing.T) {
+	// write the keys in order, a deleted key is written then deleted
+	write := func(db *MEMSSTable, val string, keys ...string) {
+		t.Helper()
+		for _, key := range keys {
+			if key[0] == '-' {
+				if err := db.Delete(key[1:]); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			mustSet(t, db, key, val)
+		}
+	}
+	for _, c := range []struct {
+		precedence IngestPrecedence
+		want       map[string]string
+	}{
+		{IngestOverwrite, map[string]string{"a": "other", "b": "other", "c": "other", "e": "this", "x": "other"}},
+		{IngestKeepExisting, map[string]string{"a": "this", "b": "this", "c": "other", "e": "this", "x": "other"}},
+		// a is newer in the other database, b and the tombstone of c in this one
+		{IngestNewerSequence, map[string]string{"a": "other", "b": "this", "e": "this", "x": "other"}},
+	} {
+		otherDir := t.TempDir()
+		other := openTestDB(t, otherDir, 2, 1)
+		write(other, "other", "b", "a", "c")
+		// part of the other database is on disk, the rest is replayed from its wal
+		if err := other.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		write(other, "other", "y", "-y", "x")
+		crash(t, other)
+
+		db := openTestDB(t, t.TempDir(), 2, 1)
+		write(db, "this", "a", "b", "c", "-c", "e")
+		if err := db.Ingest(otherDir, c.precedence); err != nil {
+			t.Fatalf("precedence %d: %v", c.precedence, err)
+		}
+		for _, key := range []string{"a", "b", "c", "e", "x", "y"} {
+			if want, ok := c.want[key]; ok {
+				expectValue(t, db, key, want)
+			} else {
+				expectNotFound(t, db, key)
+			}
+		}
+		if kvs := collect(t, db.Range("", "")); len(kvs) != len(c.want) {
+			t.Fatalf("precedence %d: %d live keys, want %d", c.precedence, len(kvs), len(c.want))
+		}
+		if err := db.Ingest(otherDir, IngestNewerSequence+1); err == nil {
+			t.Fatal("an invalid precedence is taken")
+		}
+		db.Close()
+
+		// the other database is left as it was
+		other = openTestDB(t, otherDir, 2, 1)
+		expectValue(t, other, "x", "other")
+		expectNotFound(t, other, "e")
+		other.Close()
+	}
+}
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Iterator walk keys in order, the newest version of each key is returned
+type Iterator interface {
+	Next() bool
+	Seek(key string) // move forward, the next call of Next returns the first key not less than key
+	Key() string
+	Value() string
+	Deleted() bool // the key is deleted, only returned with IncludeTombstones
+	Err() error
+	Close() error // release the disk tables the iterator reads, a compaction removes them after it
+}
+
+type RangeOptions struct {
+	IncludeTombstones bool   // return deleted keys, Deleted reports them
+	Prefix            string // only keys with the prefix, disk tables excluded by the prefix filter are skipped
+	MemoryOnly        bool   // only the active and immutable tables, disk tables are not read
+}
+
+// Range return an iterator of live keys in [start, end), empty end means no upper bound
+func (t *MEMSSTable) Range(start, end string) Iterator {
+	return t.RangeWithOptions(start, end, RangeOptions{})
+}
+
+// PrefixScan return an iterator of live keys with the prefix
+func (t *MEMSSTable) PrefixScan(prefix string) Iterator {
+	return t.RangeWithOptions("", "", RangeOptions{Prefix: prefix})
+}
+
+// RangeMemory return an iterator of live keys in [start, end) of memory tables only, keys flushed
+// to disk are not returned even if they are live
+func (t *MEMSSTable) RangeMemory(start, end string) Iterator {
+	return t.RangeWithOptions(start, end, RangeOptions{MemoryOnly: true})
+}
+
+// RangeWithOptions return an iterator of keys in [start, end) with options
+func (t *MEMSSTable) RangeWithOptions(start, end string, opts RangeOptions) Iterator {
+	if opts.Prefix != "" {
+		if start < opts.Prefix {
+			start = opts.Prefix
+		}
+		if pe := prefixEnd(opts.Prefix); pe != "" && (end == "" || pe < end) {
+			end = pe
+		}
+	}
+	it := &mergeIterator{db: t, start: start, end: end, opts: opts}
+	priority := 0
+
+	t.lock.RLock()
+	sparseIndex := t.sparseIndex
+	if opts.MemoryOnly {
+		sparseIndex = nil
+	}
+	if opts.Prefix != "" {
+		indexes := make([]*SparseIndex, 0, len(sparseIndex))
+		for _, index := range sparseIndex {
+			if t.tableMayContainPrefix(index.TableName, opts.Prefix) {
+				indexes = append(indexes, index)
+			}
+		}
+		sparseIndex = indexes
+	}
+	// a compaction keeps the tables on disk until the iterator is closed
+	it.pinned = t.pinTables(sparseIndex)
+	immutable := make([]*SSTable, len(t.immutable))
+	copy(immutable, t.immutable)
+	active := make(CommandData, len(t.activeTable.data))
+	copy(active, t.activeTable.data)
+	t.lock.RUnlock()
+
+	// from oldest to newest, newer source has bigger priority
+	for _, index := range sparseIndex {
+		if (end != "" && index.Key >= end) || !index.tableOverlaps(start, end) {
+			continue
+		}
+		index := index
+		priority++
+		it.add(&rangeSource{
+			priority: priority,
+			lowKey:   index.Key,
+			load: func() ([]*Command, error) {
+				disk, err := NewDiskSSTable(index.TableName)
+				if err != nil {
+					return nil, err
+				}
+				if err := disk.LoadBlock(index.BlockIndex, index.DataStart); err != nil {
+					return nil, err
+				}
+				return disk.Blocks[index.BlockIndex].data, nil
+			},
+		})
+	}
+	for _, table := range immutable {
+		priority++
+		it.add(&rangeSource{priority: priority, data: lastVersions(table.data)})
+	}
+	sort.Stable(active)
+	priority++
+	it.add(&rangeSource{priority: priority, data: lastVersions(active)})
+	heap.Init(&it.sources)
+	return it
+}
+
+// lastVersions return the last command of each key from sorted commands
+func lastVersions(data []*Command) []*Command {
+	res := make([]*Command, 0, len(data))
+	for i := range data {
+		if i+1 < len(data) && data[i+1].Key == data[i].Key {
+			continue
+		}
+		res = append(res, data[i])
+	}
+	return res
+}
+
+// rangeSource is a sorted command list of one table or block
+type rangeSource struct {
+	data     []*Command
+	pos      int
+	priority int
+	lowKey   string                     // no key of the source is less than it before loaded
+	load     func() ([]*Command, error) // load data of a disk block, nil after loaded
+}
+
+func (s *rangeSource) key() string {
+	if s.load != nil {
+		return s.lowKey
+	}
+	return s.data[s.pos].Key
+}
+
+func (s *rangeSource) valid() bool {
+	return s.load != nil || s.pos < len(s.data)
+}
+
+// seek move to the first key not less than key, or greater than key if exclusive
+func (s *rangeSource) seek(key string, exclusive bool) error {
+	if s.load != nil {
+		data, err := s.load()
+		if err != nil {
+			return err
+		}
+		s.data = lastVersions(data)
+		s.load = nil
+	}
+	s.pos += sort.Search(len(s.data)-s.pos, func(i int) bool {
+		if exclusive {
+			return s.data[s.pos+i].Key > key
+		}
+		return s.data[s.pos+i].Key >= key
+	})
+	return nil
+}
+
+type sourceHeap []*rangeSource
+
+func (h sourceHeap) Len() int { return len(h) }
+
+func (h sourceHeap) Less(i, j int) bool {
+	if ki, kj := h[i].key(), h[j].key(); ki != kj {
+		return ki < kj
+	}
+	return h[i].priority > h[j].priority
+}
+
+func (h sourceHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *sourceHeap) Push(x interface{}) { *h = append(*h, x.(*rangeSource)) }
+
+func (h *sourceHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeIterator merge sources in key order, the source with bigger priority wins on the same key
+type mergeIterator struct {
+	db      *MEMSSTable
+	start   string
+	end     string
+	opts    RangeOptions
+	sources sourceHeap
+	current *Command
+	value   string
+	err     error
+	pinned  []string // disk tables kept for the iterator until Close
+}
+
+func (it *mergeIterator) add(s *rangeSource) {
+	if s.load == nil {
+		s.seek(it.start, false)
+	}
+	if s.valid() {
+		it.sources = append(it.sources, s)
+	}
+}
+
+// fix restore the heap after the top source moved
+func (it *mergeIterator) fix() {
+	if it.sources[0].valid() {
+		heap.Fix(&it.sources, 0)
+	} else {
+		heap.Pop(&it.sources)
+	}
+}
+
+func (it *mergeIterator) Next() bool {
+	it.current = nil
+	it.value = ""
+	for it.err == nil && len(it.sources) > 0 {
+		top := it.sources[0]
+		if top.load != nil {
+			if it.err = top.seek(it.start, false); it.err != nil {
+				return false
+			}
+			it.fix()
+			continue
+		}
+
+		c := top.data[top.pos]
+		if it.end != "" && c.Key >= it.end {
+			it.sources = it.sources[:0]
+			return false
+		}
+		// older versions of the key are skipped
+		for len(it.sources) > 0 && it.sources[0].key() == c.Key {
+			if it.err = it.sources[0].seek(c.Key, true); it.err != nil {
+				return false
+			}
+			it.fix()
+		}
+		if c.Command == CommandTypeDelete && !it.opts.IncludeTombstones {
+			continue
+		}
+		if c.Command != CommandTypeDelete {
+			if it.value, it.err = it.db.value(c); it.err != nil {
+				return false
+			}
+		}
+		it.current = c
+		return true
+	}
+	return false
+}
+
+// Seek reposition every source to key, seeking backward is not supported and does nothing
+func (it *mergeIterator) Seek(key string) {
+	if key <= it.start || (it.current != nil && key <= it.current.Key) {
+		return
+	}
+	it.start = key
+	it.current = nil
+	it.value = ""
+	sources := it.sources[:0]
+	for _, s := range it.sources {
+		// a disk block not loaded yet seeks to start when it is loaded
+		if s.load == nil {
+			s.seek(key, false)
+		}
+		if s.valid() {
+			sources = append(sources, s)
+		}
+	}
+	it.sources = sources
+	heap.Init(&it.sources)
+}
+
+func (it *mergeIterator) Key() string {
+	if it.current == nil {
+		return ""
+	}
+	return it.current.Key
+}
+
+func (it *mergeIterator) Value() string {
+	return it.value
+}
+
+func (it *mergeIterator) Deleted() bool {
+	return it.current != nil && it.current.Command == CommandTypeDelete
+}
+
+func (it *mergeIterator) Err() error {
+	return it.err
+}
+
+func (it *mergeIterator) Close() error {
+	it.sources = nil
+	it.current = nil
+	pinned := it.pinned
+	it.pinned = nil
+	return it.db.unpinTables(pinned)
+}
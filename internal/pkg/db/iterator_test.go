@@ -0,0 +1,191 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// collect drain the iterator into key=value entries, a deleted key is key!
+func collect(t *testing.T, it Iterator) []string {
+	t.Helper()
+	defer it.Close()
+	entries := make([]string, 0)
+	for it.Next() {
+		if it.Deleted() {
+			entries = append(entries, it.Key()+"!")
+			continue
+		}
+		entries = append(entries, it.Key()+"="+it.Value())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func expectEntries(t *testing.T, it Iterator, want []string) {
+	t.Helper()
+	if got := collect(t, it); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRangeIncludeTombstones(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		mustSet(t, db, key, key)
+	}
+	// b is deleted on disk, d in memory, c is deleted and set again
+	if err := db.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "c", "c2")
+	if err := db.Delete("d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("never"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectEntries(t, db.Range("", ""), []string{"a=a", "c=c2"})
+	expectEntries(t, db.RangeWithOptions("", "", RangeOptions{IncludeTombstones: true}),
+		[]string{"a=a", "b!", "c=c2", "d!", "never!"})
+	expectEntries(t, db.RangeWithOptions("b", "d", RangeOptions{IncludeTombstones: true}),
+		[]string{"b!", "c=c2"})
+}
+
+func TestIteratorSeek(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 2)
+	defer db.Close()
+	for i := 0; i < 20; i++ {
+		mustSet(t, db, fmt.Sprintf("k%02d", i), "disk")
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// k12 is overwritten in an immutable table, k13 deleted in the active one
+	mustSet(t, db, "k12", "immutable")
+	db.RotateMemtable()
+	if err := db.Delete("k13"); err != nil {
+		t.Fatal(err)
+	}
+
+	it := db.Range("", "k16")
+	for i := 0; i < 3; i++ {
+		if !it.Next() {
+			t.Fatal(it.Err())
+		}
+	}
+	if it.Key() != "k02" {
+		t.Fatalf("at %s, want k02", it.Key())
+	}
+	it.Seek("k10")
+	// seeking backward does nothing
+	it.Seek("k05")
+	expectEntries(t, it, []string{"k10=disk", "k11=disk", "k12=immutable", "k14=disk", "k15=disk"})
+
+	it = db.Range("", "")
+	it.Seek("k185")
+	expectEntries(t, it, []string{"k19=disk"})
+	it = db.Range("", "")
+	it.Seek("z")
+	expectEntries(t, it, []string{})
+}
+
+func TestRangeMemory(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	mustSet(t, db, "disk", "d")
+	mustSet(t, db, "both", "old")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// both is shadowed by the active table, gone by the immutable one
+	mustSet(t, db, "c", "c1")
+	mustSet(t, db, "gone", "g")
+	mustSet(t, db, "c", "c2")
+	db.RotateMemtable()
+	mustSet(t, db, "both", "new")
+	if err := db.Delete("gone"); err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, db.RangeMemory("", ""), []string{"both=new", "c=c2"})
+	expectEntries(t, db.RangeMemory("c", "z"), []string{"c=c2"})
+	expectEntries(t, db.RangeWithOptions("", "", RangeOptions{MemoryOnly: true, IncludeTombstones: true}),
+		[]string{"both=new", "c=c2", "gone!"})
+	expectEntries(t, db.Range("", ""), []string{"both=new", "c=c2", "disk=d"})
+}
+
+func TestRangeAcrossCompaction(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	for _, pair := range [][2]string{{"a", "b"}, {"c", "d"}, {"a", "e"}} {
+		mustSet(t, db, pair[0], pair[1])
+		mustSet(t, db, pair[1], pair[0])
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := tableFiles(t, dir)
+	it := db.Range("", "")
+	if !it.Next() || it.Key() != "a" {
+		t.Fatalf("first key %q, %v", it.Key(), it.Err())
+	}
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	// the merged tables are read until the iterator is closed, scans after the compaction read the new one
+	keys, err := db.Keys()
+	if err != nil || fmt.Sprint(keys) != "[a b c d e]" {
+		t.Fatalf("keys after the compaction: %v, %v", keys, err)
+	}
+	got := []string{it.Key() + "=" + it.Value()}
+	for it.Next() {
+		got = append(got, it.Key()+"="+it.Value())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("range across a compaction: %v", err)
+	}
+	if want := "[a=e b=a c=d d=c e=a]"; fmt.Sprint(got) != want {
+		t.Fatalf("range across a compaction: %v, want %v", got, want)
+	}
+	if n := len(tableFiles(t, dir)); n != len(old)+1 {
+		t.Fatalf("%d tables while the iterator is open, want the %d merged ones kept and the new one", n, len(old))
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files := tableFiles(t, dir); len(files) != 1 {
+		t.Fatalf("tables %v after the iterator is closed, want only the merged one", files)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a table retired under an iterator which is never closed is removed on close
+	mustSet(t, db, "f", "f")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.Range("", "")
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tableFiles(t, dir)); n != 3 {
+		t.Fatalf("%d tables with an open iterator, want 3", n)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tableFiles(t, dir)); n != 1 {
+		t.Fatalf("%d tables after close, want 1", n)
+	}
+}
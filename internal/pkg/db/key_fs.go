@@ -0,0 +1,192 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// FS return a read only file system over the live keys, a key is a file whose contents is the value
+// and the parts of a key split by "/" are directories, it reads the database on each call, a key which
+// is not a valid fs path is not shown and a file hides a directory of the same name
+func (t *MEMSSTable) FS() fs.FS {
+	return &keyFS{db: t}
+}
+
+type keyFS struct {
+	db *MEMSSTable
+}
+
+var (
+	_ fs.StatFS    = (*keyFS)(nil)
+	_ fs.ReadDirFS = (*keyFS)(nil)
+)
+
+func (f *keyFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		val, err := f.db.Query(name)
+		if err == nil {
+			return &keyFile{info: keyFileInfo{name: path.Base(name), size: int64(len(val))}, r: strings.NewReader(val)}, nil
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	d := &keyDir{info: keyFileInfo{name: path.Base(name), dir: true}, prefix: dirPrefix(name), seen: make(map[string]bool)}
+	d.it = f.db.PrefixScan(d.prefix)
+	if name != "." {
+		// a directory exists only while a valid key is under it
+		entry, err := d.next()
+		if err != nil || entry == nil {
+			d.Close()
+			if err == nil {
+				err = fs.ErrNotExist
+			}
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		d.pending = entry
+	}
+	return d, nil
+}
+
+func (f *keyFS) Stat(name string) (fs.FileInfo, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+func (f *keyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	d, ok := file.(*keyDir)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return d.ReadDir(-1)
+}
+
+// dirPrefix return the prefix of the keys under the directory
+func dirPrefix(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name + "/"
+}
+
+type keyFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i keyFileInfo) Name() string       { return i.name }
+func (i keyFileInfo) Size() int64        { return i.size }
+func (i keyFileInfo) ModTime() time.Time { return time.Time{} }
+func (i keyFileInfo) IsDir() bool        { return i.dir }
+func (i keyFileInfo) Sys() interface{}   { return nil }
+
+func (i keyFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// keyFile is a key opened as a file, the value is read at Open
+type keyFile struct {
+	info keyFileInfo
+	r    *strings.Reader
+}
+
+func (f *keyFile) Stat() (fs.FileInfo, error)                   { return f.info, nil }
+func (f *keyFile) Read(p []byte) (int, error)                   { return f.r.Read(p) }
+func (f *keyFile) ReadAt(p []byte, off int64) (int, error)      { return f.r.ReadAt(p, off) }
+func (f *keyFile) Seek(offset int64, whence int) (int64, error) { return f.r.Seek(offset, whence) }
+func (f *keyFile) Close() error                                 { return nil }
+
+// keyDir is a directory of keys, its entries are read from a prefix scan as ReadDir asks for them
+type keyDir struct {
+	info    keyFileInfo
+	prefix  string
+	it      Iterator
+	pending fs.DirEntry     // entry read by Open to check the directory exists
+	seen    map[string]bool // names returned, a file and a directory may share one
+}
+
+func (d *keyDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *keyDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *keyDir) Close() error {
+	if d.it == nil {
+		return nil
+	}
+	err := d.it.Close()
+	d.it = nil
+	return err
+}
+
+// ReadDir return the next n entries in key order, all remaining entries if n <= 0
+func (d *keyDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := make([]fs.DirEntry, 0)
+	for n <= 0 || len(entries) < n {
+		entry := d.pending
+		d.pending = nil
+		if entry == nil {
+			var err error
+			if entry, err = d.next(); err != nil {
+				return entries, err
+			}
+			if entry == nil {
+				break
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if n > 0 && len(entries) == 0 {
+		return entries, io.EOF
+	}
+	return entries, nil
+}
+
+// next return the next child of the directory, nil at the end, the keys under a child directory are
+// skipped by seeking past its prefix
+func (d *keyDir) next() (fs.DirEntry, error) {
+	if d.it == nil {
+		return nil, nil
+	}
+	for d.it.Next() {
+		key := d.it.Key()
+		if !fs.ValidPath(key) {
+			continue
+		}
+		rest := key[len(d.prefix):]
+		info := keyFileInfo{name: rest, size: int64(len(d.it.Value()))}
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			info = keyFileInfo{name: rest[:i], dir: true}
+			if end := prefixEnd(d.prefix + rest[:i+1]); end != "" {
+				d.it.Seek(end)
+			}
+		}
+		if d.seen[info.name] {
+			continue
+		}
+		d.seen[info.name] = true
+		return fs.FileInfoToDirEntry(info), nil
+	}
+	return nil, d.it.Err()
+}
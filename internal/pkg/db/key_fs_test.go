@@ -0,0 +1,67 @@
+package db
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestKeyFS(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	for key, val := range map[string]string{
+		"a.txt":     "alpha",
+		"dir/b":     "bravo",
+		"dir/sub/c": "charlie",
+		"dir/sub/d": "delta",
+		"gone/e":    "echo",
+		"/invalid":  "x",
+		"f":         "file",
+		"f/hidden":  "x",
+	} {
+		mustSet(t, db, key, val)
+	}
+	// some keys are on disk, a deleted key is not shown
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("gone/e"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "dir/new", "november")
+	fsys := db.FS()
+
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b", "dir/new", "dir/sub/c", "dir/sub/d", "f"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(fsys, "dir/sub/c")
+	if err != nil || string(data) != "charlie" {
+		t.Fatalf("read dir/sub/c: %q, %v", data, err)
+	}
+	for _, name := range []string{"gone/e", "gone", "missing", "dir/sub/c/x", "/invalid"} {
+		if _, err := fs.Stat(fsys, name); err == nil {
+			t.Fatalf("stat %s succeeded", name)
+		} else if name == "missing" && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("stat %s: %v, want fs.ErrNotExist", name, err)
+		}
+	}
+
+	var walked []string
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			walked = append(walked, name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.txt", "dir/b", "dir/new", "dir/sub/c", "dir/sub/d", "f"}; !reflect.DeepEqual(walked, want) {
+		t.Fatalf("walked %v, want %v", walked, want)
+	}
+}
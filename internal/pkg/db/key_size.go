@@ -0,0 +1,37 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrKeyTooLarge = errors.New("key too large")
+
+// DefaultMaxKeySize is the longest key accepted unless changed by SetMaxKeySize, it also bounds the keys
+// replayed from wal on Open, so a record with a corrupted key length is caught
+const DefaultMaxKeySize = 64 << 10
+
+// SetMaxKeySize limit the bytes of a key, a write of a longer key returns ErrKeyTooLarge, each entry of
+// the sparse index stores a full key, 0 restores DefaultMaxKeySize
+func (t *MEMSSTable) SetMaxKeySize(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid max key size: %d", n)
+	}
+	if n == 0 {
+		n = DefaultMaxKeySize
+	}
+	t.lock.Lock()
+	t.maxKeySize = n
+	t.lock.Unlock()
+	return nil
+}
+
+// checkKeySize return ErrKeyTooLarge if a key of the commands is longer than the limit, caller must hold the lock
+func (t *MEMSSTable) checkKeySize(cmds []*Command) error {
+	for _, c := range cmds {
+		if len(c.Key) > t.maxKeySize {
+			return fmt.Errorf("%w: %d bytes, max %d", ErrKeyTooLarge, len(c.Key), t.maxKeySize)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMaxKeySize(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	if err := db.SetMaxKeySize(-1); err == nil {
+		t.Fatal("a negative max key size is accepted")
+	}
+	if err := db.SetMaxKeySize(8); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, strings.Repeat("k", 8), "v")
+	if err := db.Set(strings.Repeat("k", 9), "v"); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("set of a 9 byte key: %v, want ErrKeyTooLarge", err)
+	}
+	if err := db.Delete(strings.Repeat("k", 9)); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("delete of a 9 byte key: %v, want ErrKeyTooLarge", err)
+	}
+	// a batch with one long key writes nothing
+	b := NewBatch()
+	b.Set("short", "v")
+	b.Set(strings.Repeat("k", 9), "v")
+	if err := db.Write(b); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("batch with a 9 byte key: %v, want ErrKeyTooLarge", err)
+	}
+	expectNotFound(t, db, "short")
+	expectValue(t, db, strings.Repeat("k", 8), "v")
+
+	// 0 restores the default
+	if err := db.SetMaxKeySize(0); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, strings.Repeat("k", DefaultMaxKeySize), "v")
+	if err := db.Set(strings.Repeat("k", DefaultMaxKeySize+1), "v"); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("set above the default: %v, want ErrKeyTooLarge", err)
+	}
+
+	// a replayed key above the default is a corrupted record
+	if err := db.SetMaxKeySize(DefaultMaxKeySize + 1); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, strings.Repeat("k", DefaultMaxKeySize+1), "v")
+	crash(t, db)
+	if db, err := Open(dir, 2, 1); !errors.Is(err, ErrKeyTooLarge) {
+		if err == nil {
+			db.Close()
+		}
+		t.Fatalf("open with a replayed key above the limit: %v, want ErrKeyTooLarge", err)
+	}
+}
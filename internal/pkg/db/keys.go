@@ -0,0 +1,51 @@
+package db
+
+import "sort"
+
+// Keys return all live keys, sorted and without deleted keys
+func (t *MEMSSTable) Keys() ([]string, error) {
+	live := make(map[string]bool)
+
+	// disk and memory are taken in one lock, a flush between them would move keys out of
+	// memory into a table missing from the sparse index
+	t.lock.RLock()
+	sparseIndex := make([]*SparseIndex, len(t.sparseIndex))
+	copy(sparseIndex, t.sparseIndex)
+	pinned := t.pinTables(sparseIndex)
+	immutable := make([]*SSTable, len(t.immutable))
+	copy(immutable, t.immutable)
+	active := make(CommandData, len(t.activeTable.data))
+	copy(active, t.activeTable.data)
+	t.lock.RUnlock()
+	defer t.unpinTables(pinned)
+
+	// apply tiers from oldest to newest, newer command wins
+	for _, index := range sparseIndex {
+		disk, err := NewDiskSSTable(index.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if err := disk.Keys(index.BlockIndex, index.DataStart, func(key string, typ CommandType) {
+			live[key] = typ != CommandTypeDelete
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, table := range immutable {
+		for _, c := range table.data {
+			live[c.Key] = c.Command != CommandTypeDelete
+		}
+	}
+	for _, c := range active {
+		live[c.Key] = c.Command != CommandTypeDelete
+	}
+
+	keys := make([]string, 0, len(live))
+	for key, ok := range live {
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
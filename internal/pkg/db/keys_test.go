@@ -0,0 +1,49 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeys(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	db.SetMaxImmutableTables(4, false)
+	// two disk tables, x is deleted in the newer one and set again in memory
+	for _, key := range []string{"d2", "x", "d1", "y"} {
+		mustSet(t, db, key, key)
+	}
+	if err := db.Delete("x"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "d1", "again")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// an immutable table deletes y and the active table sets x again
+	mustSet(t, db, "m", "m")
+	if err := db.Delete("y"); err != nil {
+		t.Fatal(err)
+	}
+	db.RotateMemtable()
+	mustSet(t, db, "x", "back")
+	mustSet(t, db, "a", "a")
+	mustSet(t, db, "a", "a2")
+
+	want := []string{"a", "d1", "d2", "m", "x"}
+	check := func(db *MEMSSTable) {
+		t.Helper()
+		keys, err := db.Keys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Fatalf("keys %v, want %v", keys, want)
+		}
+	}
+	check(db)
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// lease is the value of a key held by AcquireLease, stored as json so it passes ValueEncodingJSON
+type lease struct {
+	Holder  string `json:"holder"`
+	Expires int64  `json:"expires"` // unix nanoseconds
+}
+
+// AcquireLease set key to a lease of holder for ttl in one write lock if the key is missing, deleted
+// or holds an expired lease, false if it holds a live lease or a value which is not a lease, the database
+// has no ttl, so the expiry is stored in the value as json and an expired lease stays until it is replaced
+// or released, the clock of the process decides expiry
+func (t *MEMSSTable) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	if err := checkRootKeys(key); err != nil {
+		return false, err
+	}
+	if holder == "" {
+		return false, errors.New("empty lease holder")
+	}
+	if ttl <= 0 {
+		return false, fmt.Errorf("invalid lease ttl: %v", ttl)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.waitWriteStall(); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	cur, ok, err := t.leaseLocked(key)
+	if err != nil {
+		return false, err
+	}
+	if ok && (cur == nil || cur.Expires > now.UnixNano()) {
+		return false, nil
+	}
+	data, err := json.Marshal(lease{Holder: holder, Expires: now.Add(ttl).UnixNano()})
+	if err != nil {
+		return false, err
+	}
+	if err := t.commandLocked(&Command{Key: key, Value: string(data), Command: CommandTypeSet}, false); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseLease delete key in one write lock if it holds a lease of holder, expired or not, false if
+// the key is missing or held by another holder
+func (t *MEMSSTable) ReleaseLease(key, holder string) (bool, error) {
+	if err := checkRootKeys(key); err != nil {
+		return false, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.waitWriteStall(); err != nil {
+		return false, err
+	}
+
+	cur, _, err := t.leaseLocked(key)
+	if err != nil || cur == nil || cur.Holder != holder {
+		return false, err
+	}
+	if err := t.commandLocked(&Command{Key: key, Command: CommandTypeDelete}, false); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// leaseLocked return the lease held by key, ok is false if the key is missing or deleted, the lease
+// is nil if the value is not a lease, caller must hold the lock
+func (t *MEMSSTable) leaseLocked(key string) (*lease, bool, error) {
+	v, err := t.getLocked(key)
+	if err == ErrKeyNotFound || err == nil && v.Command == CommandTypeDelete {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	val, err := t.value(v)
+	if err != nil {
+		return nil, false, err
+	}
+	l := new(lease)
+	if json.Unmarshal([]byte(val), l) != nil || l.Holder == "" && l.Expires == 0 {
+		return nil, true, nil
+	}
+	return l, true, nil
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	acquire := func(key, holder string, ttl time.Duration, want bool) {
+		t.Helper()
+		if ok, err := db.AcquireLease(key, holder, ttl); err != nil || ok != want {
+			t.Fatalf("%s acquires %s: %v, %v, want %v", holder, key, ok, err, want)
+		}
+	}
+	release := func(key, holder string, want bool) {
+		t.Helper()
+		if ok, err := db.ReleaseLease(key, holder); err != nil || ok != want {
+			t.Fatalf("%s releases %s: %v, %v, want %v", holder, key, ok, err, want)
+		}
+	}
+	if _, err := db.AcquireLease("lock", "", time.Minute); err == nil {
+		t.Fatal("a lease without holder is taken")
+	}
+	if _, err := db.AcquireLease("lock", "a", 0); err == nil {
+		t.Fatal("a lease without ttl is taken")
+	}
+
+	acquire("lock", "a", time.Minute, true)
+	acquire("lock", "b", time.Minute, false)
+	acquire("lock", "a", time.Minute, false)
+	release("lock", "b", false)
+	release("lock", "a", true)
+	expectNotFound(t, db, "lock")
+	release("lock", "a", false)
+	acquire("lock", "b", time.Minute, true)
+
+	// an expired lease is taken by another holder and still released by its own
+	acquire("short", "a", 20*time.Millisecond, true)
+	time.Sleep(40 * time.Millisecond)
+	acquire("short", "b", time.Minute, true)
+	release("short", "a", false)
+	acquire("expired", "a", time.Millisecond, true)
+	time.Sleep(5 * time.Millisecond)
+	release("expired", "a", true)
+
+	// a value which is not a lease is never replaced nor deleted
+	mustSet(t, db, "plain", "value")
+	acquire("plain", "a", time.Minute, false)
+	release("plain", "", false)
+	expectValue(t, db, "plain", "value")
+
+	// a lease survives flush and restart
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, db)
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	acquire("lock", "a", time.Minute, false)
+	release("lock", "b", true)
+}
+
+func TestLeaseContended(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	var wg sync.WaitGroup
+	var won int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := db.AcquireLease("lock", fmt.Sprintf("h%d", i), time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				atomic.AddInt64(&won, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Fatalf("%d holders acquired the lease, want 1", won)
+	}
+}
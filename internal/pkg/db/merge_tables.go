@@ -0,0 +1,61 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MergeTables merge exactly the disk tables of the ids into one table keeping the newest version of
+// each key, the tables must be adjacent in seq order so no other table holds versions between them,
+// tombstones are dropped if the oldest table is included, it waits for compactions holding the tables
+func (t *MEMSSTable) MergeTables(ids []uint64) error {
+	if len(ids) < 2 {
+		return errors.New("MergeTables: at least 2 tables are needed")
+	}
+	want := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		if want[id] {
+			return fmt.Errorf("MergeTables: table %d is given twice", id)
+		}
+		want[id] = true
+	}
+
+	t.lock.Lock()
+	var tables []*tableIndex
+	var bottom bool
+	for {
+		all := groupSparseIndex(t.sparseIndex)
+		start := -1
+		tables = make([]*tableIndex, 0, len(ids))
+		for i, table := range all {
+			if id, ok := tableID(table.name); ok && want[id] {
+				if start >= 0 && start+len(tables) != i {
+					t.lock.Unlock()
+					return fmt.Errorf("MergeTables: table %s is not adjacent to the other tables in seq order", table.name)
+				}
+				if start < 0 {
+					start = i
+				}
+				tables = append(tables, table)
+			}
+		}
+		if len(tables) != len(ids) {
+			t.lock.Unlock()
+			return fmt.Errorf("MergeTables: %d of %d tables not found", len(ids)-len(tables), len(ids))
+		}
+		if !t.tablesBusy(tables) {
+			bottom = start == 0
+			break
+		}
+		// the tables may be merged away while waiting, so they are looked up again
+		t.compactCond.Wait()
+	}
+	t.reserveTables(tables)
+	t.lock.Unlock()
+
+	err := t.mergeTables(tables, bottom)
+	t.lock.Lock()
+	t.releaseTables(tables)
+	t.lock.Unlock()
+	return err
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMergeTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	flushTwo := func(a, b string, del bool) {
+		t.Helper()
+		mustSet(t, db, a, "new")
+		if del {
+			if err := db.Delete(b); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			mustSet(t, db, b, "old")
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flushTwo("a", "b", false)
+	flushTwo("a", "b", true)
+	flushTwo("c", "d", false)
+	ids := func() []uint64 {
+		t.Helper()
+		tables, err := db.ListTables()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tableIDs(tables)
+	}
+	path := func(id uint64) string {
+		return fmt.Sprintf("%s/%d.sdb", dir, id)
+	}
+	before := ids()
+	if len(before) != 3 {
+		t.Fatalf("%d tables, want 3", len(before))
+	}
+
+	for _, bad := range [][]uint64{
+		{before[0]},
+		{before[1], before[1]},
+		{before[1], 12345},
+		// the middle table would hold versions between the merged ones
+		{before[0], before[2]},
+	} {
+		if err := db.MergeTables(bad); err == nil {
+			t.Fatalf("merged tables %v", bad)
+		}
+	}
+	if got := ids(); len(got) != 3 {
+		t.Fatalf("a failed merge changed the tables to %v", got)
+	}
+
+	// the oldest table is not merged, the tombstone of b must stay to hide it
+	if err := db.MergeTables([]uint64{before[2], before[1]}); err != nil {
+		t.Fatal(err)
+	}
+	after := ids()
+	if len(after) != 2 || after[0] != before[0] {
+		t.Fatalf("tables %v after merging %v, want the oldest and a new one", after, before[1:])
+	}
+	for _, id := range before[1:] {
+		if _, err := os.Stat(path(id)); !os.IsNotExist(err) {
+			t.Fatalf("input table %d is not removed: %v", id, err)
+		}
+	}
+	merged, _, err := readTableMetaInfo(path(after[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.KeyCount != 4 || merged.TombstoneCount != 1 {
+		t.Fatalf("merged table of %d commands, %d tombstones, want 4 and 1", merged.KeyCount, merged.TombstoneCount)
+	}
+	check := func() {
+		t.Helper()
+		expectValue(t, db, "a", "new")
+		expectNotFound(t, db, "b")
+		expectValue(t, db, "c", "new")
+		expectValue(t, db, "d", "old")
+	}
+	check()
+
+	// with the oldest table the run is at the bottom and the tombstone is dropped
+	if err := db.MergeTables(after); err != nil {
+		t.Fatal(err)
+	}
+	final := ids()
+	if len(final) != 1 {
+		t.Fatalf("tables %v after merging all", final)
+	}
+	bottom, _, err := readTableMetaInfo(path(final[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bottom.KeyCount != 3 || bottom.TombstoneCount != 0 {
+		t.Fatalf("bottom table of %d commands, %d tombstones, want 3 and 0", bottom.KeyCount, bottom.TombstoneCount)
+	}
+	check()
+}
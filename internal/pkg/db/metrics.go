@@ -0,0 +1,29 @@
+package db
+
+import "time"
+
+// names of the observations given to Metrics
+const (
+	MetricBlockRead       = "block_read"       // read a block from the file or the mapping
+	MetricBlockDecompress = "block_decompress" // decompress a block read by query, not observed for a raw block
+)
+
+// Metrics receive timing observations, for example to feed latency histograms, it is called
+// under the read lock of the database and must be fast and safe for concurrent use
+type Metrics interface {
+	Observe(name string, d time.Duration)
+}
+
+// SetMetrics give the timing of the block read and decompression of each query to m, nil disables it
+func (t *MEMSSTable) SetMetrics(m Metrics) {
+	t.lock.Lock()
+	t.metrics = m
+	t.lock.Unlock()
+}
+
+// observe give the time since start to the metrics if they are set
+func observe(m Metrics, name string, start time.Time) {
+	if m != nil {
+		m.Observe(name, time.Since(start))
+	}
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMetrics count the observations of each name
+type fakeMetrics struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+func (m *fakeMetrics) Observe(name string, d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if d < 0 {
+		panic("negative duration")
+	}
+	m.counts[name]++
+}
+
+func (m *fakeMetrics) take() map[string]int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	counts := m.counts
+	m.counts = make(map[string]int)
+	return counts
+}
+
+func TestMetricsBlockReads(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	long := strings.Repeat("compressible", 50)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		mustSet(t, db, key, long)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "memory", "v")
+	m := &fakeMetrics{counts: make(map[string]int)}
+	db.SetMetrics(m)
+
+	expectCounts := func(what string, read, decompress int) {
+		t.Helper()
+		counts := m.take()
+		if counts[MetricBlockRead] != read || counts[MetricBlockDecompress] != decompress || len(counts) > 2 {
+			t.Fatalf("%s: observations %v, want %d reads and %d decompressions", what, counts, read, decompress)
+		}
+	}
+	expectValue(t, db, "c", long)
+	expectCounts("query of a disk key", 1, 1)
+	expectValue(t, db, "memory", "v")
+	expectCounts("query of a memory key", 0, 0)
+	expectNotFound(t, db, "z")
+	expectCounts("query outside the tables", 0, 0)
+
+	db.SetMmapReads(true)
+	expectValue(t, db, "a", long)
+	expectCounts("query of a mapped table", 1, 1)
+
+	db.SetMetrics(nil)
+	expectValue(t, db, "b", long)
+	expectCounts("query without metrics", 0, 0)
+}
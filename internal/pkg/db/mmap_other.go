@@ -0,0 +1,15 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package db
+
+import "errors"
+
+// mmapFile is not supported on this platform, disk tables are read from the file
+func mmapFile(filename string) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
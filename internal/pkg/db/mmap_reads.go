@@ -0,0 +1,90 @@
+package db
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// mappedFile is a disk table mapped into memory, a reader holds the read lock while it uses data
+type mappedFile struct {
+	lock sync.RWMutex
+	data []byte // nil if the file can not be mapped or is unmapped
+}
+
+func (m *mappedFile) release() {
+	if m != nil {
+		m.lock.RUnlock()
+	}
+}
+
+// close unmap the file after the running readers release it
+func (m *mappedFile) close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.data == nil {
+		return
+	}
+	if err := munmapFile(m.data); err != nil {
+		log.Printf("munmap error: %v", err)
+	}
+	m.data = nil
+}
+
+// SetMmapReads make query read blocks from disk tables mapped into memory instead of reading the
+// file on each lookup, a table is mapped on its first query and unmapped when it is removed, on
+// Close or when disabled, a table which can not be mapped is read from the file
+func (t *MEMSSTable) SetMmapReads(enable bool) {
+	t.mmapLock.Lock()
+	t.mmapReads = enable
+	t.mmapLock.Unlock()
+	if !enable {
+		t.unmapAll()
+	}
+}
+
+// acquireMapped return the mapping of the table with its read lock held, nil if mmap reads are
+// disabled or the file does not exist
+func (t *MEMSSTable) acquireMapped(filename string) *mappedFile {
+	t.mmapLock.Lock()
+	defer t.mmapLock.Unlock()
+	if !t.mmapReads {
+		return nil
+	}
+	m := t.mapped[filename]
+	if m == nil {
+		data, err := mmapFile(filename)
+		if os.IsNotExist(err) {
+			// removed by a compaction, not mapped again
+			return nil
+		}
+		m = &mappedFile{data: data}
+		if t.mapped == nil {
+			t.mapped = make(map[string]*mappedFile)
+		}
+		t.mapped[filename] = m
+	}
+	m.lock.RLock()
+	return m
+}
+
+// unmapTable unmap a table after its file is removed, so it can not be mapped again
+func (t *MEMSSTable) unmapTable(filename string) {
+	t.mmapLock.Lock()
+	m := t.mapped[filename]
+	delete(t.mapped, filename)
+	t.mmapLock.Unlock()
+	if m != nil {
+		m.close()
+	}
+}
+
+func (t *MEMSSTable) unmapAll() {
+	t.mmapLock.Lock()
+	mapped := t.mapped
+	t.mapped = nil
+	t.mmapLock.Unlock()
+	for _, m := range mapped {
+		m.close()
+	}
+}
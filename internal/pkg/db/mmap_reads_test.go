@@ -0,0 +1,84 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// openTablesOnly open a store with n keys in its disk tables and nothing in memory
+func openTablesOnly(tb testing.TB, dir string, n int) *MEMSSTable {
+	tb.Helper()
+	db, err := Open(dir, 64, 16)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := db.Set(fmt.Sprintf("k%06d", i), fmt.Sprintf("v%d", i)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+func TestMmapReads(t *testing.T) {
+	dir := t.TempDir()
+	db := openTablesOnly(t, dir, 3000)
+	defer db.Close()
+	db.SetMmapReads(true)
+	check := func() {
+		t.Helper()
+		for i := 0; i < 3000; i += 7 {
+			expectValue(t, db, fmt.Sprintf("k%06d", i), fmt.Sprintf("v%d", i))
+		}
+		expectNotFound(t, db, "k999999")
+	}
+	check()
+	db.mmapLock.Lock()
+	mapped := len(db.mapped)
+	db.mmapLock.Unlock()
+	if mapped != len(tableFiles(t, dir)) {
+		t.Fatalf("%d tables mapped, want all %d", mapped, len(tableFiles(t, dir)))
+	}
+
+	// a table removed by a compaction is unmapped, the merged one is mapped on its first query
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	check()
+	db.mmapLock.Lock()
+	mapped = len(db.mapped)
+	db.mmapLock.Unlock()
+	if mapped != 1 {
+		t.Fatalf("%d tables mapped after a major compaction, want 1", mapped)
+	}
+
+	db.SetMmapReads(false)
+	db.mmapLock.Lock()
+	mapped = len(db.mapped)
+	db.mmapLock.Unlock()
+	if mapped != 0 {
+		t.Fatalf("%d tables still mapped after disabling mmap reads", mapped)
+	}
+	check()
+}
+
+func BenchmarkDiskQuery(b *testing.B) {
+	const n = 5000
+	db := openTablesOnly(b, b.TempDir(), n)
+	defer db.Close()
+	for _, mmap := range []bool{false, true} {
+		db.SetMmapReads(mmap)
+		b.Run(fmt.Sprintf("mmap=%v", mmap), func(b *testing.B) {
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < b.N; i++ {
+				if _, err := db.Query(fmt.Sprintf("k%06d", r.Intn(n))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrReservedKey = errors.New("key reserved for namespaces")
+
+// namespaceMark starts every key of a namespace, a key of the default keyspace must not start with it
+const namespaceMark = "\x00"
+
+// Namespace is a logically separate keyspace, it shares the WAL, memory tables, disk tables and
+// sparse index of the db, independent flush and compaction of a namespace are not implemented, keys
+// are stored behind a mark byte, the length of the namespace name and the name, so different namespaces
+// never collide whatever bytes their names hold, and the default keyspace rejects keys starting with
+// the mark, so its keys never collide with a namespace either, Range and Keys of the db list the stored
+// keys of the namespaces too
+type Namespace struct {
+	name   string
+	prefix string
+	db     *MEMSSTable
+}
+
+// Namespace return a handle of the named keyspace
+func (t *MEMSSTable) Namespace(name string) *Namespace {
+	return &Namespace{name: name, prefix: namespacePrefix(name), db: t}
+}
+
+// namespacePrefix return the mark, the uvarint length of the name and the name, a prefix is never the
+// start of the prefix of another name
+func namespacePrefix(name string) string {
+	buf := make([]byte, len(namespaceMark)+binary.MaxVarintLen64, len(namespaceMark)+binary.MaxVarintLen64+len(name))
+	n := copy(buf, namespaceMark)
+	n += binary.PutUvarint(buf[n:], uint64(len(name)))
+	return string(append(buf[:n], name...))
+}
+
+// checkRootKeys return ErrReservedKey if a key written to the default keyspace starts with the namespace mark
+func checkRootKeys(keys ...string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, namespaceMark) {
+			return fmt.Errorf("%w: %q", ErrReservedKey, key)
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+func (n *Namespace) Set(key, val string) error {
+	return n.db.command(&Command{Key: n.prefix + key, Value: val, Command: CommandTypeSet}, false)
+}
+
+func (n *Namespace) Delete(key string) error {
+	return n.db.command(&Command{Key: n.prefix + key, Command: CommandTypeDelete}, false)
+}
+
+func (n *Namespace) Query(key string) (string, error) {
+	return n.db.Query(n.prefix + key)
+}
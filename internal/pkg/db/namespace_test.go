@@ -0,0 +1,87 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNamespaceIsolation(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	users, orders := db.Namespace("users"), db.Namespace("orders")
+	if err := users.Set("1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.Set("1", "book"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := users.Query("1"); err != nil || v != "alice" {
+		t.Fatalf("users 1: %q, %v", v, err)
+	}
+	if v, err := orders.Query("1"); err != nil || v != "book" {
+		t.Fatalf("orders 1: %q, %v", v, err)
+	}
+	expectNotFound(t, db, "1")
+
+	if err := users.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Query("1"); err != ErrKeyNotFound {
+		t.Fatalf("users 1 after delete: %v", err)
+	}
+	if v, err := orders.Query("1"); err != nil || v != "book" {
+		t.Fatalf("orders 1 after delete in users: %q, %v", v, err)
+	}
+}
+
+func TestNamespaceNameWithSeparator(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	// joined by a separator both would be stored as "a\x00b\x00c"
+	if err := db.Namespace("a\x00b").Set("c", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Namespace("a").Query("b\x00c"); err != ErrKeyNotFound {
+		t.Fatalf("a / b\\x00c: %v, want ErrKeyNotFound", err)
+	}
+	if v, err := db.Namespace("a\x00b").Query("c"); err != nil || v != "1" {
+		t.Fatalf("a\\x00b / c: %q, %v", v, err)
+	}
+}
+
+func TestNamespaceAndRootKeys(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	ns := db.Namespace("abc")
+	if err := ns.Set("foo", "namespace"); err != nil {
+		t.Fatal(err)
+	}
+	// a root key holding the stored key of the namespace is refused
+	stored := namespacePrefix("abc") + "foo"
+	b := NewBatch()
+	b.Set(stored, "root")
+	for what, err := range map[string]error{
+		"set":    db.Set(stored, "root"),
+		"delete": db.Delete(stored),
+		"batch":  db.Write(b),
+		"append": db.Append(stored, "root"),
+		"rename": db.Rename("x", stored),
+	} {
+		if !errors.Is(err, ErrReservedKey) {
+			t.Fatalf("%s of a reserved root key: %v, want ErrReservedKey", what, err)
+		}
+	}
+	if _, err := db.DeleteIf(stored, "namespace"); !errors.Is(err, ErrReservedKey) {
+		t.Fatalf("delete-if of a reserved root key: %v, want ErrReservedKey", err)
+	}
+	if v, err := ns.Query("foo"); err != nil || v != "namespace" {
+		t.Fatalf("abc / foo: %q, %v", v, err)
+	}
+
+	// the stored key of abc / foo without the mark is an ordinary root key
+	mustSet(t, db, "\x03abcfoo", "root")
+	expectValue(t, db, "\x03abcfoo", "root")
+	if v, err := ns.Query("foo"); err != nil || v != "namespace" {
+		t.Fatalf("abc / foo after the root set: %q, %v", v, err)
+	}
+}
@@ -0,0 +1,79 @@
+package db
+
+// PrefixExtractor return the prefix of a key, the prefix filter of a table is built over the prefixes,
+// every key starting with a returned prefix must be mapped to the same prefix
+type PrefixExtractor func(key string) string
+
+// SetPrefixExtractor build a bloom filter of key prefixes for each disk table, a prefix scan skips
+// the tables whose filter excludes the prefix, nil removes the filters
+func (t *MEMSSTable) SetPrefixExtractor(fn PrefixExtractor) error {
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+
+	t.lock.RLock()
+	tables := groupSparseIndex(t.sparseIndex)
+	hasher := t.bloomHasher
+	t.lock.RUnlock()
+
+	filters := make(map[string]*bloomFilter)
+	if fn != nil {
+		for _, table := range tables {
+			blocks, err := table.loadBlocks()
+			if err != nil {
+				return err
+			}
+			filters[table.name] = newPrefixFilter(fn, hasher, blocks)
+		}
+	}
+
+	t.lock.Lock()
+	t.prefixFunc = fn
+	t.prefixFilters = filters
+	t.lock.Unlock()
+	return nil
+}
+
+// newPrefixFilter return the filter of key prefixes of the blocks
+func newPrefixFilter(fn PrefixExtractor, hasher Hasher, blocks []*SSTable) *bloomFilter {
+	n := 0
+	for _, block := range blocks {
+		n += block.Len()
+	}
+	f := newBloomFilter(n, hasher)
+	for _, block := range blocks {
+		for _, c := range block.data {
+			f.Add(fn(c.Key))
+		}
+	}
+	return f
+}
+
+// addPrefixFilter build the prefix filter of a new table, caller must hold the lock
+func (t *MEMSSTable) addPrefixFilter(name string, blocks []*SSTable) {
+	if t.prefixFunc == nil {
+		return
+	}
+	t.prefixFilters[name] = newPrefixFilter(t.prefixFunc, t.bloomHasher, blocks)
+}
+
+// tableMayContainPrefix report whether the table may have keys with the prefix, caller must hold the lock
+func (t *MEMSSTable) tableMayContainPrefix(name, prefix string) bool {
+	// the filter only knows whole prefixes of the extractor
+	if t.prefixFunc == nil || t.prefixFunc(prefix) != prefix {
+		return true
+	}
+	f, ok := t.prefixFilters[name]
+	return !ok || f.MayContain(prefix)
+}
+
+// prefixEnd return the smallest key greater than all keys with the prefix, empty if there is none
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPrefixFilterSkipsTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	mustSet(t, db, "user:1", "u1")
+	mustSet(t, db, "order:1", "o1")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// the filter of the table on disk is built from its blocks, of the next one by flush
+	if err := db.SetPrefixExtractor(func(key string) string {
+		if i := strings.IndexByte(key, ':'); i >= 0 {
+			return key[:i+1]
+		}
+		return key
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the range of the second table covers user: without holding it
+	mustSet(t, db, "acct:1", "a1")
+	mustSet(t, db, "zoo:1", "z1")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, db.PrefixScan("user:"), []string{"user:1=u1"})
+
+	// a scan reading the second table would fail now
+	files := tableFiles(t, dir)
+	if err := os.Remove(files[1]); err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, db.PrefixScan("user:"), []string{"user:1=u1"})
+	expectEntries(t, db.PrefixScan("order:"), []string{"order:1=o1"})
+	it := db.PrefixScan("zoo:")
+	for it.Next() {
+	}
+	if it.Err() == nil {
+		t.Fatal("scan of the removed table succeeded")
+	}
+	it.Close()
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrSequenceTooOld = errors.New("sequence too old")
+
+// QueryAt return the value of key as of the sequence number seq, commands after seq are not seen,
+// ErrKeyNotFound if the key is missing or deleted at seq, ErrSequenceTooOld if versions needed at seq
+// were dropped by compaction, CollapseKey or SetDedupActiveTable, the limit is stored in the disk tables
+// and is lost if no table is left to hold it, commands of tables before meta info version 7 are seen at any seq
+func (t *MEMSSTable) QueryAt(key string, seq uint64) (string, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if seq < t.droppedSeq {
+		return "", fmt.Errorf("%w: %d, versions before %d are dropped", ErrSequenceTooOld, seq, t.droppedSeq)
+	}
+	v, err := t.getAtLocked(key, seq)
+	if err != nil {
+		return "", err
+	}
+	if v.Command == CommandTypeDelete {
+		return "", ErrKeyNotFound
+	}
+	return t.value(v)
+}
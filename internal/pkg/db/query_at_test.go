@@ -0,0 +1,131 @@
+package db
+
+import (
+	"testing"
+)
+
+func expectValueAt(t *testing.T, db *MEMSSTable, key string, seq uint64, want string) {
+	t.Helper()
+	got, err := db.QueryAt(key, seq)
+	if want == "" {
+		if err != ErrKeyNotFound {
+			t.Fatalf("%s as of %d: got %q, %v, want ErrKeyNotFound", key, seq, got, err)
+		}
+		return
+	}
+	if err != nil || got != want {
+		t.Fatalf("%s as of %d: got %q, %v, want %q", key, seq, got, err, want)
+	}
+}
+
+func TestQueryAt(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	// the sequence numbers are 1 to 7
+	mustSet(t, db, "k", "v1")
+	mustSet(t, db, "x", "x")
+	mustSet(t, db, "k", "v2")
+	if err := db.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "b", "b")
+	mustSet(t, db, "a", "a")
+	mustSet(t, db, "k", "v3")
+	// 1 to 4 on disk, 5 and 6 immutable, 7 active
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(db *MEMSSTable) {
+		t.Helper()
+		expectValueAt(t, db, "k", 0, "")
+		expectValueAt(t, db, "k", 1, "v1")
+		expectValueAt(t, db, "k", 2, "v1")
+		expectValueAt(t, db, "k", 3, "v2")
+		expectValueAt(t, db, "k", 4, "")
+		expectValueAt(t, db, "k", 6, "")
+		expectValueAt(t, db, "k", 7, "v3")
+		expectValueAt(t, db, "b", 4, "")
+		expectValueAt(t, db, "b", 5, "b")
+		expectValueAt(t, db, "a", 5, "")
+		expectValueAt(t, db, "a", 6, "a")
+		expectValueAt(t, db, "missing", 7, "")
+	}
+	check(db)
+	crash(t, db)
+
+	// memory commands are replayed with the same sequence numbers
+	db = openTestDB(t, dir, 2, 1)
+	check(db)
+	db.Close()
+
+	// a clean close flushes them to disk
+	db = openTestDB(t, dir, 2, 1)
+	check(db)
+
+	// the merge keeps the newest version of k and drops the older ones
+	if err := db.Compact(CompactionOptions{MinThreshold: 2}); err != nil {
+		t.Fatal(err)
+	}
+	expectValueAt(t, db, "k", 7, "v3")
+	if _, err := db.QueryAt("k", 3); !isSequenceTooOld(err) {
+		t.Fatalf("k as of 3 after compaction: %v, want ErrSequenceTooOld", err)
+	}
+	db.Close()
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectValueAt(t, db, "k", 7, "v3")
+	if _, err := db.QueryAt("k", 3); !isSequenceTooOld(err) {
+		t.Fatalf("k as of 3 after reopen: %v, want ErrSequenceTooOld", err)
+	}
+}
+
+func TestQueryAtPrunesNewerTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	for _, val := range []string{"v1", "v2", "v3"} {
+		mustSet(t, db, "k", val)
+		mustSet(t, db, "o"+val, val)
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// each table records the sequence numbers of its commands
+	for i, name := range tableFiles(t, dir) {
+		metaInfo, _, err := readTableMetaInfo(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if min, max := uint64(2*i+1), uint64(2*i+2); metaInfo.MinSeq != min || metaInfo.MaxSeq != max {
+			t.Fatalf("table %s holds %d to %d, want %d to %d", name, metaInfo.MinSeq, metaInfo.MaxSeq, min, max)
+		}
+	}
+
+	m := &fakeMetrics{counts: make(map[string]int)}
+	db.SetMetrics(m)
+	for _, c := range []struct {
+		seq   uint64
+		want  string
+		reads int
+	}{
+		// the tables newer than the sequence are skipped without reading a block
+		{1, "v1", 1},
+		{2, "v1", 1},
+		{3, "v2", 1},
+		{6, "v3", 1},
+	} {
+		expectValueAt(t, db, "k", c.seq, c.want)
+		if n := m.take()[MetricBlockRead]; n != c.reads {
+			t.Fatalf("k as of %d read %d blocks, want %d", c.seq, n, c.reads)
+		}
+	}
+	// later writes are invisible
+	expectValueAt(t, db, "ov3", 4, "")
+	expectValueAt(t, db, "ov2", 3, "")
+	expectValueAt(t, db, "ov2", 4, "v2")
+}
@@ -0,0 +1,43 @@
+package db
+
+import "testing"
+
+func TestQueryRaw(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	mustSet(t, db, "a", "1")
+	mustSet(t, db, "b", "2")
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	expectRaw := func(db *MEMSSTable, key, val string, typ CommandType, seq uint64) {
+		t.Helper()
+		data, err := db.QueryRaw(key)
+		if err != nil {
+			t.Fatalf("raw %s: %v", key, err)
+		}
+		c := new(Command)
+		c.Restore(data)
+		if c.Key != key || c.Value != val || c.Command != typ || c.seq != seq {
+			t.Fatalf("raw %s: %+v, want value %q, type %d, seq %d", key, c, val, typ, seq)
+		}
+	}
+	check := func(db *MEMSSTable) {
+		t.Helper()
+		expectRaw(db, "a", "", CommandTypeDelete, 3)
+		expectRaw(db, "b", "2", CommandTypeSet, 2)
+		if _, err := db.QueryRaw("missing"); err != ErrKeyNotFound {
+			t.Fatalf("raw of a missing key: %v", err)
+		}
+	}
+	check(db)
+	// the sequence numbers are kept on disk
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	check(db)
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+)
+
+var ErrQuotaExceeded = errors.New("database quota exceeded")
+
+// Quota limit the size of the database, 0 means no limit, deletes are always allowed
+type Quota struct {
+	MaxBytes uint64 // bytes of files in the database directory
+	MaxKeys  uint64 // number of live keys
+}
+
+// quota track the usage of the database, the bytes are counted by the write stats and removed files
+type quota struct {
+	removed int64 // bytes of files removed since the quota is set, atomic
+	base    int64 // bytes of the directory when the quota is set minus the bytes written before
+	keys    int64 // live keys, only counted with MaxKeys
+	limit   Quota
+}
+
+// SetQuota limit the bytes on disk and the live keys, a Set exceeding it returns ErrQuotaExceeded,
+// the directory and the keys are counted once here and tracked by writes after it
+func (t *MEMSSTable) SetQuota(q Quota) error {
+	var keys []string
+	if q.MaxKeys > 0 {
+		var err error
+		if keys, err = t.Keys(); err != nil {
+			return err
+		}
+	}
+	fs, err := os.ReadDir(t.rootPath)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, f := range fs {
+		if fi, err := f.Info(); err == nil && fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	atomic.StoreInt64(&t.quota.removed, 0)
+	t.quota.base = size - int64(t.stats.diskBytes())
+	t.quota.keys = int64(len(keys))
+	t.quota.limit = q
+	return nil
+}
+
+// usedBytes return the bytes of files in the database directory, caller must hold the lock
+func (t *MEMSSTable) usedBytes() uint64 {
+	used := t.quota.base + int64(t.stats.diskBytes()) - atomic.LoadInt64(&t.quota.removed)
+	if used < 0 {
+		return 0
+	}
+	return uint64(used)
+}
+
+// countRemoved take the size of a file about to be removed out of the quota usage
+func (t *MEMSSTable) countRemoved(filename string) {
+	if fi, err := os.Stat(filename); err == nil {
+		atomic.AddInt64(&t.quota.removed, fi.Size())
+	}
+}
+
+// checkQuota return ErrQuotaExceeded if the set commands exceed the quota, otherwise the change of
+// live keys after the commands are written, caller must hold the lock
+func (t *MEMSSTable) checkQuota(cmds []*Command) (int64, error) {
+	limit := t.quota.limit
+	if limit.MaxBytes == 0 && limit.MaxKeys == 0 {
+		return 0, nil
+	}
+	var size uint64
+	var delta int64
+	set := false
+	live := make(map[string]bool)
+	for _, c := range cmds {
+		isSet := c.Command != CommandTypeDelete
+		if isSet {
+			set = true
+			size += uint64(len(c.Key) + len(c.Value))
+		}
+		if limit.MaxKeys == 0 {
+			continue
+		}
+		before, ok := live[c.Key]
+		if !ok {
+			v, err := t.getLocked(c.Key)
+			if err != nil && err != ErrKeyNotFound {
+				return 0, err
+			}
+			before = err == nil && v.Command != CommandTypeDelete
+		}
+		if isSet && !before {
+			delta++
+		} else if !isSet && before {
+			delta--
+		}
+		live[c.Key] = isSet
+	}
+	if !set {
+		return delta, nil
+	}
+	if limit.MaxBytes > 0 && t.usedBytes()+size > limit.MaxBytes {
+		return 0, ErrQuotaExceeded
+	}
+	if limit.MaxKeys > 0 && delta > 0 && uint64(t.quota.keys+delta) > limit.MaxKeys {
+		return 0, ErrQuotaExceeded
+	}
+	return delta, nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func expectQuotaExceeded(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("write over the quota: %v, want ErrQuotaExceeded", err)
+	}
+}
+
+func TestKeyQuota(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	mustSet(t, db, "a", "a")
+	mustSet(t, db, "b", "b")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// the keys on disk are counted when the quota is set
+	if err := db.SetQuota(Quota{MaxKeys: 3}); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "c", "c")
+	expectQuotaExceeded(t, db.Set("d", "d"))
+	expectNotFound(t, db, "d")
+	// overwrites and deletes do not add keys
+	mustSet(t, db, "a", "a2")
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "d", "d")
+
+	// a batch over the quota is rejected as a whole
+	b := NewBatch()
+	b.Delete("b")
+	b.Set("e", "e")
+	b.Set("f", "f")
+	expectQuotaExceeded(t, db.Write(b))
+	expectValue(t, db, "b", "b")
+	b = NewBatch()
+	b.Delete("b")
+	b.Set("e", "e")
+	if err := db.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "e", "e")
+}
+
+func TestByteQuota(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	mustSet(t, db, "a", strings.Repeat("a", 100))
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.lock.RLock()
+	used := db.usedBytes()
+	db.lock.RUnlock()
+	if err := db.SetQuota(Quota{MaxBytes: used + 1000}); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	n := 0
+	for ; n < 100 && err == nil; n++ {
+		err = db.Set(fmt.Sprintf("k%02d", n), strings.Repeat("v", 100))
+	}
+	expectQuotaExceeded(t, err)
+	if n < 3 || n > 10 {
+		t.Fatalf("quota of 1000 bytes exceeded after %d writes of 100 bytes", n)
+	}
+	// deletes are always allowed
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	expectNotFound(t, db, "a")
+	expectQuotaExceeded(t, db.Set("big", strings.Repeat("v", 200)))
+
+	if err := db.SetQuota(Quota{}); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "big", strings.Repeat("v", 2000))
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// RangeBinary write the live keys in [start, end) to w as records of: keyLength(4), key, valueLength(4), value,
+// little endian, the records are written from the range iterator through one buffer and end at the end of w's
+// data, RangeReader reads them back
+func (t *MEMSSTable) RangeBinary(start, end string, w io.Writer) error {
+	it := t.Range(start, end)
+	defer it.Close()
+	bw := bufio.NewWriter(w)
+	var head [4]byte
+	writeString := func(s string) error {
+		binary.LittleEndian.PutUint32(head[:], uint32(len(s)))
+		if _, err := bw.Write(head[:]); err != nil {
+			return err
+		}
+		_, err := bw.WriteString(s)
+		return err
+	}
+	for it.Next() {
+		if err := writeString(it.Key()); err != nil {
+			return err
+		}
+		if err := writeString(it.Value()); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// RangeReader read the records written by RangeBinary one by one
+type RangeReader struct {
+	r     *bufio.Reader
+	buf   []byte
+	key   string
+	value string
+	err   error
+}
+
+func NewRangeReader(r io.Reader) *RangeReader {
+	return &RangeReader{r: bufio.NewReader(r)}
+}
+
+// Next read the next record, false at the end of data or on error, a record cut short is io.ErrUnexpectedEOF
+func (r *RangeReader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	key, err := r.readString()
+	if err == io.EOF {
+		return false
+	}
+	if err == nil {
+		r.value, err = r.readString()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		r.err = err
+		return false
+	}
+	r.key = key
+	return true
+}
+
+func (r *RangeReader) readString() (string, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r.r, head[:]); err != nil {
+		return "", err
+	}
+	n := int(binary.LittleEndian.Uint32(head[:]))
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return string(r.buf), nil
+}
+
+func (r *RangeReader) Key() string {
+	return r.key
+}
+
+func (r *RangeReader) Value() string {
+	return r.value
+}
+
+// Err return the read error, nil at the end of data
+func (r *RangeReader) Err() error {
+	return r.err
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readRange read the records of a RangeBinary stream as entries of collect
+func readRange(data []byte) ([]string, error) {
+	r := NewRangeReader(bytes.NewReader(data))
+	entries := make([]string, 0)
+	for r.Next() {
+		entries = append(entries, r.Key()+"="+r.Value())
+	}
+	return entries, r.Err()
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errInjected
+}
+
+func TestRangeBinary(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	for i := 0; i < 10; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("k3"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "k5", "")
+	mustSet(t, db, "k6", strings.Repeat("long", 2000))
+
+	var buf bytes.Buffer
+	if err := db.RangeBinary("k2", "k8", &buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readRange(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := collect(t, db.Range("k2", "k8")); !reflect.DeepEqual(got, want) || len(want) != 5 {
+		t.Fatalf("round trip %v, want %v", got, want)
+	}
+
+	// a stream cut inside a record is an error, one cut between records is a shorter range
+	var ends []int
+	for off := 0; off < buf.Len(); {
+		// a key and a value each with its length
+		for i := 0; i < 2; i++ {
+			off += 4 + int(binary.LittleEndian.Uint32(buf.Bytes()[off:]))
+		}
+		ends = append(ends, off)
+	}
+	for n := 0; n < buf.Len(); n++ {
+		entries, err := readRange(buf.Bytes()[:n])
+		boundary := n == 0
+		for i, end := range ends {
+			if n == end {
+				boundary = true
+				if len(entries) != i+1 {
+					t.Fatalf("cut after %d records: read %d", i+1, len(entries))
+				}
+			}
+		}
+		if boundary != (err == nil) || !boundary && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("cut at %d of %d bytes: %v", n, buf.Len(), err)
+		}
+	}
+
+	var empty bytes.Buffer
+	if err := db.RangeBinary("x", "z", &empty); err != nil || empty.Len() != 0 {
+		t.Fatalf("empty range wrote %d bytes, %v", empty.Len(), err)
+	}
+	if err := db.RangeBinary("k0", "k9", failingWriter{}); !errors.Is(err, errInjected) {
+		t.Fatalf("range to a failing writer: %v, want its error", err)
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import "os"
+
+// pinTables hold the tables of the indexes for a reader until unpinTables, a table merged away meanwhile
+// stays on disk until its last reader is done, caller must hold the lock
+func (t *MEMSSTable) pinTables(indexes []*SparseIndex) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	t.refLock.Lock()
+	defer t.refLock.Unlock()
+	for _, index := range indexes {
+		if seen[index.TableName] {
+			continue
+		}
+		seen[index.TableName] = true
+		t.readerRefs[index.TableName]++
+		names = append(names, index.TableName)
+	}
+	return names
+}
+
+// unpinTables release the tables of a reader, the last reader of a table merged away removes it
+func (t *MEMSSTable) unpinTables(names []string) error {
+	removed := make([]string, 0)
+	t.refLock.Lock()
+	for _, name := range names {
+		t.readerRefs[name]--
+		if t.readerRefs[name] > 0 {
+			continue
+		}
+		delete(t.readerRefs, name)
+		if t.retired[name] {
+			delete(t.retired, name)
+			removed = append(removed, name)
+		}
+	}
+	t.refLock.Unlock()
+	if len(removed) == 0 {
+		return nil
+	}
+
+	// the value log segments only these tables pointed into are removed by the next compaction
+	t.lock.Lock()
+	for _, name := range removed {
+		delete(t.vlogRefs, name)
+	}
+	t.lock.Unlock()
+	return t.removeTableFiles(removed)
+}
+
+// retireTables drop the filters of tables taken out of the sparse index and return the ones no reader holds,
+// which can be removed now, the others are removed by their last reader, caller must hold the lock
+func (t *MEMSSTable) retireTables(names []string) []string {
+	removed := make([]string, 0, len(names))
+	t.refLock.Lock()
+	defer t.refLock.Unlock()
+	for _, name := range names {
+		delete(t.prefixFilters, name)
+		// the value pointers of a table still read keep its value log segments
+		if t.readerRefs[name] > 0 {
+			t.retired[name] = true
+			continue
+		}
+		delete(t.vlogRefs, name)
+		removed = append(removed, name)
+	}
+	return removed
+}
+
+// removeTableFiles remove the files of tables out of the sparse index
+func (t *MEMSSTable) removeTableFiles(names []string) error {
+	for _, name := range names {
+		t.countRemoved(name)
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+		t.unmapTable(name)
+		t.uncacheTable(name)
+	}
+	return nil
+}
+
+// removeRetiredTables remove the tables merged away while a reader still held them, on close the readers
+// are done whether they were closed or not
+func (t *MEMSSTable) removeRetiredTables() error {
+	t.refLock.Lock()
+	removed := make([]string, 0, len(t.retired))
+	for name := range t.retired {
+		removed = append(removed, name)
+		delete(t.retired, name)
+	}
+	t.refLock.Unlock()
+	return t.removeTableFiles(removed)
+}
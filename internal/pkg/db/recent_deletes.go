@@ -0,0 +1,84 @@
+package db
+
+import (
+	"container/list"
+	"sync"
+)
+
+// recentDeletes is a LRU set of keys whose newest command is a delete, a nil set holds nothing
+type recentDeletes struct {
+	lock  sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newRecentDeletes(size int) *recentDeletes {
+	return &recentDeletes{size: size, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (s *recentDeletes) has(key string) bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.items[key]
+	if ok {
+		s.ll.MoveToFront(e)
+	}
+	return ok
+}
+
+func (s *recentDeletes) add(key string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.ll.MoveToFront(e)
+		return
+	}
+	s.items[key] = s.ll.PushFront(key)
+	if s.ll.Len() > s.size {
+		e := s.ll.Back()
+		s.ll.Remove(e)
+		delete(s.items, e.Value.(string))
+	}
+}
+
+func (s *recentDeletes) remove(key string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+func (s *recentDeletes) reset() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.ll.Init()
+	s.items = make(map[string]*list.Element)
+	s.lock.Unlock()
+}
+
+// EnableRecentDeletes remember the size most recently deleted keys in memory, so Query and Lookup of them
+// are not found without looking up the tables, a key is dropped from the set when it is written again,
+// 0 disables the set
+func (t *MEMSSTable) EnableRecentDeletes(size int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if size <= 0 {
+		t.recentDeletes = nil
+		return
+	}
+	t.recentDeletes = newRecentDeletes(size)
+}
@@ -0,0 +1,57 @@
+package db
+
+import "testing"
+
+func TestRecentDeletes(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		mustSet(t, db, key, key)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.EnableRecentDeletes(2)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustSet(t, db, "x", "x")
+	// the tombstones are on disk
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	m := &fakeMetrics{counts: make(map[string]int)}
+	db.SetMetrics(m)
+	expectReads := func(what string, want int) {
+		t.Helper()
+		if n := m.take()[MetricBlockRead]; n != want {
+			t.Fatalf("%s: %d block reads, want %d", what, n, want)
+		}
+	}
+
+	expectNotFound(t, db, "c")
+	expectReads("query of a recently deleted key", 0)
+	if _, ok, err := db.Lookup("b"); ok || err != nil {
+		t.Fatalf("lookup of a recently deleted key: %v, %v", ok, err)
+	}
+	expectReads("lookup of a recently deleted key", 0)
+	// the set holds two keys, the tombstone of the oldest is read from disk
+	expectNotFound(t, db, "a")
+	expectReads("query of a deleted key out of the set", 1)
+
+	// a newer set drops the key from the set
+	mustSet(t, db, "c", "again")
+	expectValue(t, db, "c", "again")
+	if err := db.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	m.take()
+	expectNotFound(t, db, "c")
+	expectReads("query of a key deleted again", 0)
+
+	db.EnableRecentDeletes(0)
+	expectNotFound(t, db, "b")
+	expectReads("query with the set disabled", 1)
+}
@@ -0,0 +1,34 @@
+package db
+
+// Rename move the value of oldKey to newKey, the set of newKey and the delete of oldKey are one
+// wal record so a crash keeps both or neither, ErrKeyNotFound if oldKey is missing or deleted
+func (t *MEMSSTable) Rename(oldKey, newKey string) error {
+	if err := checkRootKeys(oldKey, newKey); err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.waitWriteStall(); err != nil {
+		return err
+	}
+
+	v, err := t.getLocked(oldKey)
+	if err != nil {
+		return err
+	}
+	if v.Command == CommandTypeDelete {
+		return ErrKeyNotFound
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	val, err := t.value(v)
+	if err != nil {
+		return err
+	}
+
+	b := NewBatch()
+	b.Set(newKey, val)
+	b.Delete(oldKey)
+	return t.writeLocked(b)
+}
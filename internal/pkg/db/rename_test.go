@@ -0,0 +1,62 @@
+package db
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRename(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	mustSet(t, db, "old", "v")
+	mustSet(t, db, "x", "x")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Rename("old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "new", "v")
+	expectNotFound(t, db, "old")
+	for _, key := range []string{"old", "missing"} {
+		if err := db.Rename(key, "other"); err != ErrKeyNotFound {
+			t.Fatalf("rename of %s: %v, want ErrKeyNotFound", key, err)
+		}
+	}
+	if err := db.Rename("new", "new"); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "new", "v")
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectValue(t, db, "new", "v")
+	expectNotFound(t, db, "old")
+}
+
+func TestRenameTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 100, 1)
+	mustSet(t, db, "old", "v")
+	db.lock.RLock()
+	filename := db.wal.filename
+	db.lock.RUnlock()
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Rename("old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, db)
+
+	// the crash tore the rename record, neither the set nor the delete is replayed
+	if err := os.Truncate(filename, fi.Size()+8); err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDB(t, dir, 100, 1)
+	defer db.Close()
+	expectValue(t, db, "old", "v")
+	expectNotFound(t, db, "new")
+}
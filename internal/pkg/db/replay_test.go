@@ -0,0 +1,82 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDoubleReplay(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 100, 10)
+	mustSet(t, db, "a", "1")
+	mustSet(t, db, "b", "2")
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	seq := db.LastSequence()
+	filename := db.wal.filename
+	crash(t, db)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a stop after the flush and before the wal rotation leaves the flushed commands in the wal
+	stopAfterFlush := func() {
+		t.Helper()
+		names, err := filepath.Glob(dir + "/*.wal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if err := os.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filename, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db = openTestDB(t, dir, 100, 10)
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, db)
+	// the same wal is replayed twice over the flushed table
+	for i := 0; i < 2; i++ {
+		stopAfterFlush()
+		db = openTestDB(t, dir, 100, 10)
+		expectNotFound(t, db, "a")
+		expectValue(t, db, "b", "2")
+		db.lock.RLock()
+		empty := db.activeTable.Len() == 0 && len(db.immutable) == 0
+		db.lock.RUnlock()
+		if !empty || db.LastSequence() != seq {
+			t.Fatalf("replay %d: empty memory %v, sequence %d, want the flushed commands skipped at %d", i, empty, db.LastSequence(), seq)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(tableFiles(t, dir)); n != 1 {
+			t.Fatalf("replay %d: %d tables, want the flushed commands not flushed again", i, n)
+		}
+		crash(t, db)
+	}
+
+	// with the wal lost, new writes follow the disk tables and are not skipped by the next replay
+	stopAfterFlush()
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDB(t, dir, 100, 10)
+	if db.LastSequence() != seq {
+		t.Fatalf("sequence %d without a wal, want %d of the disk tables", db.LastSequence(), seq)
+	}
+	mustSet(t, db, "c", "3")
+	crash(t, db)
+	db = openTestDB(t, dir, 100, 10)
+	defer db.Close()
+	expectValue(t, db, "b", "2")
+	expectValue(t, db, "c", "3")
+}
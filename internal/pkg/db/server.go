@@ -1,42 +1,102 @@
 package db
 
 import (
-	"log"
 	"os"
 	"path"
+	"sort"
 )
 
 const BlockKeyNum uint16 = 512  // each block contains N keys
 const TableBlockNum uint16 = 64 // each table contains N blocks
 
+// DB is the database served by the http handlers, the main opens it, so importing the package
+// neither creates ./data nor takes its file lock
 var DB *MEMSSTable
 
-func init() {
-	var err error
-	DB, err = NewMEMSSTable("./data", BlockKeyNum, TableBlockNum)
+// OpenOptions is the settings Open applies before it loads the root path
+type OpenOptions struct {
+	StrictLoad bool // check the sparse index of every table Open loads, as SetStrictLoad does for later loads
+}
+
+// Open create a MEMSSTable on rootPath and restore the wal and disk tables in it
+func Open(rootPath string, blockKeyNum, tableBlockNum uint16) (*MEMSSTable, error) {
+	return OpenWithOptions(rootPath, blockKeyNum, tableBlockNum, OpenOptions{})
+}
+
+// OpenWithOptions is Open with the options set before the tables are loaded, a failed open releases
+// the wal and the file lock, so the database can be opened again
+func OpenWithOptions(rootPath string, blockKeyNum, tableBlockNum uint16, opts OpenOptions) (_ *MEMSSTable, err error) {
+	t, err := NewMEMSSTable(rootPath, blockKeyNum, tableBlockNum)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	var w *wal
+	defer func() {
+		if err == nil {
+			return
+		}
+		if w != nil && w != t.wal {
+			w.Close()
+		}
+		t.wal.Close()
+		unlockFile(t.fileLock)
+	}()
+	t.strictLoad = opts.StrictLoad
+	// tables are loaded first, so a replayed command already flushed to a table is skipped
+	if err = loadSparseIndex(t); err != nil {
+		return nil, err
+	}
+	var walFiles []string
+	if walFiles, w, err = restoreWAL(t); err != nil {
+		return nil, err
 	}
-	if err := restoreWAL(); err != nil {
-		log.Fatal(err)
+
+	// a single wal written by rotation holds every restored command and is written on, otherwise the restored
+	// commands are written to a new wal, so the restored files are not replayed again
+	t.lock.Lock()
+	t.recovered = !t.isEmpty()
+	// the sequence number never goes back to the disk tables, even if the wal holding it is lost,
+	// then the wal does not match the sequence number and is rotated
+	if t.seq < t.diskSeq {
+		t.seq = t.diskSeq
+		if w != nil {
+			w.Close()
+			w = nil
+		}
+	}
+	if w != nil {
+		err = t.reuseWAL(w)
+	} else {
+		err = t.rotateWAL()
+	}
+	t.lock.Unlock()
+	if err != nil {
+		return nil, err
 	}
-	if err := loadSparseIndex(); err != nil {
-		log.Fatal(err)
+	for _, name := range walFiles {
+		if w != nil && name == w.filename {
+			continue
+		}
+		if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
 	}
+	return t, nil
 }
 
-func loadSparseIndex() error {
-	fs, err := os.ReadDir("./data")
+func loadSparseIndex(t *MEMSSTable) error {
+	fs, err := os.ReadDir(t.rootPath)
 	if err != nil {
 		return err
 	}
 	for _, f := range fs {
 		if path.Ext(f.Name()) == ".sdb" {
-			sf, err := os.Open("./data/" + f.Name())
+			sf, err := os.Open(t.rootPath + "/" + f.Name())
 			if err != nil {
 				return err
 			}
-			if err := DB.LoadFromDiskTable(sf); err != nil {
+			if err := t.LoadFromDiskTable(sf); err != nil {
+				sf.Close()
 				return err
 			}
 			sf.Close()
@@ -46,23 +106,57 @@ func loadSparseIndex() error {
 	return nil
 }
 
-func restoreWAL() error {
-	fs, err := os.ReadDir("./data")
+// restoreWAL replay wal files from the oldest to the newest, and return their names, if only one wal
+// starting with the sequence number is replayed it is returned open to append after its complete records
+func restoreWAL(t *MEMSSTable) ([]string, *wal, error) {
+	fs, err := os.ReadDir(t.rootPath)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	names := make([]string, 0)
 	for _, f := range fs {
 		if path.Ext(f.Name()) == ".wal" {
-			sf, err := os.Open("./data/" + f.Name())
-			if err != nil {
-				return err
-			}
-			if err := DB.LoadFromWAL(sf); err != nil {
-				return err
-			}
+			names = append(names, t.rootPath+"/"+f.Name())
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		idi, _ := walID(names[i])
+		idj, _ := walID(names[j])
+		return idi < idj
+	})
+	// a wal starting with the sequence number is written by rotation, it holds all commands not on disk,
+	// the older wals are left by a crash before they were removed
+	start := 0
+	for i := range names {
+		if walHasSequence(names[i]) {
+			start = i
+		}
+	}
+	var end int64
+	for _, name := range names[start:] {
+		sf, err := os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if end, err = t.loadWAL(sf); err != nil {
 			sf.Close()
+			return nil, nil, err
 		}
+		sf.Close()
+		// the new wal must not reuse the name of a restored one
+		t.lock.Lock()
+		if id, ok := walID(name); ok && id >= t.id {
+			t.id = id + 1
+		}
+		t.lock.Unlock()
 	}
 
-	return nil
+	if len(names) == 0 || len(names[start:]) != 1 || names[start] == t.wal.filename || !walHasSequence(names[start]) {
+		return names, nil, nil
+	}
+	w, err := openWAL(names[start], end)
+	if err != nil {
+		return nil, nil, err
+	}
+	return names, w, nil
 }
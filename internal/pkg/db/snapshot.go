@@ -0,0 +1,88 @@
+package db
+
+import "sync"
+
+// Snapshot is the set of disk tables at one point, the tables are kept on disk until Release, so a
+// backup can copy them while the database keeps writing, flushing and compacting other tables
+type Snapshot struct {
+	db      *MEMSSTable
+	seq     uint64
+	tables  []TableInfo
+	reserve []*tableIndex
+	once    sync.Once
+}
+
+// Snapshot flush memory data and take the current disk tables, they hold every command up to Seq,
+// a compaction waits for or skips the tables until Release, which must be called
+func (t *MEMSSTable) Snapshot() (*Snapshot, error) {
+	if err := t.Flush(); err != nil {
+		return nil, err
+	}
+
+	t.lock.Lock()
+	var tables []*tableIndex
+	for {
+		tables = groupSparseIndex(t.sparseIndex)
+		if !t.snapshotBusy(tables) {
+			break
+		}
+		t.compactCond.Wait()
+	}
+	for _, table := range tables {
+		// a table already held by another snapshot is reserved once
+		if t.snapshotRefs[table.name] == 0 {
+			t.compacting[table.name] = true
+		}
+		t.snapshotRefs[table.name]++
+	}
+	s := &Snapshot{db: t, seq: t.firstMemorySeq() - 1, reserve: tables}
+	t.lock.Unlock()
+
+	// the tables are reserved, so no compaction removes a file while it is read
+	var err error
+	if s.tables, err = loadTableInfos(tables); err != nil {
+		s.Release()
+		return nil, err
+	}
+	return s, nil
+}
+
+// snapshotBusy report whether a table is reserved by a compaction, a table held only by snapshots can be
+// taken again, caller must hold the lock
+func (t *MEMSSTable) snapshotBusy(tables []*tableIndex) bool {
+	for _, table := range tables {
+		if t.compacting[table.name] && t.snapshotRefs[table.name] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Seq return the sequence number of the last command in the tables of the snapshot
+func (s *Snapshot) Seq() uint64 {
+	return s.seq
+}
+
+// Tables return the disk tables of the snapshot oldest first, tables created after it are not included
+func (s *Snapshot) Tables() []TableInfo {
+	tables := make([]TableInfo, len(s.tables))
+	copy(tables, s.tables)
+	return tables
+}
+
+// Release let compactions merge and remove the tables of the snapshot, it is safe to call more than once
+func (s *Snapshot) Release() {
+	s.once.Do(func() {
+		t := s.db
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		for _, table := range s.reserve {
+			t.snapshotRefs[table.name]--
+			if t.snapshotRefs[table.name] == 0 {
+				delete(t.snapshotRefs, table.name)
+				delete(t.compacting, table.name)
+			}
+		}
+		t.compactCond.Broadcast()
+	})
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	for i := 0; i < 4; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), "old")
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "memory", "old")
+	// the memory tables are flushed into the snapshot
+	s, err := db.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+	if s.Seq() != db.LastSequence() || s.Seq() != 5 {
+		t.Fatalf("snapshot at %d, last sequence %d, want 5", s.Seq(), db.LastSequence())
+	}
+	tables := s.Tables()
+	names := make(map[string]bool)
+	for _, info := range tables {
+		names[info.Name] = true
+	}
+	if len(tables) != len(tableFiles(t, dir)) {
+		t.Fatalf("%d tables in the snapshot, %d files", len(tables), len(tableFiles(t, dir)))
+	}
+
+	// later flushes and compactions do not change the snapshot and do not remove its tables
+	for i := 0; i < 4; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), "new")
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Compact(CompactionOptions{MinThreshold: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Tables(); len(got) != len(tables) {
+		t.Fatalf("snapshot holds %d tables, want %d", len(got), len(tables))
+	}
+	for _, name := range tableFiles(t, dir) {
+		delete(names, filepath.Base(name))
+	}
+	if len(names) != 0 {
+		t.Fatalf("tables of the snapshot removed: %v", names)
+	}
+	if len(tableFiles(t, dir)) <= len(tables) {
+		t.Fatal("no table written after the snapshot")
+	}
+
+	// a copy of the snapshot tables is the database as of the snapshot
+	backup := t.TempDir()
+	for _, info := range s.Tables() {
+		data, err := os.ReadFile(filepath.Join(dir, info.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(backup, info.Name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restored := openTestDB(t, backup, 2, 1)
+	defer restored.Close()
+	for i := 0; i < 4; i++ {
+		expectValue(t, restored, fmt.Sprintf("k%d", i), "old")
+		expectValue(t, db, fmt.Sprintf("k%d", i), "new")
+	}
+	expectValue(t, restored, "memory", "old")
+
+	// released, the tables are merged away
+	s.Release()
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	if files := tableFiles(t, dir); len(files) != 1 {
+		t.Fatalf("%d tables after releasing the snapshot and a major compaction", len(files))
+	}
+}
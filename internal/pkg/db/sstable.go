@@ -3,13 +3,16 @@ package db
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"io"
 	"sort"
 )
 
 type SSTable struct {
-	data CommandData
+	data    CommandData
+	sorted  bool           // data is ordered by key, query can use binary search
+	keys    map[string]int // position of each key for Put, nil until Put is used
+	seq     uint64         // sequence number of the last command when the table became immutable
+	dropped uint64         // sequence number of the newest command which replaced another by Put
 }
 
 func NewSSTable() *SSTable {
@@ -18,10 +21,56 @@ func NewSSTable() *SSTable {
 
 func (t *SSTable) Append(c *Command) {
 	t.data = append(t.data, c)
+	t.sorted = false
+	t.keys = nil
 }
 
-func (t *SSTable) Query(key string) *Command {
+// Put replace the command of the same key in place or append it, so the table holds one command per key
+func (t *SSTable) Put(c *Command) {
+	t.indexKeys()
+	if i, ok := t.keys[c.Key]; ok {
+		t.data[i] = c
+		if c.seq > t.dropped {
+			t.dropped = c.seq
+		}
+		return
+	}
+	t.keys[c.Key] = len(t.data)
+	t.data = append(t.data, c)
+	t.sorted = false
+}
+
+// hasKey report whether the table holds a command of the key, for a table written by Put
+func (t *SSTable) hasKey(key string) bool {
+	t.indexKeys()
+	_, ok := t.keys[key]
+	return ok
+}
+
+// indexKeys build the position of each key, the last command of a key wins
+func (t *SSTable) indexKeys() {
+	if t.keys != nil {
+		return
+	}
+	t.keys = make(map[string]int, len(t.data))
 	for i := range t.data {
+		t.keys[t.data[i].Key] = i
+	}
+}
+
+// Query return the latest command of the key, later appended command wins
+func (t *SSTable) Query(key string) *Command {
+	if t.sorted {
+		// the same key keeps append order after sort, so the last one is the latest
+		i := sort.Search(len(t.data), func(i int) bool {
+			return t.data[i].Key > key
+		}) - 1
+		if i >= 0 && t.data[i].Key == key {
+			return t.data[i]
+		}
+		return nil
+	}
+	for i := len(t.data) - 1; i >= 0; i-- {
 		if t.data[i].Key == key {
 			return t.data[i]
 		}
@@ -29,8 +78,36 @@ func (t *SSTable) Query(key string) *Command {
 	return nil
 }
 
+// queryAt return the latest command of the key whose sequence number is not after seq, a command
+// restored from a table before version 7 has none and is always visible
+func (t *SSTable) queryAt(key string, seq uint64) *Command {
+	if t.sorted {
+		i := sort.Search(len(t.data), func(i int) bool {
+			return t.data[i].Key > key
+		}) - 1
+		for ; i >= 0 && t.data[i].Key == key; i-- {
+			if t.data[i].seq <= seq {
+				return t.data[i]
+			}
+		}
+		return nil
+	}
+	for i := len(t.data) - 1; i >= 0; i-- {
+		if t.data[i].Key == key && t.data[i].seq <= seq {
+			return t.data[i]
+		}
+	}
+	return nil
+}
+
+// Sort order commands by key, keep the append order of the same key, a sorted table is not sorted again
 func (t *SSTable) Sort() {
-	sort.Sort(t.data)
+	if t.sorted {
+		return
+	}
+	sort.Stable(t.data)
+	t.sorted = true
+	t.keys = nil
 }
 
 func (t *SSTable) Len() int {
@@ -40,7 +117,7 @@ func (t *SSTable) Len() int {
 func (t *SSTable) Bytes() (int, []byte) {
 	buf := bytes.NewBuffer(nil)
 	for i := 0; i < len(t.data); i++ {
-		n, body := t.data[i].Bytes()
+		n, body := t.data[i].tableBytes()
 		binary.Write(buf, binary.LittleEndian, uint32(n))
 		buf.Write(body)
 	}
@@ -60,9 +137,40 @@ func (t *SSTable) Restore(data []byte) error {
 		cmd := new(Command)
 		cmd.Restore(buf.Next(int(n)))
 		t.data = append(t.data, cmd)
-		fmt.Printf("SSTable.Restore: %+v\n", cmd)
 	}
 	buf = nil
+	// blocks are sorted before written to disk
+	t.sorted = true
 
 	return nil
 }
+
+// restoreKeys parse the key and command type of each command in block data without copying values
+func restoreKeys(data []byte, fn func(key string, typ CommandType)) {
+	for len(data) >= 4 {
+		n := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		if n > len(data) || n < 5 {
+			return
+		}
+		cmd := data[:n]
+		data = data[n:]
+		keyLength := int(binary.LittleEndian.Uint32(cmd[1:]))
+		if 5+keyLength > len(cmd) {
+			return
+		}
+		fn(string(cmd[5:5+keyLength]), CommandType(cmd[0])&^commandFlags)
+	}
+}
+
+// without return a new table without commands of the key
+func (t *SSTable) without(key string) *SSTable {
+	table := NewSSTable()
+	for i := range t.data {
+		if t.data[i].Key != key {
+			table.Append(t.data[i])
+		}
+	}
+	table.sorted = t.sorted
+	return table
+}
@@ -7,69 +7,261 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pierrec/lz4"
 )
 
+var ErrDiskKeyNotFound = errors.New("key not exists in DiskSSTable")
+
+// blockRawFlag mark a block stored without compression in the block length
+const blockRawFlag uint32 = 1 << 31
+
 type DiskSSTable struct {
 	filename string
 	Blocks   map[uint32]*SSTable
+	mapped   []byte // the file mapped into memory, blocks are sliced from it instead of read
+	metrics  Metrics
 }
 
 func NewDiskSSTable(filename string) (*DiskSSTable, error) {
-	return &DiskSSTable{filename, map[uint32]*SSTable{}}, nil
+	return &DiskSSTable{filename: filename, Blocks: map[uint32]*SSTable{}}, nil
 }
 
+// Query return the newest command of key in the block, a prefix compressed block not loaded yet
+// is searched by its restart keys without restoring all commands
 func (t *DiskSSTable) Query(blockIndex uint32, seek uint32, key string) (*Command, error) {
 	if t.Blocks[blockIndex] == nil {
-		if err := t.LoadBlock(blockIndex, seek); err != nil {
+		data, prefix, err := t.readBlock(blockIndex, seek)
+		if err != nil {
+			return nil, err
+		}
+		if prefix {
+			b, err := newPrefixBlock(data)
+			if err != nil {
+				return nil, err
+			}
+			v, err := b.query(key)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, ErrDiskKeyNotFound
+			}
+			return v, nil
+		}
+		block, err := restoreBlock(data, false)
+		if err != nil {
 			return nil, err
 		}
+		t.Blocks[blockIndex] = block
 	}
 	if v := t.Blocks[blockIndex].Query(key); v != nil {
 		return v, nil
 	}
 
-	return nil, errors.New("key not exists in DiskSSTable")
+	return nil, ErrDiskKeyNotFound
 }
 
 func (t *DiskSSTable) LoadBlock(blockIndex uint32, seek uint32) error {
-	f, err := os.Open(t.filename)
+	data, prefix, err := t.readBlock(blockIndex, seek)
 	if err != nil {
 		return err
 	}
+	block, err := restoreBlock(data, prefix)
+	if err != nil {
+		return err
+	}
+	t.Blocks[blockIndex] = block
+	return nil
+}
+
+// readBlock read the block data at seek, decompress it unless the block is raw, prefix reports whether
+// its keys are prefix compressed
+func (t *DiskSSTable) readBlock(blockIndex uint32, seek uint32) (data []byte, prefix bool, err error) {
+	var n uint32
+	start := time.Now()
+	if t.mapped != nil {
+		data, n, err = t.sliceBlock(seek)
+	} else {
+		data, n, err = t.fileBlock(seek)
+	}
+	observe(t.metrics, MetricBlockRead, start)
+	if err != nil || data == nil {
+		return nil, false, err
+	}
+	prefix = n&blockPrefixFlag != 0
+	if n&blockRawFlag != 0 {
+		return data, prefix, nil
+	}
+
+	// decompress
+	start = time.Now()
+	defer observe(t.metrics, MetricBlockDecompress, start)
+	lz4buf := bytes.NewBuffer(data)
+	lz4r := lz4.NewReader(lz4buf)
+	unData := bytes.NewBuffer(nil)
+	if _, err := io.Copy(unData, lz4r); err != nil {
+		return nil, false, err
+	}
+	return unData.Bytes(), prefix, nil
+}
+
+// fileBlock read the block at seek from the file, return its data and its length with flags,
+// nil data at the end of the file
+func (t *DiskSSTable) fileBlock(seek uint32) ([]byte, uint32, error) {
+	f, err := os.Open(t.filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
 	f.Seek(int64(seek), io.SeekStart)
 	var n uint32
 	if err = binary.Read(f, binary.LittleEndian, &n); err != nil {
 		if err == io.EOF {
-			return nil
+			return nil, 0, nil
 		}
-		return err
+		return nil, 0, err
 	}
-	data := make([]byte, int(n))
+	l := n &^ blockFlags
+	data := make([]byte, int(l))
 	nn, err := f.Read(data)
 	if err != nil {
 		if err == io.EOF {
-			return nil
+			return nil, 0, nil
 		}
-		return err
+		return nil, 0, err
 	}
-	if nn != int(n) {
-		return fmt.Errorf("DiskSSTable.LoadBlock error: data length mismatch %d, %d", n, nn)
+	if nn != int(l) {
+		return nil, 0, fmt.Errorf("DiskSSTable.LoadBlock error: data length mismatch %d, %d", l, nn)
 	}
+	return data, n, nil
+}
 
-	// decompress
-	lz4buf := bytes.NewBuffer(data)
-	lz4r := lz4.NewReader(lz4buf)
-	unData := bytes.NewBuffer(nil)
-	nnn, err := io.Copy(unData, lz4r)
-	fmt.Println(blockIndex, seek, n, nn, nnn, err)
-	block := NewSSTable()
-	if err := block.Restore(unData.Bytes()); err != nil {
+// sliceBlock slice the block at seek from the mapped file like fileBlock, the data is only valid
+// while the file is mapped
+func (t *DiskSSTable) sliceBlock(seek uint32) ([]byte, uint32, error) {
+	if uint64(seek)+4 > uint64(len(t.mapped)) {
+		return nil, 0, nil
+	}
+	n := binary.LittleEndian.Uint32(t.mapped[seek:])
+	start := uint64(seek) + 4
+	end := start + uint64(n&^blockFlags)
+	if end > uint64(len(t.mapped)) {
+		return nil, 0, fmt.Errorf("DiskSSTable.LoadBlock error: data length mismatch %d, %d", end-start, uint64(len(t.mapped))-start)
+	}
+	return t.mapped[start:end], n, nil
+}
+
+// KeyRange return the smallest and the largest key of the table from its meta info, a table written
+// before meta info version 3 has no range stored and all its blocks are read
+func (t *DiskSSTable) KeyRange() (first, last string, err error) {
+	f, err := os.Open(t.filename)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	metaInfo, sparseIndex, err := readSparseIndex(f)
+	if err != nil {
+		return "", "", err
+	}
+	if metaInfo.Version >= 3 {
+		return metaInfo.FirstKey, metaInfo.LastKey, nil
+	}
+	empty := true
+	for _, index := range sparseIndex {
+		if err := t.LoadBlock(index.BlockIndex, index.DataStart); err != nil {
+			return "", "", err
+		}
+		block := t.Blocks[index.BlockIndex]
+		if block.Len() == 0 {
+			continue
+		}
+		if empty || block.data[0].Key < first {
+			first = block.data[0].Key
+		}
+		if empty || block.data[block.Len()-1].Key > last {
+			last = block.data[block.Len()-1].Key
+		}
+		empty = false
+	}
+	return first, last, nil
+}
+
+// Keys call fn with key and command type of each command in the block, values are skipped
+func (t *DiskSSTable) Keys(blockIndex uint32, seek uint32, fn func(key string, typ CommandType)) error {
+	data, prefix, err := t.readBlock(blockIndex, seek)
+	if err != nil {
 		return err
 	}
-	t.Blocks[blockIndex] = block
+	if !prefix {
+		restoreKeys(data, fn)
+		return nil
+	}
+	block, err := restoreBlock(data, true)
+	if err != nil {
+		return err
+	}
+	for _, c := range block.data {
+		fn(c.Key, c.Command)
+	}
+	return nil
+}
 
+// QueryFile return the newest command of key in one disk table file, it does not touch the database,
+// ErrDiskKeyNotFound if the file does not contain the key
+func QueryFile(path, key string) (*Command, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	metaInfo, _, err := readMetaInfo(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// the sparse index is not read if the key is out of the table range
+	if metaInfo.Version >= 3 && (key < metaInfo.FirstKey || key > metaInfo.LastKey) {
+		f.Close()
+		return nil, ErrDiskKeyNotFound
+	}
+	sparseIndex, err := readSparseIndexData(f, metaInfo)
 	f.Close()
-	return nil
+	if err != nil {
+		return nil, err
+	}
+
+	// blocks are written oldest first, a later block may start with a smaller key, when the
+	// first keys are sorted blocks after n start with a bigger key and can be skipped
+	n := len(sparseIndex)
+	if sort.SliceIsSorted(sparseIndex, func(i, j int) bool { return sparseIndex[i].Key < sparseIndex[j].Key }) {
+		n = sort.Search(len(sparseIndex), func(i int) bool {
+			return sparseIndex[i].Key > key
+		})
+	}
+	disk, err := NewDiskSSTable(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := n - 1; i >= 0; i-- {
+		if sparseIndex[i].Key > key {
+			continue
+		}
+		v, err := disk.Query(sparseIndex[i].BlockIndex, sparseIndex[i].DataStart, key)
+		if err == ErrDiskKeyNotFound {
+			continue
+		}
+		return v, err
+	}
+	return nil, ErrDiskKeyNotFound
+}
+
+// tableID parse the table id from the file name of a disk table
+func tableID(filename string) (uint64, bool) {
+	id, err := strconv.ParseUint(strings.TrimSuffix(path.Base(filename), ".sdb"), 10, 64)
+	return id, err == nil
 }
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestQueryFile(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 4)
+	for _, key := range []string{"b", "d", "f", "h"} {
+		mustSet(t, db, key, key+"1")
+	}
+	if err := db.Delete("d"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "f", "f2")
+	mustSet(t, db, "z", "z")
+	mustSet(t, db, "y", "y")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "q", "q")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	files := tableFiles(t, dir)
+	if len(files) != 2 {
+		t.Fatalf("%d tables, want 2", len(files))
+	}
+
+	for _, c := range []struct {
+		key, val string
+		typ      CommandType
+	}{{"b", "b1", CommandTypeSet}, {"f", "f2", CommandTypeSet}, {"d", "", CommandTypeDelete}} {
+		v, err := QueryFile(files[0], c.key)
+		if err != nil {
+			t.Fatalf("query %s: %v", c.key, err)
+		}
+		if v.Key != c.key || v.Value != c.val || v.Command != c.typ {
+			t.Fatalf("query %s: got %+v", c.key, v)
+		}
+	}
+	// c is in the range of the first file, q is only in the second
+	for _, key := range []string{"c", "a", "q"} {
+		if _, err := QueryFile(files[0], key); err != ErrDiskKeyNotFound {
+			t.Fatalf("query %s: %v, want ErrDiskKeyNotFound", key, err)
+		}
+	}
+	if v, err := QueryFile(files[1], "q"); err != nil || v.Value != "q" {
+		t.Fatalf("query q in the second file: %+v, %v", v, err)
+	}
+	if _, err := QueryFile(dir+"/missing.sdb", "b"); err == nil {
+		t.Fatal("query of a missing file succeeded")
+	}
+}
+
+// blockHeads return the length word of each block of the table file
+func blockHeads(t *testing.T, filename string) []uint32 {
+	t.Helper()
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, sparseIndex, err := readSparseIndex(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heads := make([]uint32, 0, len(sparseIndex))
+	for _, index := range sparseIndex {
+		head := make([]byte, 4)
+		if _, err := f.ReadAt(head, int64(index.DataStart)); err != nil {
+			t.Fatal(err)
+		}
+		heads = append(heads, binary.LittleEndian.Uint32(head))
+	}
+	return heads
+}
+
+func TestRawBlocks(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 2)
+	defer db.Close()
+	r := rand.New(rand.NewSource(1))
+	random := make(map[string]string)
+	for _, key := range []string{"r1", "r2"} {
+		val := make([]byte, 64)
+		r.Read(val)
+		random[key] = string(val)
+		mustSet(t, db, key, random[key])
+	}
+	// the second block compresses
+	mustSet(t, db, "s1", strings.Repeat("s", 200))
+	mustSet(t, db, "s2", strings.Repeat("s", 200))
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	files := tableFiles(t, dir)
+	heads := blockHeads(t, files[0])
+	if len(heads) != 2 || heads[0]&blockRawFlag == 0 || heads[1]&blockRawFlag != 0 {
+		t.Fatalf("block heads %x, want the random block raw and the other compressed", heads)
+	}
+	for key, val := range random {
+		expectValue(t, db, key, val)
+		if v, err := QueryFile(files[0], key); err != nil || v.Value != val {
+			t.Fatalf("query %s from the file: %v", key, err)
+		}
+	}
+	expectValue(t, db, "s1", strings.Repeat("s", 200))
+	report, err := db.VerifyIntegrity()
+	if err != nil || len(report.Problems) != 0 {
+		t.Fatalf("verify: %+v, %v", report, err)
+	}
+}
+
+// flushDisjoint flush one table for each group of keys and return the table files
+func flushDisjoint(t *testing.T, db *MEMSSTable, dir string, groups ...[]string) []string {
+	t.Helper()
+	for _, keys := range groups {
+		for _, key := range keys {
+			mustSet(t, db, key, key)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := tableFiles(t, dir)
+	if len(files) != len(groups) {
+		t.Fatalf("%d tables, want %d", len(files), len(groups))
+	}
+	return files
+}
+
+func TestKeyRangePrunesRange(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	files := flushDisjoint(t, db, dir, []string{"b", "a"}, []string{"n", "m"}, []string{"y", "x"})
+	for i, want := range [][2]string{{"a", "b"}, {"m", "n"}, {"x", "y"}} {
+		disk, err := NewDiskSSTable(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, last, err := disk.KeyRange()
+		if err != nil || first != want[0] || last != want[1] {
+			t.Fatalf("key range of %s: %q, %q, %v, want %v", files[i], first, last, err, want)
+		}
+	}
+
+	// a scan reading the other tables would fail now
+	for _, i := range []int{0, 2} {
+		if err := os.Remove(files[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectEntries(t, db.Range("c", "w"), []string{"m=m", "n=n"})
+	expectEntries(t, db.Range("m", "n"), []string{"m=m"})
+}
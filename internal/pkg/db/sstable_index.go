@@ -3,13 +3,51 @@ package db
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
+	"os"
+	"sort"
 )
 
 type SparseIndex struct {
-	Key        string // key name
-	DataStart  uint32 // data start position in table
-	BlockIndex uint32 // which block contains the key
-	TableName  string //  which table contains the block
+	Key         string // key name
+	DataStart   uint32 // data start position in table
+	BlockIndex  uint32 // which block contains the key
+	TableName   string //  which table contains the block
+	TableSeq    uint64 // creation sequence of the table
+	TableFirst  string // smallest key of the table, both empty if unknown
+	TableLast   string // largest key of the table
+	TableMinSeq uint64 // smallest sequence number of the commands in the table, both 0 if unknown
+	TableMaxSeq uint64 // largest sequence number of the commands in the table
+}
+
+// setTableRange take the key range and the sequence range of the table from its meta info, tables
+// before version 3 have no key range and before version 7 no sequence range
+func (t *SparseIndex) setTableRange(metaInfo *SSTableMetaInfo) {
+	if metaInfo.Version >= 3 {
+		t.TableFirst = metaInfo.FirstKey
+		t.TableLast = metaInfo.LastKey
+	}
+	if metaInfo.Version >= 7 {
+		t.TableMinSeq = metaInfo.MinSeq
+		t.TableMaxSeq = metaInfo.MaxSeq
+	}
+}
+
+// tableMayContain report whether the table of the block may hold the key, a table with unknown range always may
+func (t *SparseIndex) tableMayContain(key string) bool {
+	if t.TableFirst == "" && t.TableLast == "" {
+		return true
+	}
+	return t.TableFirst <= key && key <= t.TableLast
+}
+
+// tableOverlaps report whether the table of the block may hold keys in [start, end), empty end means
+// no upper bound, a table with unknown range always may
+func (t *SparseIndex) tableOverlaps(start, end string) bool {
+	if t.TableFirst == "" && t.TableLast == "" {
+		return true
+	}
+	return t.TableLast >= start && (end == "" || t.TableFirst < end)
 }
 
 func (t *SparseIndex) Bytes() (int, []byte) {
@@ -30,3 +68,104 @@ func (t *SparseIndex) Restore(data []byte) {
 	t.Key = string(buf.Next(int(n)))
 	buf = nil
 }
+
+// tableIndex is the sparse index of one disk table
+type tableIndex struct {
+	name    string
+	seq     uint64
+	indexes []*SparseIndex
+}
+
+// groupSparseIndex group sparse index by table, keep the order of tables
+func groupSparseIndex(sparseIndex []*SparseIndex) []*tableIndex {
+	tables := make([]*tableIndex, 0)
+	seen := make(map[string]*tableIndex)
+	for _, index := range sparseIndex {
+		table, ok := seen[index.TableName]
+		if !ok {
+			table = &tableIndex{name: index.TableName, seq: index.TableSeq}
+			seen[index.TableName] = table
+			tables = append(tables, table)
+		}
+		table.indexes = append(table.indexes, index)
+	}
+	return tables
+}
+
+// loadBlocks load all blocks of the table in block order
+func (t *tableIndex) loadBlocks() ([]*SSTable, error) {
+	disk, err := NewDiskSSTable(t.name)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]*SSTable, 0, len(t.indexes))
+	for _, index := range t.indexes {
+		if err := disk.LoadBlock(index.BlockIndex, index.DataStart); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, disk.Blocks[index.BlockIndex])
+	}
+	return blocks, nil
+}
+
+// replaceTableIndex replace the sparse index of table name with the new one, caller must hold the lock
+func (t *MEMSSTable) replaceTableIndex(name string, sparseIndex []SparseIndex) {
+	indexes := make([]*SparseIndex, 0, len(t.sparseIndex))
+	for _, index := range t.sparseIndex {
+		if index.TableName != name {
+			indexes = append(indexes, index)
+		}
+	}
+	for i := range sparseIndex {
+		indexes = append(indexes, &sparseIndex[i])
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return indexes[i].TableSeq < indexes[j].TableSeq
+	})
+	t.sparseIndex = indexes
+}
+
+// readSparseIndex read meta info and sparse index of a disk table
+func readSparseIndex(f *os.File) (*SSTableMetaInfo, []*SparseIndex, error) {
+	metaInfo, _, err := readMetaInfo(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	sparseIndex, err := readSparseIndexData(f, metaInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return metaInfo, sparseIndex, nil
+}
+
+// readSparseIndexData read the sparse index of a disk table described by the meta info
+func readSparseIndexData(f *os.File, metaInfo *SSTableMetaInfo) ([]*SparseIndex, error) {
+	if id, ok := tableID(f.Name()); metaInfo.Version < 2 && ok {
+		// old table has no seq, file id has the same order
+		metaInfo.Seq = id
+	}
+
+	// restore sparse index
+	data := make([]byte, metaInfo.IndexLength)
+	if _, err := f.Seek(int64(metaInfo.IndexStart), io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	sparseIndex := make([]*SparseIndex, 0)
+	for len(data) >= 4 {
+		n := binary.LittleEndian.Uint32(data)
+		if n == 0 || int(n)+4 > len(data) {
+			break
+		}
+		index := new(SparseIndex)
+		index.Restore(data[4 : 4+n])
+		index.TableName = f.Name()
+		index.TableSeq = metaInfo.Seq
+		index.setTableRange(metaInfo)
+		sparseIndex = append(sparseIndex, index)
+		data = data[4+n:]
+	}
+	return sparseIndex, nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTableMayContain(t *testing.T) {
+	known := &SparseIndex{TableFirst: "c", TableLast: "f"}
+	unknown := &SparseIndex{}
+	for key, want := range map[string]bool{"b": false, "c": true, "d": true, "f": true, "ff": false} {
+		if got := known.tableMayContain(key); got != want {
+			t.Fatalf("[c, f] may contain %s: %v, want %v", key, got, want)
+		}
+		if !unknown.tableMayContain(key) {
+			t.Fatalf("a table of unknown range excludes %s", key)
+		}
+	}
+	for _, c := range []struct {
+		start, end string
+		want       bool
+	}{{"a", "c", false}, {"a", "d", true}, {"f", "", true}, {"g", "", false}, {"d", "e", true}} {
+		if got := known.tableOverlaps(c.start, c.end); got != c.want {
+			t.Fatalf("[c, f] overlaps [%q, %q): %v, want %v", c.start, c.end, got, c.want)
+		}
+	}
+}
+
+func TestQueryPrunesTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	files := flushDisjoint(t, db, dir, []string{"b", "a"}, []string{"n", "m"}, []string{"y", "x"})
+	// a query consulting the other tables would fail now
+	for _, i := range []int{0, 2} {
+		if err := os.Remove(files[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectValue(t, db, "m", "m")
+	expectValue(t, db, "n", "n")
+	// keys between the tables are not in any range
+	expectNotFound(t, db, "c")
+	expectNotFound(t, db, "o")
+	expectNotFound(t, db, "z")
+}
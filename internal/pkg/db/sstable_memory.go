@@ -1,28 +1,88 @@
 package db
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math"
 	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
+)
 
-	"github.com/pierrec/lz4"
+var (
+	ErrKeyNotFound    = errors.New("key not exists")
+	ErrDatabaseLocked = errors.New("database is locked by another process")
 )
 
+const lockFilename = "LOCK"
+
 type MEMSSTable struct {
 	activeTable *SSTable
 	immutable   []*SSTable
 	sparseIndex []*SparseIndex
 	wal         *wal
+	flusher     *backgroundFlusher
+	compactor   *backgroundCompactor
+	vlog        *valueLog
+	streams     map[int]chan walRecord
+	memFilter   *bloomFilter
+	valueCache  *valueCache
+	blockCache  *blockCache
+	bloomHasher Hasher
+	metrics     Metrics
+	writeIDs    *writeIDSet
+	codec       CodecConfig
+	stats       stats
+	quota       quota
+	fileLock    *os.File
 
 	lock          sync.RWMutex
+	stallCond     *sync.Cond // wait for flush when write stalled, use lock
+	compactCond   *sync.Cond // wait for tables reserved by another compaction, use lock
+	flushLock     sync.Mutex
 	id            uint64
 	rootPath      string
 	blockKeyNum   uint16
 	tableBlockNum uint16
+	vlogThreshold int
+	syncPolicy    SyncPolicy
+	valueEncoding ValueEncoding
+	maxImmutable  int
+	stallBlock    bool
+	strictLoad    bool
+	recentDeletes *recentDeletes
+	skipBadTable  bool   // log and skip an unreadable disk table on query instead of failing
+	valueChecksum bool   // store the crc32 of the value with each set command
+	walBuffer     int    // bytes of wal records buffered in memory, 0 means unbuffered
+	maxKeySize    int    // bytes of the longest key accepted
+	dedupActive   bool   // a command replaces the command of the same key in the active table
+	recovered     bool   // Open restored commands from a wal or disk tables
+	seq           uint64 // sequence number of the last command
+	walSeq        uint64 // sequence number of the first command in current wal
+	droppedSeq    uint64 // a read as of a sequence before it may miss versions dropped by dedup or compaction
+	diskSeq       uint64 // largest sequence number of the commands in disk tables
+	streamID      int
+	targetSize    uint64 // flush packs blocks into a table until its data reaches the size, 0 means by tableBlockNum
+	prefixFunc    PrefixExtractor
+	prefixFilters map[string]*bloomFilter // prefix filter of each disk table
+	compacting    map[string]bool         // disk tables reserved by a running compaction
+	snapshotRefs  map[string]int          // snapshots holding each disk table, reserved like a compaction
+	refLock       sync.Mutex              // guard readerRefs and retired, taken after the lock
+	readerRefs    map[string]int          // open iterators and scans reading each disk table
+	retired       map[string]bool         // disk tables merged away and kept on disk until their last reader is done
+	compactSem    chan struct{}           // a slot for each merge allowed to run at once
+	mmapLock      sync.Mutex              // guard mmapReads and mapped
+	mmapReads     bool
+	mapped        map[string]*mappedFile // disk tables mapped into memory for query
+
+	vlogSegment uint64                       // bytes after which the value log starts a new segment
+	vlogGCRatio float64                      // share of live bytes below which compaction moves the values out of a segment
+	vlogRefs    map[string]map[uint64]uint64 // bytes each disk table points to in each value log segment
+	vlogGCLock  sync.Mutex                   // moving values and removing value log segments run one at a time
 }
 
 func NewMEMSSTable(rootPath string, blockKeyNum, tableBlockNum uint16) (*MEMSSTable, error) {
@@ -31,251 +91,874 @@ func NewMEMSSTable(rootPath string, blockKeyNum, tableBlockNum uint16) (*MEMSSTa
 	t.blockKeyNum = blockKeyNum
 	t.tableBlockNum = tableBlockNum
 	t.activeTable = NewSSTable()
+	t.streams = make(map[int]chan walRecord)
+	t.writeIDs = newWriteIDSet(recentWriteIDNum)
+	t.stallCond = sync.NewCond(&t.lock)
+	t.compactCond = sync.NewCond(&t.lock)
+	t.compacting = make(map[string]bool)
+	t.snapshotRefs = make(map[string]int)
+	t.readerRefs = make(map[string]int)
+	t.retired = make(map[string]bool)
+	t.vlogRefs = make(map[string]map[uint64]uint64)
+	t.vlogSegment = defaultValueLogSegmentSize
+	t.vlogGCRatio = defaultValueLogGCRatio
+	t.compactSem = make(chan struct{}, defaultCompactionConcurrency)
+	t.walSeq = 1
+	t.maxKeySize = DefaultMaxKeySize
 	var err error
 	if err = os.MkdirAll(t.rootPath, 0755); err != nil {
 		return nil, err
 	}
+	if t.fileLock, err = lockFile(fmt.Sprintf("%s/%s", t.rootPath, lockFilename)); err != nil {
+		return nil, err
+	}
 	t.wal, err = NewWAL(fmt.Sprintf("%s/%d.wal", t.rootPath, t.id))
 	if err != nil {
+		unlockFile(t.fileLock)
 		return nil, err
 	}
 	return t, nil
 }
 
+// Close flush memory data to disk and release the database
+func (t *MEMSSTable) Close() error {
+	t.StopBackgroundFlush()
+	t.StopBackgroundCompaction()
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	if err := t.removeRetiredTables(); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for id, ch := range t.streams {
+		close(ch)
+		delete(t.streams, id)
+	}
+	if err := t.wal.Close(); err != nil {
+		return err
+	}
+	if t.vlog != nil {
+		if err := t.vlog.Close(); err != nil {
+			return err
+		}
+	}
+	t.unmapAll()
+	return unlockFile(t.fileLock)
+}
+
 func (t *MEMSSTable) Set(key, val string) error {
+	if err := checkRootKeys(key); err != nil {
+		return err
+	}
 	return t.command(&Command{Key: key, Value: val, Command: CommandTypeSet}, false)
 }
 
 func (t *MEMSSTable) Delete(key string) error {
+	if err := checkRootKeys(key); err != nil {
+		return err
+	}
 	return t.command(&Command{Key: key, Command: CommandTypeDelete}, false)
 }
 
 func (t *MEMSSTable) command(c *Command, restore bool) error {
 	t.lock.Lock()
-	if t.activeTable.Len() >= int(t.blockKeyNum) {
-		t.switchTable()
+	defer t.lock.Unlock()
+	return t.commandLocked(c, restore)
+}
+
+// commandLocked write the command to wal and active table, caller must hold the lock
+func (t *MEMSSTable) commandLocked(c *Command, restore bool) error {
+	// a replayed key is checked too, a longer one is a corrupted record
+	if err := t.checkKeySize([]*Command{c}); err != nil {
+		return err
 	}
 	if !restore {
-		t.wal.Append(c)
+		if err := t.waitWriteStall(); err != nil {
+			return err
+		}
+		if err := t.checkValues([]*Command{c}); err != nil {
+			return err
+		}
+		user := c
+		delta, err := t.checkQuota([]*Command{c})
+		if err != nil {
+			return err
+		}
+		if c, err = t.separateValue(c); err != nil {
+			return err
+		}
+		c = t.checksumValue(c)
+		if err := t.appendWAL(c); err != nil {
+			return err
+		}
+		t.stats.addUser(user)
+		t.quota.keys += delta
 	}
-	t.activeTable.Append(c)
-	t.lock.Unlock()
+	t.apply(c)
 	return nil
 }
 
-func (t *MEMSSTable) Query(key string) (string, error) {
-	// first lookup activity table
-	if v := t.activeTable.Query(key); v != nil {
-		return v.Value, nil
+// apply add a command which is already in wal to active table, caller must hold the lock
+func (t *MEMSSTable) apply(c *Command) {
+	// with dedup an existing key is replaced and does not need a new table
+	if t.activeTable.Len() >= int(t.blockKeyNum) && !(t.dedupActive && t.activeTable.hasKey(c.Key)) {
+		t.switchTable()
+		t.flusher.notify()
+	}
+	// a command applied before, as of a batch written twice, is copied so the first keeps its sequence number
+	if c.seq != 0 {
+		cc := *c
+		c = &cc
 	}
-	// then lookup immutable tables
-	for i := range t.immutable {
-		if v := t.immutable[i].Query(key); v != nil {
-			return v.Value, nil
+	t.seq++
+	c.seq = t.seq
+	if t.dedupActive {
+		t.activeTable.Put(c)
+		if t.activeTable.dropped > t.droppedSeq {
+			t.droppedSeq = t.activeTable.dropped
 		}
+	} else {
+		t.activeTable.Append(c)
 	}
+	t.valueCache.remove(c.Key)
+	if c.Command == CommandTypeDelete {
+		t.recentDeletes.add(c.Key)
+	} else {
+		t.recentDeletes.remove(c.Key)
+	}
+	if t.memFilter != nil {
+		t.memFilter.Add(c.Key)
+	}
+	t.publish(walRecord{Seq: t.seq, Command: c})
+}
 
-	// last lookup sparse index table
-	for i := range t.sparseIndex {
-		if t.sparseIndex[i].Key == key {
-			disk, err := NewDiskSSTable(t.sparseIndex[i].TableName)
-			if err != nil {
-				return "", err
-			}
-			if v, err := disk.Query(t.sparseIndex[i].BlockIndex, t.sparseIndex[i].DataStart, key); err != nil {
-				return "", err
-			} else {
-				return v.Value, nil
+// appendWAL write the command to wal and sync it by the sync policy, caller must hold the lock
+func (t *MEMSSTable) appendWAL(c *Command) error {
+	n, err := t.wal.Append(c)
+	atomic.AddUint64(&t.stats.walBytes, uint64(n))
+	if err != nil {
+		return err
+	}
+	if t.syncPolicy != SyncEveryWrite {
+		return nil
+	}
+	inner, _ := unwrapWriteID(c)
+	for _, cmd := range unwrapBatch(inner) {
+		if cmd.Command == CommandTypeValuePointer {
+			if err := t.vlog.Sync(); err != nil {
+				return err
 			}
-		} else {
-			disk, err := NewDiskSSTable(t.sparseIndex[i].TableName)
-			if err != nil {
-				return "", err
+			break
+		}
+	}
+	return t.wal.Sync()
+}
+
+// SetSyncPolicy change when the wal is synced to disk
+func (t *MEMSSTable) SetSyncPolicy(p SyncPolicy) {
+	t.lock.Lock()
+	t.syncPolicy = p
+	t.lock.Unlock()
+}
+
+// SetWALBufferSize buffer wal records in memory up to size bytes, 0 means every record is written
+// to the file at once, with SyncNever buffered records are lost if the process crashes before the
+// buffer is full or written by FlushWAL, Sync, a flush or Close, SyncEveryWrite drains it on each write
+func (t *MEMSSTable) SetWALBufferSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("invalid wal buffer size: %d", size)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.walBuffer = size
+	return t.wal.setBuffer(size)
+}
+
+// FlushWAL write the buffered wal records to the file without fsync
+func (t *MEMSSTable) FlushWAL() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.wal.Flush()
+}
+
+// LastSequence return the sequence number of the last command, each command of a batch has its own,
+// it is restored from the wal on Open
+func (t *MEMSSTable) LastSequence() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.seq
+}
+
+// Sync fsync the current wal and value log without flushing memory data
+func (t *MEMSSTable) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.vlog != nil {
+		if err := t.vlog.Sync(); err != nil {
+			return err
+		}
+	}
+	return t.wal.Sync()
+}
+
+// Query return the value of key, ErrKeyNotFound if the key is missing or deleted
+func (t *MEMSSTable) Query(key string) (string, error) {
+	val, ok, err := t.getValue(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return val, nil
+}
+
+type QueryOptions struct {
+	MemoryOnly bool // only the active and immutable tables, a key flushed to disk is not found
+}
+
+// QueryWithOptions return the value of key with options, ErrKeyNotFound if the key is missing or deleted
+func (t *MEMSSTable) QueryWithOptions(key string, opts QueryOptions) (string, error) {
+	if !opts.MemoryOnly {
+		return t.Query(key)
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	// the value cache is skipped, it also holds values read from disk
+	v := t.memoryAtLocked(key, math.MaxUint64)
+	if v == nil || v.Command == CommandTypeDelete {
+		return "", ErrKeyNotFound
+	}
+	return t.value(v)
+}
+
+// Lookup return the value of key and whether it exists, the error is only for read failure
+func (t *MEMSSTable) Lookup(key string) (string, bool, error) {
+	return t.getValue(key)
+}
+
+// QueryRaw return the encoded newest command of key as stored in the tables with its sequence number
+// if known, a deleted key returns its delete command and a value in the value log its pointer,
+// ErrKeyNotFound if the key is missing
+func (t *MEMSSTable) QueryRaw(key string) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	v, err := t.getLocked(key)
+	if err != nil {
+		return nil, err
+	}
+	_, data := v.tableBytes()
+	return data, nil
+}
+
+// getValue return the value of key and whether it exists, hot values are served by the value cache
+func (t *MEMSSTable) getValue(key string) (string, bool, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if val, ok := t.valueCache.get(key); ok {
+		return val, true, nil
+	}
+	if t.recentDeletes.has(key) {
+		return "", false, nil
+	}
+	v, err := t.getLocked(key)
+	if err == ErrKeyNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if v.Command == CommandTypeDelete {
+		return "", false, nil
+	}
+	val, err := t.value(v)
+	if err != nil {
+		return "", false, err
+	}
+	// added under the read lock, so a write of the key invalidates it after this
+	t.valueCache.add(key, val)
+	return val, true, nil
+}
+
+// getLocked is get for the caller holding the lock
+func (t *MEMSSTable) getLocked(key string) (*Command, error) {
+	return t.getAtLocked(key, math.MaxUint64)
+}
+
+// getAtLocked return the newest command of key whose sequence number is not after seq, a table whose
+// commands are all after seq is skipped, caller must hold the lock
+func (t *MEMSSTable) getAtLocked(key string, seq uint64) (*Command, error) {
+	if v := t.memoryAtLocked(key, seq); v != nil {
+		return v, nil
+	}
+
+	// last lookup sparse index table, newest block first
+	sparseIndex := t.sparseIndex
+	for i := len(sparseIndex) - 1; i >= 0; i-- {
+		// a table out of the key range or newer than seq is skipped with all its blocks, which are adjacent
+		if !sparseIndex[i].tableMayContain(key) || sparseIndex[i].TableMinSeq > seq {
+			for i > 0 && sparseIndex[i-1].TableName == sparseIndex[i].TableName {
+				i--
 			}
-			if v, err := disk.Query(t.sparseIndex[i].BlockIndex, t.sparseIndex[i].DataStart, key); err != nil {
-				return "", err
-			} else {
-				return v.Value, nil
+			continue
+		}
+		// keys of a block are not less than its first key
+		if sparseIndex[i].Key > key {
+			continue
+		}
+		v, err := t.queryBlockAt(sparseIndex[i], key, seq)
+		if err == ErrDiskKeyNotFound {
+			continue
+		}
+		if err != nil {
+			if t.skipBadTable {
+				log.Printf("query %s block %d error, skipped: %v", sparseIndex[i].TableName, sparseIndex[i].BlockIndex, err)
+				continue
 			}
+			return nil, err
+		}
+		return v, nil
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// memoryAtLocked return the newest command of key not after seq in the memory tables, nil if none
+// holds it, caller must hold the lock
+func (t *MEMSSTable) memoryAtLocked(key string, seq uint64) *Command {
+	// memory tables can be skipped when the filter excludes the key
+	if t.memFilter != nil && !t.memFilter.MayContain(key) {
+		return nil
+	}
+	// first lookup activity table
+	if v := t.activeTable.queryAt(key, seq); v != nil {
+		return v
+	}
+	// then lookup immutable tables, newest first
+	for i := len(t.immutable) - 1; i >= 0; i-- {
+		if v := t.immutable[i].queryAt(key, seq); v != nil {
+			return v
 		}
 	}
+	return nil
+}
+
+// queryBlockAt lookup the newest command of key not after seq in the disk block of index, a table
+// whose commands are all visible is queried as usual, caller must hold the lock
+func (t *MEMSSTable) queryBlockAt(index *SparseIndex, key string, seq uint64) (*Command, error) {
+	if index.TableMaxSeq <= seq {
+		return t.queryBlock(index, key)
+	}
+	block, err := t.loadBlock(index)
+	if err != nil {
+		return nil, err
+	}
+	if v := block.queryAt(key, seq); v != nil {
+		return v, nil
+	}
+	return nil, ErrDiskKeyNotFound
+}
+
+// queryBlock lookup key in the disk block of index, from the block cache if it is enabled and from
+// the mapped table if mmap reads are enabled, the read and decompression are timed if metrics are
+// set, caller must hold the lock
+func (t *MEMSSTable) queryBlock(index *SparseIndex, key string) (*Command, error) {
+	if t.blockCache == nil {
+		disk, release, err := t.openDiskTable(index.TableName)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return disk.Query(index.BlockIndex, index.DataStart, key)
+	}
+	block, err := t.loadBlock(index)
+	if err != nil {
+		return nil, err
+	}
+	if v := block.Query(key); v != nil {
+		return v, nil
+	}
+	return nil, ErrDiskKeyNotFound
+}
+
+// loadBlock return the restored disk block of index, from the block cache if it is enabled, a block
+// read from disk is added to the cache, caller must hold the lock
+func (t *MEMSSTable) loadBlock(index *SparseIndex) (*SSTable, error) {
+	if block := t.blockCache.get(index.TableName, index.BlockIndex); block != nil {
+		return block, nil
+	}
+	disk, release, err := t.openDiskTable(index.TableName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if err := disk.LoadBlock(index.BlockIndex, index.DataStart); err != nil {
+		return nil, err
+	}
+	block := disk.Blocks[index.BlockIndex]
+	t.blockCache.add(index.TableName, index.BlockIndex, block)
+	return block, nil
+}
+
+// openDiskTable open the disk table for a read, on the mapped file if mmap reads are enabled, release
+// must be called after the read
+func (t *MEMSSTable) openDiskTable(name string) (*DiskSSTable, func(), error) {
+	m := t.acquireMapped(name)
+	disk, err := NewDiskSSTable(name)
+	if err != nil {
+		m.release()
+		return nil, nil, err
+	}
+	if m != nil {
+		disk.mapped = m.data
+	}
+	disk.metrics = t.metrics
+	return disk, m.release, nil
+}
 
-	return "", errors.New("key not exists")
+// SetSkipUnreadableTables make query log and skip a disk table which can not be read and go on
+// with older tables, by default query fails with the read error
+func (t *MEMSSTable) SetSkipUnreadableTables(skip bool) {
+	t.lock.Lock()
+	t.skipBadTable = skip
+	t.lock.Unlock()
 }
 
-// Flush memory data to disk, generate a disk sstable
+// Flush memory data to disk, generate a disk sstable, concurrent calls wait for the running one
 func (t *MEMSSTable) Flush() error {
-	lz4buf := bytes.NewBuffer(nil)
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
 
 	t.lock.Lock()
 	t.switchTable()
 	t.lock.Unlock()
 
-	for len(t.immutable) > 0 {
-		filename := fmt.Sprintf("%s/%d.sdb", t.rootPath, t.id)
-		f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-		if err != nil {
-			return fmt.Errorf("sstable.flush: err %v", err)
-		}
-		metaInfo := new(SSTableMetaInfo)
-		metaInfo.Version = 1
-		metaInfo.BlockKeyNum = t.blockKeyNum
-		metaInfo.TableBlockNum = t.tableBlockNum
-		sparseIndex := make([]SparseIndex, 0, int(t.tableBlockNum)*2)
-		var i int
-		for i = 0; i < len(t.immutable) && i < int(t.tableBlockNum); i++ {
-			if t.immutable[i].Len() == 0 {
-				continue
-			}
-			lz4buf.Reset()
-			lz4w := lz4.NewWriter(lz4buf)
-			_, body := t.immutable[i].Bytes()
-			_, err := lz4w.Write(body)
-			if err != nil {
-				return err
-			}
-			lz4w.Close()
-			binary.Write(f, binary.LittleEndian, uint32(lz4buf.Len()))
-			io.Copy(f, lz4buf)
-			sparseIndex = append(sparseIndex, SparseIndex{
-				Key:        t.immutable[i].data[0].Key,
-				DataStart:  uint32(metaInfo.DataLength),
-				BlockIndex: uint32(i),
-			})
-			metaInfo.DataLength += uint64(lz4buf.Len()) + 4
-		}
-
-		// write sparse index
-		metaInfo.IndexStart = metaInfo.DataLength
-		for i := range sparseIndex {
-			n, body := sparseIndex[i].Bytes()
-			binary.Write(f, binary.LittleEndian, uint32(n))
-			f.Write(body)
-			metaInfo.IndexLength += uint64(n) + 4
-		}
-
-		// write meta info
-		n, err := f.Write(metaInfo.Bytes())
-		fmt.Printf("metainfo length=%d, %+v\n", n, metaInfo)
+	for {
+		more, err := t.flushBatch()
 		if err != nil {
 			return err
 		}
-		if err := f.Sync(); err != nil {
-			return err
+		if !more {
+			return nil
 		}
-		if err := f.Close(); err != nil {
-			return err
+	}
+}
+
+// FlushOne flush one batch of immutable tables to a disk sstable, and report whether more remain,
+// the active table remains until the call after the last immutable table switches and flushes it
+func (t *MEMSSTable) FlushOne() (bool, error) {
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+
+	t.lock.Lock()
+	if len(t.immutable) == 0 && t.activeTable.Len() > 0 {
+		t.switchTable()
+	}
+	t.lock.Unlock()
+
+	more, err := t.flushBatch()
+	if err != nil || more {
+		return more, err
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.activeTable.Len() > 0, nil
+}
+
+// SetTargetFileSize make flush pack immutable tables into a disk table until its data reaches size
+// instead of tableBlockNum tables, 0 restores packing by tableBlockNum
+func (t *MEMSSTable) SetTargetFileSize(size uint64) {
+	t.flushLock.Lock()
+	t.targetSize = size
+	t.flushLock.Unlock()
+}
+
+// SetBlockKeyNum change the number of commands of a memory table, so of a block of the disk tables written
+// after it, the active table switches at the next write if it holds more, tables already in memory and on
+// disk keep their size, each disk table records its own in the meta info
+func (t *MEMSSTable) SetBlockKeyNum(n uint16) error {
+	if n == 0 {
+		return errors.New("invalid block key num: 0")
+	}
+	t.lock.Lock()
+	t.blockKeyNum = n
+	t.lock.Unlock()
+	return nil
+}
+
+// SetTableBlockNum change the number of blocks of a disk table written by flush after it, without
+// a target file size, tables already on disk keep their size
+func (t *MEMSSTable) SetTableBlockNum(n uint16) error {
+	if n == 0 {
+		return errors.New("invalid table block num: 0")
+	}
+	t.lock.Lock()
+	t.tableBlockNum = n
+	t.lock.Unlock()
+	return nil
+}
+
+// flushBatch write immutable tables into one disk sstable, at most tableBlockNum tables or
+// until the target file size is reached
+func (t *MEMSSTable) flushBatch() (bool, error) {
+	// the tables and the file id are taken in the lock, writers append tables and compaction takes ids
+	// meanwhile, the flushLock keeps any other flush out until the tables are trimmed
+	t.lock.Lock()
+	blockKeyNum, tableBlockNum := t.blockKeyNum, t.tableBlockNum
+	n := len(t.immutable)
+	if n > int(tableBlockNum) && t.targetSize == 0 {
+		n = int(tableBlockNum)
+	}
+	tables := append([]*SSTable{}, t.oldestImmutables(n)...)
+	empty := true
+	for _, table := range tables {
+		if table.Len() > 0 {
+			empty = false
+			break
 		}
-		if err := t.wal.Remove(); err != nil {
-			return err
+	}
+	if empty {
+		// nothing to write, only drop the empty tables
+		defer t.lock.Unlock()
+		t.popImmutables(tables)
+		t.stallCond.Broadcast()
+		return len(t.immutable) > 0, nil
+	}
+	id := t.id
+	t.id++
+	t.lock.Unlock()
+
+	filename := fmt.Sprintf("%s/%d.sdb", t.rootPath, id)
+	metaInfo := new(SSTableMetaInfo)
+	metaInfo.Version = metaInfoVersion
+	metaInfo.Seq = id
+	metaInfo.BlockKeyNum = blockKeyNum
+	metaInfo.TableBlockNum = tableBlockNum
+	sparseIndex, i, err := writeTableFile(filename, tables, metaInfo, t.codec, t.targetSize)
+	if err != nil {
+		return false, err
+	}
+	flushed := tables[:i]
+	atomic.AddUint64(&t.stats.flushBytes, metaInfo.fileSize())
+
+	// trim, register and wal rotation are done in one lock, a failure before it leaves
+	// the tables in memory and the wal untouched, a reader in the same lock finds each
+	// flushed key either in the immutable tables or in the new disk table, never in neither
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.popImmutables(flushed)
+	for i := range sparseIndex {
+		t.sparseIndex = append(t.sparseIndex, &sparseIndex[i])
+	}
+	if metaInfo.MaxSeq > t.diskSeq {
+		t.diskSeq = metaInfo.MaxSeq
+	}
+	t.addPrefixFilter(filename, flushed)
+	t.setValueRefs(filename, flushed)
+	t.stallCond.Broadcast()
+	t.compactor.notify()
+	if len(t.immutable) == 0 {
+		// flushed keys are no longer in memory
+		t.rebuildMemoryFilter()
+	}
+
+	if err := t.rotateWAL(); err != nil {
+		return false, err
+	}
+	return len(t.immutable) > 0, nil
+}
+
+// reuseWAL go on writing the restored wal instead of rotating it, the wal created by NewMEMSSTable is
+// removed, caller must hold the lock
+func (t *MEMSSTable) reuseWAL(w *wal) error {
+	w.compress = t.codec.CompressWAL
+	if err := w.setBuffer(t.walBuffer); err != nil {
+		return err
+	}
+	old := t.wal
+	t.wal = w
+	t.countRemoved(old.filename)
+	return old.Remove()
+}
+
+// rotateWAL write the commands still in memory to a new wal and remove the current one,
+// the current wal is kept if the new one can not be written, caller must hold the lock
+func (t *MEMSSTable) rotateWAL() error {
+	w, err := NewWAL(fmt.Sprintf("%s/%d.wal", t.rootPath, t.id))
+	if err != nil {
+		return err
+	}
+	w.compress = t.codec.CompressWAL
+	w.setBuffer(t.walBuffer)
+	// commands are written in the order they were applied, a table is sorted by key when it switches
+	cmds := make(CommandData, 0, t.activeTable.Len())
+	for _, table := range t.immutable {
+		cmds = append(cmds, table.data...)
+	}
+	cmds = append(cmds, t.activeTable.data...)
+	sort.SliceStable(cmds, func(i, j int) bool {
+		return cmds[i].seq < cmds[j].seq
+	})
+	walSeq := t.firstMemorySeq()
+	// the sequence number survives restart even if no command is left in memory
+	nn, err := w.Append(newSequenceCommand(walSeq, t.droppedSeq))
+	atomic.AddUint64(&t.stats.walBytes, uint64(nn))
+	if ids := t.writeIDs.list(); err == nil && len(ids) > 0 {
+		nn, err = w.Append(newWriteIDsCommand(ids))
+		atomic.AddUint64(&t.stats.walBytes, uint64(nn))
+	}
+	if err != nil {
+		w.Remove()
+		return err
+	}
+	for _, c := range cmds {
+		nn, err = w.appendWithSeq(c)
+		atomic.AddUint64(&t.stats.walBytes, uint64(nn))
+		if err != nil {
+			break
 		}
+	}
+	if err == nil {
+		err = w.Sync()
+	}
+	if err != nil {
+		w.Remove()
+		return err
+	}
 
-		t.lock.Lock()
-		if len(t.immutable) >= i {
-			t.immutable = t.immutable[i:]
-		} else {
-			t.immutable = t.immutable[:0]
+	// the old wal is removed only after the new one is durable, a crash before leaves both and
+	// Open replays from the new one
+	if err := syncDir(t.rootPath); err != nil {
+		w.Remove()
+		return err
+	}
+	old := t.wal
+	t.wal = w
+	t.walSeq = walSeq
+	t.countRemoved(old.filename)
+	return old.Remove()
+}
+
+// firstMemorySeq return the sequence number of the oldest command in memory tables, the next one if
+// they are empty, commands replaced by dedup leave gaps so it is not counted back from t.seq, caller
+// must hold the lock
+func (t *MEMSSTable) firstMemorySeq() uint64 {
+	first := t.seq + 1
+	min := func(table *SSTable) {
+		for _, c := range table.data {
+			if c.seq < first {
+				first = c.seq
+			}
 		}
+	}
+	for _, table := range t.immutable {
+		min(table)
+	}
+	min(t.activeTable)
+	return first
+}
 
-		t.id++
-		t.wal, _ = NewWAL(fmt.Sprintf("%s/%d.wal", t.rootPath, t.id))
-		t.lock.Unlock()
+// writeSparseIndexAndMetaInfo write sparse index and meta info after the data blocks
+func writeSparseIndexAndMetaInfo(w io.Writer, sparseIndex []SparseIndex, metaInfo *SSTableMetaInfo) error {
+	// write sparse index
+	metaInfo.IndexStart = metaInfo.DataLength
+	for i := range sparseIndex {
+		n, body := sparseIndex[i].Bytes()
+		if err := binary.Write(w, binary.LittleEndian, uint32(n)); err != nil {
+			return err
+		}
+		if nn, err := w.Write(body); err != nil {
+			return err
+		} else if nn != len(body) {
+			return fmt.Errorf("write sparse index: %w, %d of %d bytes", io.ErrShortWrite, nn, len(body))
+		}
+		metaInfo.IndexLength += uint64(n) + 4
 	}
 
+	// write meta info, the loader expects the whole trailer at the end of file
+	data := metaInfo.Bytes()
+	n, err := w.Write(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return fmt.Errorf("write metainfo: %w, %d of %d bytes", io.ErrShortWrite, n, len(data))
+	}
 	return nil
 }
 
-// LoadFromDiskTable restore sstable from wal
+// LoadFromDiskTable restore sparse index from disk sstable
 func (t *MEMSSTable) LoadFromDiskTable(f *os.File) error {
-	f.Seek(-40, io.SeekEnd)
-	data := make([]byte, 40)
-	nn, err := f.Read(data)
-	if err != nil && err != io.EOF {
-		return err
+	// each table is read by the version of its own meta info, tables of several versions are mixed
+	metaInfo, sparseIndex, err := readSparseIndex(f)
+	if err == nil {
+		err = metaInfo.checkVersion()
+	}
+	if err != nil {
+		return fmt.Errorf("load %s: %w", f.Name(), err)
 	}
-	if nn != 40 {
-		return fmt.Errorf("read metainfo length error: %d", nn)
+	t.lock.RLock()
+	strict := t.strictLoad
+	t.lock.RUnlock()
+	if strict {
+		if err := checkSparseIndex(metaInfo, sparseIndex); err != nil {
+			return fmt.Errorf("load %s: %w", f.Name(), err)
+		}
 	}
+	id, ok := tableID(f.Name())
 
-	metaInfo := new(SSTableMetaInfo)
-	metaInfo.Restore(data)
-	fmt.Printf("metainfo length=%d, %+v\n", nn, metaInfo)
+	// keep sparse index ordered by table seq, so that newer table is consulted first
+	t.lock.Lock()
+	if metaInfo.DroppedSeq > t.droppedSeq {
+		t.droppedSeq = metaInfo.DroppedSeq
+	}
+	if metaInfo.MaxSeq > t.diskSeq {
+		t.diskSeq = metaInfo.MaxSeq
+	}
+	// the table may hold newer commands of deleted keys
+	t.recentDeletes.reset()
+	t.sparseIndex = append(t.sparseIndex, sparseIndex...)
+	sort.SliceStable(t.sparseIndex, func(i, j int) bool {
+		return t.sparseIndex[i].TableSeq < t.sparseIndex[j].TableSeq
+	})
+	// restore a table, need incrase file id
+	if ok && id >= t.id {
+		t.id = id + 1
+	} else if !ok {
+		t.id++
+	}
+	t.lock.Unlock()
+	return nil
+}
 
-	// restore sparse index
-	f.Seek(-40-int64(metaInfo.IndexLength), io.SeekEnd)
-	var n uint32
-	for {
-		if err = binary.Read(f, binary.LittleEndian, &n); err != nil {
-			if err == io.EOF {
-				break
+// LoadFromWAL restore sstable from wal, commands already in the loaded disk tables by sequence number are skipped
+func (t *MEMSSTable) LoadFromWAL(f io.ReadSeeker) error {
+	_, err := t.loadWAL(f)
+	return err
+}
+
+// loadWAL is LoadFromWAL returning the length of the complete records, a torn record is after it
+func (t *MEMSSTable) loadWAL(f io.Reader) (int64, error) {
+	return readWALRecords(f, func(cmd *Command) error {
+		cmd, writeID := unwrapWriteID(cmd)
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		if cmd.Command == CommandTypeSequence {
+			t.seq = commandSequence(cmd) - 1
+			t.walSeq = commandSequence(cmd)
+			if dropped := commandDroppedSeq(cmd); dropped > t.droppedSeq {
+				t.droppedSeq = dropped
 			}
-			return err
+			return nil
 		}
-		if n == 0 {
-			break
+		if cmd.Command == CommandTypeWriteIDs {
+			for _, id := range commandWriteIDs(cmd) {
+				t.writeIDs.add(id)
+			}
+			return nil
 		}
-		if cap(data) < int(n) {
-			data = make([]byte, n)
-		} else {
-			data = data[:n]
+		if writeID != "" {
+			t.writeIDs.add(writeID)
 		}
-		if nn, err = f.Read(data); err != nil {
-			if err == io.EOF {
-				break
+		for _, c := range unwrapBatch(cmd) {
+			// a command rewritten by rotation keeps its sequence number, the others follow the one before
+			if c.seq != 0 {
+				t.seq = c.seq - 1
+			}
+			// a stop after a flush and before the wal rotation leaves flushed commands in the wal,
+			// they are counted but not applied again
+			if t.seq < t.diskSeq {
+				t.seq++
+				continue
+			}
+			if err := t.commandLocked(c, true); err != nil {
+				return err
 			}
-			return err
 		}
-		index := new(SparseIndex)
-		index.Restore(data)
-		index.TableName = f.Name()
-		t.sparseIndex = append(t.sparseIndex, index)
-		fmt.Println("load sparse index: ", index.Key, nn)
-	}
+		return nil
+	})
+}
 
-	t.id++ // restore a table, need incrase file id
-	return nil
+// readWAL read commands from wal one by one, a torn record at the tail ends the wal
+func readWAL(f io.Reader, fn func(cmd *Command) error) error {
+	_, err := readWALRecords(f, fn)
+	return err
 }
 
-// LoadFromWAL restore sstable from wal
-func (t *MEMSSTable) LoadFromWAL(f io.ReadSeeker) error {
+// readWALRecords is readWAL returning the length of the complete records read
+func readWALRecords(f io.Reader, fn func(cmd *Command) error) (int64, error) {
 	var n uint32
 	var err error
 	var data []byte
+	var end int64
 	for {
 		if err = binary.Read(f, binary.LittleEndian, &n); err != nil {
-			if err == io.EOF {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				break
 			}
-			return err
+			return end, err
 		}
 		if n == 0 {
 			break
 		}
+		compressed := n&walCompressedFlag != 0
+		n &^= walCompressedFlag
 		if cap(data) < int(n) {
 			data = make([]byte, n)
 		} else {
 			data = data[:n]
 		}
 
-		if _, err = f.Read(data); err != nil {
-			if err == io.EOF {
+		if _, err = io.ReadFull(f, data); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				break
 			}
-			return err
+			return end, err
+		}
+		body := data
+		if compressed {
+			if body, err = uncompressWALRecord(data); err != nil {
+				return end, err
+			}
 		}
 		cmd := new(Command)
-		cmd.Restore(data)
-		if err = t.command(cmd, true); err != nil {
-			return err
+		cmd.Restore(body)
+		if err = fn(cmd); err != nil {
+			return end, err
 		}
+		end += 4 + int64(n)
 	}
 
-	return nil
+	return end, nil
 }
 
 // switchTable change current table to immutable, and create a new table for write
 func (t *MEMSSTable) switchTable() {
 	t.activeTable.Sort()
-	t.immutable = append(t.immutable, t.activeTable)
+	t.activeTable.seq = t.seq
+	t.pushImmutable(t.activeTable)
 	t.activeTable = NewSSTable()
 }
+
+// SetDedupActiveTable make a write replace the command of the same key in the active table instead of
+// appending, so the table switches after blockKeyNum distinct keys, the wal still keeps every command
+func (t *MEMSSTable) SetDedupActiveTable(enable bool) {
+	t.lock.Lock()
+	t.dedupActive = enable
+	t.lock.Unlock()
+}
+
+// RotateMemtable move the active table to immutable even if it is not full, nothing is
+// written to disk, an empty active table is not rotated
+func (t *MEMSSTable) RotateMemtable() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.activeTable.Len() == 0 {
+		return
+	}
+	t.switchTable()
+	t.flusher.notify()
+}
@@ -0,0 +1,504 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestQueryNewestImmutable(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	mustSet(t, db, "k", "old")
+	db.RotateMemtable()
+	mustSet(t, db, "k", "new")
+	expectValue(t, db, "k", "new")
+	db.RotateMemtable()
+	// both versions are in immutable tables
+	expectValue(t, db, "k", "new")
+}
+
+func TestQueryNewestImmutableAfterReplay(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	db.SetMaxImmutableTables(4, false)
+	for _, val := range []string{"1", "2", "3"} {
+		mustSet(t, db, "k", val)
+		db.RotateMemtable()
+	}
+	expectValue(t, db, "k", "3")
+	expectValueAt(t, db, "k", 2, "2")
+	crash(t, db)
+
+	// the replayed versions keep their order
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectValue(t, db, "k", "3")
+	expectValueAt(t, db, "k", 2, "2")
+}
+
+func TestFlushOneUntilDone(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	for i := 0; i < 7; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+	for n := 0; ; n++ {
+		if n > 10 {
+			t.Fatal("FlushOne never reports done")
+		}
+		more, err := db.FlushOne()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !more {
+			break
+		}
+	}
+	db.lock.RLock()
+	immutable, active := len(db.immutable), db.activeTable.Len()
+	db.lock.RUnlock()
+	if immutable != 0 || active != 0 {
+		t.Fatalf("%d immutable tables and %d active commands left", immutable, active)
+	}
+	if n := len(tableFiles(t, dir)); n != 4 {
+		t.Fatalf("%d tables, want 4", n)
+	}
+	crash(t, db)
+
+	// every key is read from the tables
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	for i := 0; i < 7; i++ {
+		expectValue(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	mustSet(t, db, "disk", "d")
+	mustSet(t, db, "deleted", "x")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "memory", "m")
+	if err := db.Delete("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		key, val string
+		ok       bool
+	}{
+		{"disk", "d", true},
+		{"memory", "m", true},
+		{"deleted", "", false},
+		{"missing", "", false},
+	} {
+		val, ok, err := db.Lookup(c.key)
+		if err != nil || ok != c.ok || val != c.val {
+			t.Fatalf("lookup %s: got %q, %v, %v, want %q, %v", c.key, val, ok, err, c.val, c.ok)
+		}
+	}
+
+	// a table which can not be read is an error, not a missing key
+	for _, name := range tableFiles(t, dir) {
+		if err := os.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, err := db.Lookup("disk"); err == nil || ok {
+		t.Fatalf("lookup of an unreadable table: %v, %v, want an error", ok, err)
+	}
+}
+
+func TestSkipUnreadableTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	mustSet(t, db, "k", "good")
+	mustSet(t, db, "l", "l")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// the newer table covers k without holding it, so a query reads its block first
+	mustSet(t, db, "a", "a")
+	mustSet(t, db, "z", "z")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	files := tableFiles(t, dir)
+	f, err := os.OpenFile(files[len(files)-1], os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("not an lz4 frame"), 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := db.Query("k"); err == nil || err == ErrKeyNotFound {
+		t.Fatalf("strict query through a corrupt table: %v, want the read error", err)
+	}
+	db.SetSkipUnreadableTables(true)
+	expectValue(t, db, "k", "good")
+	expectNotFound(t, db, "missing")
+}
+
+func TestRotateMemtable(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 4, 1)
+	defer db.Close()
+	mustSet(t, db, "a", "1")
+	db.RotateMemtable()
+	db.lock.RLock()
+	immutable, active := len(db.immutable), db.activeTable.Len()
+	db.lock.RUnlock()
+	if immutable != 1 || active != 0 {
+		t.Fatalf("%d immutable tables, %d active commands after rotation, want 1 and 0", immutable, active)
+	}
+	if n := len(tableFiles(t, dir)); n != 0 {
+		t.Fatalf("rotation wrote %d tables", n)
+	}
+	expectValue(t, db, "a", "1")
+
+	// an empty active table is not rotated
+	db.RotateMemtable()
+	db.lock.RLock()
+	immutable = len(db.immutable)
+	db.lock.RUnlock()
+	if immutable != 1 {
+		t.Fatalf("%d immutable tables after rotating an empty table, want 1", immutable)
+	}
+}
+
+// tableKeyCount return the number of commands in the disk tables
+func tableKeyCount(t *testing.T, db *MEMSSTable) uint64 {
+	t.Helper()
+	tables, err := db.ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n uint64
+	for _, table := range tables {
+		n += table.KeyCount
+	}
+	return n
+}
+
+func TestFlushFailsOnSecondBatch(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	// 6 keys are flushed in 3 batches
+	for i := 0; i < 6; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+	// the temporary file of the second batch can not be created
+	db.lock.RLock()
+	blocked := fmt.Sprintf("%s/%d.sdb.tmp", dir, db.id+1)
+	db.lock.RUnlock()
+	if err := os.Mkdir(blocked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err == nil {
+		t.Fatal("flush succeeded with the second batch blocked")
+	}
+	db.lock.RLock()
+	immutable := len(db.immutable)
+	db.lock.RUnlock()
+	if n := len(tableFiles(t, dir)); n != 1 || immutable != 2 {
+		t.Fatalf("%d tables and %d immutable tables after the failure, want 1 and 2", n, immutable)
+	}
+	check := func(db *MEMSSTable) {
+		t.Helper()
+		for i := 0; i < 6; i++ {
+			expectValue(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+		}
+	}
+	check(db)
+	crash(t, db)
+
+	// the wal holds only the commands which are not on disk
+	if err := os.Remove(blocked); err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	check(db)
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := tableKeyCount(t, db); n != 6 {
+		t.Fatalf("%d commands on disk, want 6", n)
+	}
+	check(db)
+}
+
+func TestLastSequence(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	if seq := db.LastSequence(); seq != 0 {
+		t.Fatalf("last sequence of an empty database %d, want 0", seq)
+	}
+	for i := 0; i < 5; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), "v")
+	}
+	if err := db.Delete("k0"); err != nil {
+		t.Fatal(err)
+	}
+	// each command of a batch has its own sequence number
+	b := NewBatch()
+	b.Set("b1", "v")
+	b.Set("b2", "v")
+	b.Delete("k1")
+	if err := db.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	const want = 9
+	expectLast := func(db *MEMSSTable, when string) {
+		t.Helper()
+		if seq := db.LastSequence(); seq != want {
+			t.Fatalf("last sequence %s: %d, want %d", when, seq, want)
+		}
+	}
+	expectLast(db, "after the writes")
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	expectLast(db, "after the wal replay")
+	// a clean close flushes everything, the next open has only disk tables
+	db.Close()
+	db = openTestDB(t, dir, 2, 1)
+	expectLast(db, "after reopening the disk tables")
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectLast(db, "after a compaction")
+	mustSet(t, db, "next", "v")
+	if seq := db.LastSequence(); seq != want+1 {
+		t.Fatalf("last sequence after the next write: %d, want %d", seq, want+1)
+	}
+}
+
+func TestQueryDuringFlush(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	const n = 200
+	for i := 0; i < n; i++ {
+		mustSet(t, db, fmt.Sprintf("k%03d", i), fmt.Sprintf("v%d", i))
+	}
+	// readers check every key while the batches move from memory to disk
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := r; ; i = (i + 7) % n {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("k%03d", i)
+				if val, err := db.Query(key); err != nil || val != fmt.Sprintf("v%d", i) {
+					errs <- fmt.Errorf("query %s during flush: %q, %v", key, val, err)
+					return
+				}
+			}
+		}(r)
+	}
+	err := db.Flush()
+	close(stop)
+	wg.Wait()
+	close(errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if got := tableKeyCount(t, db); got != n {
+		t.Fatalf("%d commands on disk, want %d", got, n)
+	}
+}
+
+func TestConcurrentFlush(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 2)
+	const writers, keys = 2, 200
+	var wg sync.WaitGroup
+	errs := make(chan error, writers+4)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				if err := db.Set(fmt.Sprintf("w%d-%03d", w, i), "v"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	// flushes race with each other and with the writers
+	done := make(chan struct{})
+	var flushers sync.WaitGroup
+	for f := 0; f < 4; f++ {
+		flushers.Add(1)
+		go func(f int) {
+			defer flushers.Done()
+			for {
+				var err error
+				if f%2 == 0 {
+					err = db.Flush()
+				} else {
+					_, err = db.FlushOne()
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+		}(f)
+	}
+	wg.Wait()
+	close(done)
+	flushers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every flush wrote its own file, no table was overwritten by another
+	infos, err := db.ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := tableFiles(t, dir)
+	ids := make(map[uint64]bool)
+	for _, info := range infos {
+		if ids[info.ID] {
+			t.Fatalf("table id %d is used twice", info.ID)
+		}
+		ids[info.ID] = true
+	}
+	if len(ids) != len(files) {
+		t.Fatalf("%d tables loaded, %d files", len(ids), len(files))
+	}
+	if n := tableKeyCount(t, db); n != writers*keys {
+		t.Fatalf("%d commands on disk, want %d", n, writers*keys)
+	}
+	check := func(db *MEMSSTable) {
+		t.Helper()
+		for w := 0; w < writers; w++ {
+			for i := 0; i < keys; i++ {
+				expectValue(t, db, fmt.Sprintf("w%d-%03d", w, i), "v")
+			}
+		}
+	}
+	check(db)
+	db.Close()
+	db = openTestDB(t, dir, 2, 2)
+	defer db.Close()
+	check(db)
+}
+
+func TestQueryMemoryOnly(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	db.EnableValueCache(10)
+	memoryOnly := func(key string) (string, error) {
+		return db.QueryWithOptions(key, QueryOptions{MemoryOnly: true})
+	}
+	mustSet(t, db, "disk", "1")
+	mustSet(t, db, "gone", "2")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "hot", "3")
+	if err := db.Delete("gone"); err != nil {
+		t.Fatal(err)
+	}
+	db.RotateMemtable()
+	mustSet(t, db, "active", "4")
+
+	// the value cache holds the disk value after a normal read
+	expectValue(t, db, "disk", "1")
+	if val, err := memoryOnly("disk"); err != ErrKeyNotFound {
+		t.Fatalf("memory-only read of a disk key: %q, %v, want ErrKeyNotFound", val, err)
+	}
+	if val, err := memoryOnly("gone"); err != ErrKeyNotFound {
+		t.Fatalf("memory-only read of a key deleted in memory: %q, %v, want ErrKeyNotFound", val, err)
+	}
+	for key, want := range map[string]string{"hot": "3", "active": "4"} {
+		if val, err := memoryOnly(key); err != nil || val != want {
+			t.Fatalf("memory-only read of %s: %q, %v, want %q", key, val, err, want)
+		}
+	}
+	if val, err := db.QueryWithOptions("disk", QueryOptions{}); err != nil || val != "1" {
+		t.Fatalf("read of a disk key without options: %q, %v", val, err)
+	}
+}
+
+func TestRetuneSizes(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	if db.SetBlockKeyNum(0) == nil || db.SetTableBlockNum(0) == nil {
+		t.Fatal("sizes of 0 are taken")
+	}
+	setKeys := func(prefix string, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			mustSet(t, db, fmt.Sprintf("%s%d", prefix, i), prefix)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setKeys("old", 4)
+	if err := db.SetBlockKeyNum(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetTableBlockNum(2); err != nil {
+		t.Fatal(err)
+	}
+	setKeys("new", 8)
+	files := tableFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("%d tables, want 2 of the old sizes and 1 of the new", len(files))
+	}
+	for i, want := range []struct{ keys, blockKeyNum, tableBlockNum int }{{2, 2, 1}, {2, 2, 1}, {8, 4, 2}} {
+		metaInfo, _, err := readTableMetaInfo(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(metaInfo.KeyCount) != want.keys || int(metaInfo.BlockKeyNum) != want.blockKeyNum || int(metaInfo.TableBlockNum) != want.tableBlockNum {
+			t.Fatalf("table %s: %d keys, sizes %d and %d, want %+v", files[i], metaInfo.KeyCount, metaInfo.BlockKeyNum, metaInfo.TableBlockNum, want)
+		}
+	}
+	db.Close()
+
+	// each table is read by its own meta info, whatever the sizes of the instance
+	db = openTestDB(t, dir, 3, 5)
+	defer db.Close()
+	for prefix, n := range map[string]int{"old": 4, "new": 8} {
+		for i := 0; i < n; i++ {
+			expectValue(t, db, fmt.Sprintf("%s%d", prefix, i), prefix)
+		}
+	}
+}
@@ -3,16 +3,120 @@ package db
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const metaInfoVersion uint32 = 7 // version of meta info written by flush
+
+var ErrUnknownMetaInfoVersion = errors.New("unknown metainfo version")
+
+// since version 6 meta info ends with a footer of its total length and the magic, so a loader finds
+// the trailer without knowing the layout of the version
+const (
+	metaInfoMagic      uint32 = 0x5444534c // "LSDT" in little endian
+	metaInfoFooterSize        = 8
 )
 
 type SSTableMetaInfo struct {
-	DataStart     uint64 // data segment position
-	DataLength    uint64 // data segment length
-	IndexStart    uint64 // sparse index position
-	IndexLength   uint64 // sparse index length
-	BlockKeyNum   uint16 // each block contains N keys
-	TableBlockNum uint16 // each table contains N blocks
-	Version       uint32 // data version
+	DataStart      uint64 // data segment position
+	DataLength     uint64 // data segment length
+	IndexStart     uint64 // sparse index position
+	IndexLength    uint64 // sparse index length
+	BlockKeyNum    uint16 // each block contains N keys
+	TableBlockNum  uint16 // each table contains N blocks
+	Seq            uint64 // creation sequence of the table, newer table has bigger seq, since version 2
+	KeyCount       uint64 // number of commands in the table, tombstones included, since version 4
+	TombstoneCount uint64 // number of delete commands in the table, since version 5
+	MinSeq         uint64 // smallest sequence number of the commands in the table, since version 7
+	MaxSeq         uint64 // largest sequence number of the commands in the table, since version 7
+	DroppedSeq     uint64 // a read as of a sequence before it may miss versions dropped from the table, since version 7
+	FirstKey       string // smallest key of the table, since version 3
+	LastKey        string // largest key of the table, since version 3
+	Version        uint32 // data version
+}
+
+// metaInfoLength return the trailer length of the version, version is always the last 4 bytes,
+// keyLength is the length of the first and the last key since version 3
+func metaInfoLength(version uint32, keyLength int) (int, error) {
+	switch version {
+	case 1:
+		return 40, nil
+	case 2:
+		return 48, nil
+	case 3:
+		return 56 + keyLength, nil
+	case 4:
+		return 64 + keyLength, nil
+	case 5:
+		return 72 + keyLength, nil
+	case 6:
+		return 72 + keyLength + metaInfoFooterSize, nil
+	case 7:
+		return 96 + keyLength + metaInfoFooterSize, nil
+	default:
+		return 0, fmt.Errorf("%w: %d", ErrUnknownMetaInfoVersion, version)
+	}
+}
+
+// checkVersion return ErrUnknownMetaInfoVersion for a version this binary does not write, a trailer of a
+// newer version with a footer is restored, but its blocks may use a format which is not known
+func (t *SSTableMetaInfo) checkVersion() error {
+	if t.Version == 0 || t.Version > metaInfoVersion {
+		return fmt.Errorf("%w: %d, the newest known is %d", ErrUnknownMetaInfoVersion, t.Version, metaInfoVersion)
+	}
+	return nil
+}
+
+// fileSize return the size of the table file described by the meta info
+func (t *SSTableMetaInfo) fileSize() uint64 {
+	n, _ := metaInfoLength(t.Version, len(t.FirstKey)+len(t.LastKey))
+	return t.DataLength + t.IndexLength + uint64(n)
+}
+
+// tombstoneRatio return the share of delete commands in the table, 0 if it is not stored
+func (t *SSTableMetaInfo) tombstoneRatio() float64 {
+	if t.Version < 5 || t.KeyCount == 0 {
+		return 0
+	}
+	return float64(t.TombstoneCount) / float64(t.KeyCount)
+}
+
+// addCounts count the commands and tombstones of a block
+func (t *SSTableMetaInfo) addCounts(block *SSTable) {
+	t.KeyCount += uint64(block.Len())
+	for _, c := range block.data {
+		if c.Command == CommandTypeDelete {
+			t.TombstoneCount++
+		}
+	}
+}
+
+// addSeqRange extend the sequence range of the table by a block, firstBlock is true for the first block,
+// a command replaced in the block raises DroppedSeq
+func (t *SSTableMetaInfo) addSeqRange(block *SSTable, firstBlock bool) {
+	for i, c := range block.data {
+		if firstBlock && i == 0 || c.seq < t.MinSeq {
+			t.MinSeq = c.seq
+		}
+		if c.seq > t.MaxSeq {
+			t.MaxSeq = c.seq
+		}
+	}
+	if block.dropped > t.DroppedSeq {
+		t.DroppedSeq = block.dropped
+	}
+}
+
+// addKeyRange extend the first and the last key of the table by a block, first is true for the first block
+func (t *SSTableMetaInfo) addKeyRange(first, last string, firstBlock bool) {
+	if firstBlock || first < t.FirstKey {
+		t.FirstKey = first
+	}
+	if firstBlock || last > t.LastKey {
+		t.LastKey = last
+	}
 }
 
 func (t *SSTableMetaInfo) Bytes() []byte {
@@ -23,18 +127,124 @@ func (t *SSTableMetaInfo) Bytes() []byte {
 	binary.Write(buf, binary.LittleEndian, t.IndexLength)
 	binary.Write(buf, binary.LittleEndian, t.BlockKeyNum)
 	binary.Write(buf, binary.LittleEndian, t.TableBlockNum)
+	if t.Version >= 2 {
+		binary.Write(buf, binary.LittleEndian, t.Seq)
+	}
+	if t.Version >= 4 {
+		binary.Write(buf, binary.LittleEndian, t.KeyCount)
+	}
+	if t.Version >= 5 {
+		binary.Write(buf, binary.LittleEndian, t.TombstoneCount)
+	}
+	if t.Version >= 7 {
+		binary.Write(buf, binary.LittleEndian, t.MinSeq)
+		binary.Write(buf, binary.LittleEndian, t.MaxSeq)
+		binary.Write(buf, binary.LittleEndian, t.DroppedSeq)
+	}
+	if t.Version >= 3 {
+		buf.WriteString(t.FirstKey)
+		buf.WriteString(t.LastKey)
+		binary.Write(buf, binary.LittleEndian, uint32(len(t.FirstKey)))
+		binary.Write(buf, binary.LittleEndian, uint32(len(t.LastKey)))
+	}
 	binary.Write(buf, binary.LittleEndian, t.Version)
+	if t.Version >= 6 {
+		binary.Write(buf, binary.LittleEndian, uint32(buf.Len()+metaInfoFooterSize))
+		binary.Write(buf, binary.LittleEndian, metaInfoMagic)
+	}
 	return buf.Bytes()
 }
 
+// metaInfoFooter return the trailer length stored in the footer at the end of data, ok is false
+// if data does not end with a footer, as before version 6
+func metaInfoFooter(data []byte) (int, bool) {
+	if len(data) < metaInfoFooterSize || binary.LittleEndian.Uint32(data[len(data)-4:]) != metaInfoMagic {
+		return 0, false
+	}
+	return int(binary.LittleEndian.Uint32(data[len(data)-8:])), true
+}
+
+// Restore parse the trailer, fields are read from the front and the keys from the end, so a trailer
+// of a newer version with more fields between them is still readable
 func (t *SSTableMetaInfo) Restore(data []byte) {
+	if _, ok := metaInfoFooter(data); ok {
+		data = data[:len(data)-metaInfoFooterSize]
+	}
 	buf := bytes.NewBuffer(data)
+	if len(data) >= 4 {
+		t.Version = binary.LittleEndian.Uint32(data[len(data)-4:])
+	}
 	binary.Read(buf, binary.LittleEndian, &t.DataStart)
 	binary.Read(buf, binary.LittleEndian, &t.DataLength)
 	binary.Read(buf, binary.LittleEndian, &t.IndexStart)
 	binary.Read(buf, binary.LittleEndian, &t.IndexLength)
 	binary.Read(buf, binary.LittleEndian, &t.BlockKeyNum)
 	binary.Read(buf, binary.LittleEndian, &t.TableBlockNum)
-	binary.Read(buf, binary.LittleEndian, &t.Version)
+	if t.Version >= 2 {
+		binary.Read(buf, binary.LittleEndian, &t.Seq)
+	}
+	if t.Version >= 4 {
+		binary.Read(buf, binary.LittleEndian, &t.KeyCount)
+	}
+	if t.Version >= 5 {
+		binary.Read(buf, binary.LittleEndian, &t.TombstoneCount)
+	}
+	if t.Version >= 7 {
+		binary.Read(buf, binary.LittleEndian, &t.MinSeq)
+		binary.Read(buf, binary.LittleEndian, &t.MaxSeq)
+		binary.Read(buf, binary.LittleEndian, &t.DroppedSeq)
+	}
+	if fixed := len(data) - buf.Len(); t.Version >= 3 && len(data) >= fixed+12 {
+		first := int(binary.LittleEndian.Uint32(data[len(data)-12:]))
+		last := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+		if end := len(data) - 12; fixed+first+last <= end {
+			t.FirstKey = string(data[end-first-last : end-last])
+			t.LastKey = string(data[end-last : end])
+		}
+	}
 	buf = nil
 }
+
+// readMetaInfo read the meta info trailer at the end of a disk table, return it with its length,
+// since version 6 the length is taken from the footer, before it from the version in the last 4 bytes
+func readMetaInfo(r io.ReadSeeker) (*SSTableMetaInfo, int, error) {
+	data := make([]byte, metaInfoFooterSize)
+	if _, err := r.Seek(-metaInfoFooterSize, io.SeekEnd); err != nil {
+		return nil, 0, err
+	}
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, err
+	}
+	length, ok := metaInfoFooter(data)
+	if !ok {
+		version := binary.LittleEndian.Uint32(data[4:])
+		keyLength := 0
+		if version >= 3 {
+			// the lengths of the first and the last key are before the version
+			data = make([]byte, 8)
+			if _, err := r.Seek(-12, io.SeekEnd); err != nil {
+				return nil, 0, err
+			}
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, 0, err
+			}
+			keyLength = int(binary.LittleEndian.Uint32(data)) + int(binary.LittleEndian.Uint32(data[4:]))
+		}
+		var err error
+		if length, err = metaInfoLength(version, keyLength); err != nil {
+			return nil, 0, err
+		}
+	} else if length < metaInfoFooterSize+4 {
+		return nil, 0, fmt.Errorf("invalid metainfo length: %d", length)
+	}
+	data = make([]byte, length)
+	if _, err := r.Seek(-int64(length), io.SeekEnd); err != nil {
+		return nil, 0, err
+	}
+	if nn, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, fmt.Errorf("read metainfo length error: %d", nn)
+	}
+	metaInfo := new(SSTableMetaInfo)
+	metaInfo.Restore(data)
+	return metaInfo, length, nil
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewerDiskTableWins(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	mustSet(t, db, "k", "old")
+	mustSet(t, db, "a", "a")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "k", "new")
+	mustSet(t, db, "b", "b")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "k", "new")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// name the newer table before the older one, the load order then differs from the creation order
+	files := tableFiles(t, dir)
+	if len(files) != 2 {
+		t.Fatalf("%d tables, want 2", len(files))
+	}
+	older, newer := files[0], files[1]
+	oldMeta, _, err := readTableMetaInfo(older)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newMeta, _, err := readTableMetaInfo(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newMeta.Seq <= oldMeta.Seq {
+		t.Fatalf("newer table seq %d, older %d", newMeta.Seq, oldMeta.Seq)
+	}
+	renamed := filepath.Join(dir, "0.sdb")
+	if err := os.Rename(newer, renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectValue(t, db, "k", "new")
+	expectValue(t, db, "a", "a")
+	expectValue(t, db, "b", "b")
+	// the next flush does not reuse a loaded file id
+	mustSet(t, db, "k", "newest")
+	mustSet(t, db, "c", "c")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tableFiles(t, dir)); n != 3 {
+		t.Fatalf("%d tables after flush, want 3", n)
+	}
+	expectValue(t, db, "k", "newest")
+	expectValue(t, db, "b", "b")
+}
+
+func TestLongerTrailer(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	mustSet(t, db, "a", "1")
+	mustSet(t, db, "b", "2")
+	db.Close()
+	files := tableFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("%d tables, want 1", len(files))
+	}
+	want, length, err := readTableMetaInfo(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a later layout adds fields between the fixed fields and the keys, the footer tells the new length
+	const fixed, extra = 84, 16
+	trailer := data[len(data)-length:]
+	longer := append([]byte{}, trailer[:fixed]...)
+	longer = append(longer, bytes.Repeat([]byte{0xff}, extra)...)
+	longer = append(longer, trailer[fixed:len(trailer)-metaInfoFooterSize]...)
+	footer := make([]byte, metaInfoFooterSize)
+	binary.LittleEndian.PutUint32(footer, uint32(len(longer)+metaInfoFooterSize))
+	binary.LittleEndian.PutUint32(footer[4:], metaInfoMagic)
+	longer = append(longer, footer...)
+	if err := os.WriteFile(files[0], append(data[:len(data)-length:len(data)-length], longer...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, gotLength, err := readTableMetaInfo(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotLength != length+extra {
+		t.Fatalf("trailer length %d, want %d", gotLength, length+extra)
+	}
+	if *got != *want {
+		t.Fatalf("meta info %+v, want %+v", got, want)
+	}
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	expectValue(t, db, "a", "1")
+	expectValue(t, db, "b", "2")
+}
+
+// rewriteMetaInfo rewrite the trailer of the table in the layout of version
+func rewriteMetaInfo(t *testing.T, filename string, version uint32) {
+	t.Helper()
+	metaInfo, length, err := readTableMetaInfo(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaInfo.Version = version
+	data = append(data[:len(data)-length:len(data)-length], metaInfo.Bytes()...)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMixedVersions(t *testing.T) {
+	dir := t.TempDir()
+	versions := []uint32{1, 2, 3, 5, 6, metaInfoVersion}
+	db := openTestDB(t, dir, 2, 1)
+	for i, v := range versions {
+		mustSet(t, db, "k", fmt.Sprintf("v%d", v))
+		mustSet(t, db, fmt.Sprintf("k%d", i), "v")
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	files := tableFiles(t, dir)
+	if len(files) != len(versions) {
+		t.Fatalf("%d tables, want %d", len(files), len(versions))
+	}
+	for i, v := range versions {
+		rewriteMetaInfo(t, files[i], v)
+	}
+
+	// each table is read by its own version, the newest table still wins
+	db = openTestDB(t, dir, 2, 1)
+	expectValue(t, db, "k", fmt.Sprintf("v%d", metaInfoVersion))
+	for i := range versions {
+		expectValue(t, db, fmt.Sprintf("k%d", i), "v")
+	}
+	infos, err := db.ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, info := range infos {
+		if info.Version != versions[i] {
+			t.Fatalf("table %s of version %d, want %d", info.Name, info.Version, versions[i])
+		}
+	}
+	db.Close()
+
+	// a version newer than the binary fails open, naming the table
+	rewriteMetaInfo(t, files[2], 99)
+	_, err = Open(dir, 2, 1)
+	if !errors.Is(err, ErrUnknownMetaInfoVersion) || !strings.Contains(err.Error(), filepath.Base(files[2])) {
+		t.Fatalf("open with a table of version 99: %v, want ErrUnknownMetaInfoVersion naming %s", err, files[2])
+	}
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// RepairSSTable rebuild sparse index and meta info of a disk sstable from its data blocks,
+// the repaired file replace the original one atomically
+func RepairSSTable(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// keep the table settings from old meta info when it is still readable
+	oldMetaInfo, _, err := readMetaInfo(bytes.NewReader(data))
+	if err != nil {
+		oldMetaInfo = new(SSTableMetaInfo)
+		oldMetaInfo.Seq, _ = tableID(path)
+	}
+	metaInfo := new(SSTableMetaInfo)
+	metaInfo.Version = metaInfoVersion
+	metaInfo.Seq = oldMetaInfo.Seq
+	metaInfo.BlockKeyNum = oldMetaInfo.BlockKeyNum
+	if metaInfo.BlockKeyNum == 0 {
+		metaInfo.BlockKeyNum = BlockKeyNum
+	}
+	metaInfo.TableBlockNum = oldMetaInfo.TableBlockNum
+	if metaInfo.TableBlockNum == 0 {
+		metaInfo.TableBlockNum = TableBlockNum
+	}
+
+	// scan blocks from the head of file until data is not a valid block
+	sparseIndex := make([]SparseIndex, 0)
+	var blockIndex uint32
+	for {
+		start := metaInfo.DataLength
+		if start+4 > uint64(len(data)) {
+			break
+		}
+		n := binary.LittleEndian.Uint32(data[start:])
+		raw, prefix := n&blockRawFlag != 0, n&blockPrefixFlag != 0
+		n &^= blockFlags
+		if n == 0 || start+4+uint64(n) > uint64(len(data)) {
+			break
+		}
+		block, err := repairBlock(data[start+4:start+4+uint64(n)], raw, prefix)
+		if err != nil {
+			break
+		}
+		key, last := block.data[0].Key, block.data[block.Len()-1].Key
+		metaInfo.addKeyRange(key, last, len(sparseIndex) == 0)
+		metaInfo.addCounts(block)
+		metaInfo.addSeqRange(block, len(sparseIndex) == 0)
+		sparseIndex = append(sparseIndex, SparseIndex{
+			Key:        key,
+			DataStart:  uint32(start),
+			BlockIndex: blockIndex,
+		})
+		blockIndex++
+		metaInfo.DataLength += uint64(n) + 4
+	}
+	if len(sparseIndex) == 0 {
+		return fmt.Errorf("RepairSSTable: no valid block found in %s", path)
+	}
+	// the blocks after the last valid one are lost, so a read as of any sequence in the table may miss them
+	metaInfo.DroppedSeq = oldMetaInfo.DroppedSeq
+	for _, seq := range []uint64{oldMetaInfo.MaxSeq, metaInfo.MaxSeq} {
+		if seq > metaInfo.DroppedSeq {
+			metaInfo.DroppedSeq = seq
+		}
+	}
+
+	tmpName := path + ".repair"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data[:metaInfo.DataLength]); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := writeSparseIndexAndMetaInfo(f, sparseIndex, metaInfo); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return os.Rename(tmpName, path)
+}
+
+// repairBlock decompress a block, an empty block is not valid
+func repairBlock(data []byte, raw, prefix bool) (*SSTable, error) {
+	block, err := decodeBlock(data, raw, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if block.Len() == 0 {
+		return nil, fmt.Errorf("RepairSSTable: empty block")
+	}
+	return block, nil
+}
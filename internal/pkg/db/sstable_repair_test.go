@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestRepairSSTable(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 2)
+	for i := 0; i < 8; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := tableFiles(t, dir)
+	if len(files) == 0 {
+		t.Fatal("no table is flushed")
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metaInfo, _, err := readSparseIndex(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := metaInfo.IndexStart; i < metaInfo.IndexStart+metaInfo.IndexLength; i++ {
+			data[i] = 0
+		}
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the zeroed index finds no block
+	db = openTestDB(t, dir, 2, 2)
+	if _, err := db.Query("k0"); err == nil {
+		t.Fatal("k0 is found without a sparse index")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range files {
+		if err := RepairSSTable(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db = openTestDB(t, dir, 2, 2)
+	defer db.Close()
+	for i := 0; i < 8; i++ {
+		expectValue(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+}
+
+func TestRepairSSTableNoBlock(t *testing.T) {
+	name := t.TempDir() + "/1.sdb"
+	if err := os.WriteFile(name, make([]byte, 64), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RepairSSTable(name); err == nil {
+		t.Fatal("a file without blocks is repaired")
+	}
+}
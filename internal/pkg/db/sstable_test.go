@@ -0,0 +1,80 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestSSTableQuery(t *testing.T) {
+	for _, sorted := range []bool{false, true} {
+		table := NewSSTable()
+		for _, key := range []string{"d", "b", "a", "b", "c", "e", "b"} {
+			table.Append(&Command{Key: key, Value: fmt.Sprintf("%s%d", key, table.Len())})
+		}
+		if sorted {
+			table.Sort()
+		}
+		for key, want := range map[string]string{"a": "a2", "b": "b6", "c": "c4", "d": "d0", "e": "e5"} {
+			if v := table.Query(key); v == nil || v.Value != want {
+				t.Fatalf("sorted %v: query %s got %+v, want %s", sorted, key, v, want)
+			}
+		}
+		for _, key := range []string{"", "0", "bb", "f"} {
+			if v := table.Query(key); v != nil {
+				t.Fatalf("sorted %v: query %q got %+v", sorted, key, v)
+			}
+		}
+	}
+}
+
+func BenchmarkSSTableQuery(b *testing.B) {
+	const n = 4096
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%08d", rand.Intn(n*10))
+	}
+	for _, sorted := range []bool{false, true} {
+		table := NewSSTable()
+		for _, key := range keys {
+			table.Append(&Command{Key: key, Value: "v"})
+		}
+		if sorted {
+			table.Sort()
+		}
+		b.Run(fmt.Sprintf("sorted=%v", sorted), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				table.Query(keys[i%n])
+			}
+		})
+	}
+}
+
+func TestSSTableSortOnce(t *testing.T) {
+	table := NewSSTable()
+	for _, key := range []string{"c", "a", "b"} {
+		table.Append(&Command{Key: key})
+	}
+	table.Sort()
+	if !table.sorted {
+		t.Fatal("the table is not marked sorted")
+	}
+	// a sorted table is not sorted again, the swapped commands stay in place
+	table.data[0], table.data[2] = table.data[2], table.data[0]
+	table.Sort()
+	if table.data[0].Key != "c" {
+		t.Fatalf("second sort reordered the commands: %s first", table.data[0].Key)
+	}
+	table.data[0], table.data[2] = table.data[2], table.data[0]
+
+	table.Append(&Command{Key: "0"})
+	if table.sorted {
+		t.Fatal("append after sort left the table marked sorted")
+	}
+	table.Sort()
+	for i, want := range []string{"0", "a", "b", "c"} {
+		if table.data[i].Key != want {
+			t.Fatalf("command %d is %s, want %s", i, table.data[i].Key, want)
+		}
+	}
+}
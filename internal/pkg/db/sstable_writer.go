@@ -0,0 +1,122 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// writeTableFile write blocks into a disk sstable file, empty blocks are skipped,
+// the block index of sparse index is the position of the block in blocks,
+// the file is written to a temp file and renamed, so a failed write leaves no partial table,
+// with maxSize the blocks after data reaches it are not written, n is the number of blocks written
+func writeTableFile(filename string, blocks []*SSTable, metaInfo *SSTableMetaInfo, codec CodecConfig, maxSize uint64) (sparseIndex []SparseIndex, n int, err error) {
+	tmpName := filename + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("sstable.flush: err %v", err)
+	}
+	sparseIndex, n, err = writeTable(f, blocks, metaInfo, codec, maxSize)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return nil, 0, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpName)
+		return nil, 0, err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		return nil, 0, err
+	}
+	// the table must be durable before the wal holding its commands is removed
+	if err := syncDir(path.Dir(filename)); err != nil {
+		return nil, 0, err
+	}
+	for i := range sparseIndex {
+		sparseIndex[i].TableName = filename
+		sparseIndex[i].TableSeq = metaInfo.Seq
+		sparseIndex[i].setTableRange(metaInfo)
+	}
+	return sparseIndex, n, nil
+}
+
+// syncDir fsync a directory so the files created, renamed or removed in it survive a crash
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// writeTable write compressed blocks, sparse index and meta info to w, stop before the block
+// after data reaches maxSize if it is not 0, and return the number of blocks written,
+// a block is written raw with blockRawFlag if compression does not make it smaller, with PrefixKeys
+// its keys are prefix compressed and blockPrefixFlag is set, the output depends only on the arguments,
+// no clock or random value is written, so the same commands and config give byte-identical tables
+func writeTable(w io.Writer, blocks []*SSTable, metaInfo *SSTableMetaInfo, codec CodecConfig, maxSize uint64) ([]SparseIndex, int, error) {
+	lz4buf := bytes.NewBuffer(nil)
+	sparseIndex := make([]SparseIndex, 0, len(blocks))
+	n := 0
+	for i := range blocks {
+		if maxSize > 0 && metaInfo.DataLength >= maxSize {
+			break
+		}
+		n = i + 1
+		if blocks[i].Len() == 0 {
+			continue
+		}
+		lz4buf.Reset()
+		lz4w := codec.newWriter(lz4buf)
+		flag := uint32(0)
+		var body []byte
+		if restart := codec.restartInterval(); restart > 0 {
+			body = blocks[i].prefixBytes(restart)
+			flag = blockPrefixFlag
+		} else {
+			_, body = blocks[i].Bytes()
+		}
+		if _, err := lz4w.Write(body); err != nil {
+			return nil, 0, err
+		}
+		if err := lz4w.Close(); err != nil {
+			return nil, 0, err
+		}
+		blockLength := lz4buf.Len()
+		if blockLength >= len(body) {
+			lz4buf.Reset()
+			lz4buf.Write(body)
+			blockLength = len(body)
+			flag |= blockRawFlag
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint32(blockLength)|flag); err != nil {
+			return nil, 0, err
+		}
+		if _, err := io.Copy(w, lz4buf); err != nil {
+			return nil, 0, err
+		}
+		sparseIndex = append(sparseIndex, SparseIndex{
+			Key:        blocks[i].data[0].Key,
+			DataStart:  uint32(metaInfo.DataLength),
+			BlockIndex: uint32(i),
+		})
+		metaInfo.DataLength += uint64(blockLength) + 4
+		metaInfo.addCounts(blocks[i])
+		metaInfo.addKeyRange(blocks[i].data[0].Key, blocks[i].data[blocks[i].Len()-1].Key, len(sparseIndex) == 1)
+		metaInfo.addSeqRange(blocks[i], len(sparseIndex) == 1)
+	}
+
+	if err := writeSparseIndexAndMetaInfo(w, sparseIndex, metaInfo); err != nil {
+		return nil, 0, err
+	}
+	return sparseIndex, n, nil
+}
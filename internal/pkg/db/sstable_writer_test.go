@@ -0,0 +1,205 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fullWriter is a disk which fills after n bytes
+type fullWriter struct {
+	n int
+}
+
+func (w *fullWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, syscall.ENOSPC
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteTableDiskFull(t *testing.T) {
+	blocks := []*SSTable{NewSSTable(), NewSSTable()}
+	for i, key := range []string{"a", "b", "c", "d"} {
+		blocks[i/2].Append(&Command{Key: key, Value: key})
+	}
+	var full bytes.Buffer
+	if _, _, err := writeTable(&full, blocks, &SSTableMetaInfo{Version: metaInfoVersion}, CodecConfig{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// the disk fills at any byte of the table
+	for n := 0; n < full.Len(); n++ {
+		_, _, err := writeTable(&fullWriter{n: n}, blocks, &SSTableMetaInfo{Version: metaInfoVersion}, CodecConfig{}, 0)
+		if !errors.Is(err, syscall.ENOSPC) {
+			t.Fatalf("disk full after %d of %d bytes: %v, want ENOSPC", n, full.Len(), err)
+		}
+	}
+}
+
+func TestFlushDiskFull(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	mustSet(t, db, "a", "1")
+	mustSet(t, db, "b", "2")
+	// the temporary table is written to a device which is always full
+	db.lock.RLock()
+	tmpName := fmt.Sprintf("%s/%d.sdb.tmp", dir, db.id)
+	db.lock.RUnlock()
+	if err := os.Symlink("/dev/full", tmpName); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("flush to a full disk: %v, want ENOSPC", err)
+	}
+	if names, _ := filepath.Glob(dir + "/*.sdb*"); len(names) != 0 {
+		t.Fatalf("partial tables survive: %v", names)
+	}
+	expectValue(t, db, "a", "1")
+
+	// the tables are still in memory and a retry flushes them
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := tableKeyCount(t, db); n != 2 {
+		t.Fatalf("%d commands on disk, want 2", n)
+	}
+	expectValue(t, db, "a", "1")
+	expectValue(t, db, "b", "2")
+}
+
+func TestTargetFileSize(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 4, 1)
+	defer db.Close()
+	const target = 2000
+	db.SetTargetFileSize(target)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		mustSet(t, db, fmt.Sprintf("k%03d", i), fmt.Sprintf("%x", r.Int63())+strings.Repeat(fmt.Sprintf("%x", r.Int63()), 3))
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	files := tableFiles(t, dir)
+	if len(files) < 3 {
+		t.Fatalf("%d tables, want them split by the target size", len(files))
+	}
+	var keys uint64
+	for i, name := range files {
+		metaInfo, _, err := readTableMetaInfo(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys += metaInfo.KeyCount
+		// a table stops at the first block reaching the target, the last one holds what is left
+		if metaInfo.DataLength >= target+500 || (i < len(files)-1 && metaInfo.DataLength < target) {
+			t.Fatalf("table %s holds %d data bytes, target %d", name, metaInfo.DataLength, target)
+		}
+	}
+	if keys != 100 {
+		t.Fatalf("%d commands in the tables, want 100", keys)
+	}
+	for i := 0; i < 100; i += 7 {
+		if _, err := db.Query(fmt.Sprintf("k%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// shortWriter write one byte less of a write of n bytes without an error, as a broken writer would
+type shortWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) == w.n {
+		return w.Buffer.Write(p[:len(p)-1])
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestWriteMetaInfoShortWrite(t *testing.T) {
+	sparseIndex := []SparseIndex{{Key: "a", TableName: "1.sdb"}}
+	metaInfo := &SSTableMetaInfo{Version: metaInfoVersion, FirstKey: "a", LastKey: "a"}
+	trailer := len(metaInfo.Bytes())
+	if n, _ := sparseIndex[0].Bytes(); n == trailer {
+		t.Fatal("the trailer can not be told from the index entry")
+	}
+	w := &shortWriter{n: trailer}
+	err := writeSparseIndexAndMetaInfo(w, sparseIndex, metaInfo)
+	if !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("short write of the %d byte trailer: %v, want io.ErrShortWrite", trailer, err)
+	}
+
+	var full bytes.Buffer
+	if err := writeSparseIndexAndMetaInfo(&full, sparseIndex, &SSTableMetaInfo{Version: metaInfoVersion, FirstKey: "a", LastKey: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Len() != full.Len()-1 {
+		t.Fatalf("short writer got %d bytes, want %d", w.Len(), full.Len()-1)
+	}
+}
+
+func TestDeterministicFlush(t *testing.T) {
+	flush := func(c CodecConfig) map[string][]byte {
+		t.Helper()
+		dir := t.TempDir()
+		db := openTestDB(t, dir, 8, 4)
+		defer db.Close()
+		if err := db.SetCodec(c); err != nil {
+			t.Fatal(err)
+		}
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("k%03d", r.Intn(150))
+			if i%7 == 0 {
+				if err := db.Delete(key); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			mustSet(t, db, key, strings.Repeat(key, i%5+1))
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string][]byte)
+		for _, name := range tableFiles(t, dir) {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[filepath.Base(name)] = data
+		}
+		return files
+	}
+	for _, c := range []CodecConfig{{}, {CompressionLevel: 9}, {PrefixKeys: true, KeyRestartInterval: 4}} {
+		first := flush(c)
+		time.Sleep(10 * time.Millisecond)
+		second := flush(c)
+		if len(first) == 0 || len(first) != len(second) {
+			t.Fatalf("codec %+v: %d and %d tables", c, len(first), len(second))
+		}
+		for name, data := range first {
+			if !bytes.Equal(data, second[name]) {
+				t.Fatalf("codec %+v: table %s differs between two flushes of the same commands", c, name)
+			}
+		}
+	}
+}
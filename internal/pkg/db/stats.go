@@ -0,0 +1,106 @@
+package db
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is the counters of bytes written since the database is opened and whether Open recovered data
+type Stats struct {
+	UserBytes          uint64  // key and value bytes of writes
+	WALBytes           uint64  // bytes written to wal, rewrites by wal rotation included
+	ValueLogBytes      uint64  // bytes written to value log
+	FlushBytes         uint64  // bytes of disk tables written by flush
+	CompactionBytes    uint64  // bytes of disk tables rewritten by compaction and key collapse
+	WriteAmplification float64 // bytes written to disk / user bytes, 0 if nothing is written
+	Recovered          bool    // Open restored commands from a wal or disk tables
+}
+
+// stats is updated with atomic operations, writes to disk tables happen out of the lock
+type stats struct {
+	userBytes       uint64
+	walBytes        uint64
+	valueLogBytes   uint64
+	flushBytes      uint64
+	compactionBytes uint64
+
+	compactions       uint64 // merges of disk tables finished
+	compactionRead    uint64 // bytes of the input tables of the merges
+	compactionWritten uint64 // bytes of the tables written by the merges
+	compactionDropped uint64 // versions and tombstones the merges did not keep
+	lastCompaction    int64  // nanoseconds of the last merge
+	runningMerges     int64  // merges holding a slot of the compaction concurrency limit
+}
+
+func (s *stats) addUser(c *Command) {
+	atomic.AddUint64(&s.userBytes, uint64(len(c.Key)+len(c.Value)))
+}
+
+// diskBytes return the bytes written to wal, value log and disk tables
+func (s *stats) diskBytes() uint64 {
+	return atomic.LoadUint64(&s.walBytes) + atomic.LoadUint64(&s.valueLogBytes) +
+		atomic.LoadUint64(&s.flushBytes) + atomic.LoadUint64(&s.compactionBytes)
+}
+
+// Stats return the write counters, the write amplification and whether Open recovered data
+func (t *MEMSSTable) Stats() Stats {
+	s := Stats{
+		UserBytes:       atomic.LoadUint64(&t.stats.userBytes),
+		WALBytes:        atomic.LoadUint64(&t.stats.walBytes),
+		ValueLogBytes:   atomic.LoadUint64(&t.stats.valueLogBytes),
+		FlushBytes:      atomic.LoadUint64(&t.stats.flushBytes),
+		CompactionBytes: atomic.LoadUint64(&t.stats.compactionBytes),
+	}
+	t.lock.RLock()
+	s.Recovered = t.recovered
+	t.lock.RUnlock()
+	if s.UserBytes > 0 {
+		disk := s.WALBytes + s.ValueLogBytes + s.FlushBytes + s.CompactionBytes
+		s.WriteAmplification = float64(disk) / float64(s.UserBytes)
+	}
+	return s
+}
+
+// CompactionStats is the counters of disk table merges since the database is opened, the rewrite
+// of a table by CollapseKey is not a merge and not counted
+type CompactionStats struct {
+	Compactions  uint64        // merges finished
+	BytesRead    uint64        // bytes of the tables merged
+	BytesWritten uint64        // bytes of the tables written, a merge dropping every key writes none
+	KeysDropped  uint64        // older versions replaced by a newer one and tombstones dropped at the bottom
+	LastDuration time.Duration // time of the last merge, 0 if none finished
+	Running      int64         // merges running now, at most the compaction concurrency
+}
+
+// CompactionStats return the merge counters
+func (t *MEMSSTable) CompactionStats() CompactionStats {
+	return CompactionStats{
+		Compactions:  atomic.LoadUint64(&t.stats.compactions),
+		BytesRead:    atomic.LoadUint64(&t.stats.compactionRead),
+		BytesWritten: atomic.LoadUint64(&t.stats.compactionWritten),
+		KeysDropped:  atomic.LoadUint64(&t.stats.compactionDropped),
+		LastDuration: time.Duration(atomic.LoadInt64(&t.stats.lastCompaction)),
+		Running:      atomic.LoadInt64(&t.stats.runningMerges),
+	}
+}
+
+// IsEmpty report whether the database holds no command in memory or on disk, a deleted key
+// still holds its tombstone until compaction drops it
+func (t *MEMSSTable) IsEmpty() bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.isEmpty()
+}
+
+// isEmpty is IsEmpty for the caller holding the lock
+func (t *MEMSSTable) isEmpty() bool {
+	if t.activeTable.Len() > 0 || len(t.sparseIndex) > 0 {
+		return false
+	}
+	for _, table := range t.immutable {
+		if table.Len() > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestWriteAmplification(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	if s := db.Stats(); s.WriteAmplification != 0 || s.Recovered {
+		t.Fatalf("stats of an empty database: %+v", s)
+	}
+	for i := 0; i < 8; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("value%d", i))
+	}
+	user := uint64(8 * len("k0value0"))
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	flushed := db.Stats()
+	if flushed.UserBytes != user || flushed.WALBytes == 0 || flushed.FlushBytes == 0 || flushed.CompactionBytes != 0 {
+		t.Fatalf("stats after flush: %+v, want %d user bytes", flushed, user)
+	}
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	s := db.Stats()
+	if s.CompactionBytes == 0 || s.UserBytes != user {
+		t.Fatalf("stats after compaction: %+v", s)
+	}
+	want := float64(s.WALBytes+s.ValueLogBytes+s.FlushBytes+s.CompactionBytes) / float64(user)
+	if s.WriteAmplification != want || s.WriteAmplification <= flushed.WriteAmplification || s.WriteAmplification <= 1 {
+		t.Fatalf("write amplification %v after compaction, %v before, want %v", s.WriteAmplification, flushed.WriteAmplification, want)
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	dir := t.TempDir()
+	fresh, err := NewMEMSSTable(dir, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fresh.IsEmpty() || fresh.Stats().Recovered {
+		t.Fatalf("a fresh instance: empty %v, recovered %v", fresh.IsEmpty(), fresh.Stats().Recovered)
+	}
+	mustSet(t, fresh, "k", "v")
+	if fresh.IsEmpty() {
+		t.Fatal("empty after a write")
+	}
+	// a tombstone is still held
+	if err := fresh.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if fresh.IsEmpty() {
+		t.Fatal("empty with a tombstone")
+	}
+	crash(t, fresh)
+
+	// the commands are recovered from the wal
+	db := openTestDB(t, dir, 2, 1)
+	if db.IsEmpty() || !db.Stats().Recovered {
+		t.Fatalf("after a wal replay: empty %v, recovered %v", db.IsEmpty(), db.Stats().Recovered)
+	}
+	db.Close()
+	// and from the disk tables
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	if db.IsEmpty() || !db.Stats().Recovered {
+		t.Fatalf("after loading the disk tables: empty %v, recovered %v", db.IsEmpty(), db.Stats().Recovered)
+	}
+	empty := openTestDB(t, t.TempDir(), 2, 1)
+	defer empty.Close()
+	if !empty.IsEmpty() || empty.Stats().Recovered {
+		t.Fatalf("opened in an empty dir: empty %v, recovered %v", empty.IsEmpty(), empty.Stats().Recovered)
+	}
+}
+
+func TestCompactionStats(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	if s := db.CompactionStats(); s != (CompactionStats{}) {
+		t.Fatalf("stats before a merge: %+v", s)
+	}
+	for _, pair := range [][2]string{{"a", "b"}, {"a", "c"}, {"b", "d"}} {
+		mustSet(t, db, pair[0], "v")
+		if pair[0] == "b" {
+			if err := db.Delete(pair[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mustSet(t, db, pair[1], "v")
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tableSize := func() uint64 {
+		t.Helper()
+		var size uint64
+		for _, name := range tableFiles(t, dir) {
+			fi, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size += uint64(fi.Size())
+		}
+		return size
+	}
+	read := tableSize()
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	// the older a, the two older b and the tombstone of b at the bottom
+	s := db.CompactionStats()
+	if s.Compactions != 1 || s.BytesRead != read || s.BytesWritten != tableSize() || s.KeysDropped != 4 ||
+		s.LastDuration <= 0 || s.Running != 0 {
+		t.Fatalf("stats after a merge of %d bytes into %d: %+v", read, tableSize(), s)
+	}
+
+	mustSet(t, db, "c", "new")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	read = tableSize()
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	after := db.CompactionStats()
+	if after.Compactions != 2 || after.BytesRead != s.BytesRead+read || after.KeysDropped != s.KeysDropped+1 {
+		t.Fatalf("stats after a second merge: %+v, first %+v", after, s)
+	}
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrCorruptedIndex = errors.New("corrupted sparse index")
+
+// SetStrictLoad make LoadFromDiskTable check the sparse index of a table before using it and fail with
+// ErrCorruptedIndex, it covers the tables loaded after it is set, OpenOptions.StrictLoad covers the tables
+// of the root path loaded by OpenWithOptions
+func (t *MEMSSTable) SetStrictLoad(enable bool) {
+	t.lock.Lock()
+	t.strictLoad = enable
+	t.lock.Unlock()
+}
+
+// checkSparseIndex check the entries are in the order blocks are written, with increasing block index
+// and offset inside the data, and each key is in the key range of the table, the keys themselves need
+// not be sorted because a flushed block may start with a smaller key than the block before it
+func checkSparseIndex(metaInfo *SSTableMetaInfo, sparseIndex []*SparseIndex) error {
+	for i, index := range sparseIndex {
+		if uint64(index.DataStart) >= metaInfo.DataStart+metaInfo.DataLength {
+			return fmt.Errorf("%w: block %d offset %d out of data", ErrCorruptedIndex, index.BlockIndex, index.DataStart)
+		}
+		if i > 0 && (index.BlockIndex <= sparseIndex[i-1].BlockIndex || index.DataStart <= sparseIndex[i-1].DataStart) {
+			return fmt.Errorf("%w: block %d at %d after block %d at %d", ErrCorruptedIndex,
+				index.BlockIndex, index.DataStart, sparseIndex[i-1].BlockIndex, sparseIndex[i-1].DataStart)
+		}
+		if metaInfo.Version >= 3 && (index.Key < metaInfo.FirstKey || index.Key > metaInfo.LastKey) {
+			return fmt.Errorf("%w: block %d key %q out of table range [%q, %q]", ErrCorruptedIndex,
+				index.BlockIndex, index.Key, metaInfo.FirstKey, metaInfo.LastKey)
+		}
+	}
+	return nil
+}
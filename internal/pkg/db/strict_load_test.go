@@ -0,0 +1,64 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// writeOutOfOrderTable write a table of two blocks whose sparse index gives the second block index 0
+func writeOutOfOrderTable(t *testing.T, filename string) {
+	t.Helper()
+	pairs := []KV{{"a", "1"}, {"b", "2"}, {"c", "3"}, {"d", "4"}}
+	if err := WriteSSTable(filename, pairs, Options{BlockKeyNum: 2}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaInfo, _, err := readSparseIndex(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each entry is its length, block index, data start, key length and key
+	first := data[metaInfo.IndexStart:]
+	second := first[4+binary.LittleEndian.Uint32(first):]
+	if binary.LittleEndian.Uint32(second[4:]) != 1 {
+		t.Fatalf("second entry has block index %d", binary.LittleEndian.Uint32(second[4:]))
+	}
+	binary.LittleEndian.PutUint32(second[4:], 0)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeOutOfOrderTable(t, dir+"/1.sdb")
+
+	if _, err := OpenWithOptions(dir, 2, 1, OpenOptions{StrictLoad: true}); !errors.Is(err, ErrCorruptedIndex) {
+		t.Fatalf("strict open: %v, want ErrCorruptedIndex", err)
+	}
+	// the failed open released the database, a plain open trusts the index
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+
+	other := t.TempDir()
+	writeOutOfOrderTable(t, other+"/1.sdb")
+	f, err := os.Open(other + "/1.sdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	db.SetStrictLoad(true)
+	if err := db.LoadFromDiskTable(f); !errors.Is(err, ErrCorruptedIndex) {
+		t.Fatalf("strict load: %v, want ErrCorruptedIndex", err)
+	}
+}
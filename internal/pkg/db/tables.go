@@ -0,0 +1,93 @@
+package db
+
+import (
+	"os"
+	"path"
+)
+
+// TableInfo describe a disk table
+type TableInfo struct {
+	ID       uint64 // id in the file name
+	Name     string // file name in the root path
+	Seq      uint64 // creation sequence, newer table wins on query
+	Size     int64  // file size in bytes
+	KeyCount uint64 // number of commands, tombstones and older versions included
+	FirstKey string // smallest key
+	LastKey  string // largest key
+	Version  uint32 // meta info version
+}
+
+// ListTables return the disk tables oldest first, the info is read from meta info, tables written
+// before meta info version 4 have no key count stored and their blocks are read
+func (t *MEMSSTable) ListTables() ([]TableInfo, error) {
+	for {
+		t.lock.RLock()
+		tables := groupSparseIndex(t.sparseIndex)
+		t.lock.RUnlock()
+
+		infos, err := loadTableInfos(tables)
+		// a table is removed by a running compaction, take the tables again
+		if os.IsNotExist(err) {
+			continue
+		}
+		return infos, err
+	}
+}
+
+func loadTableInfos(tables []*tableIndex) ([]TableInfo, error) {
+	infos := make([]TableInfo, 0, len(tables))
+	for _, table := range tables {
+		st, err := os.Stat(table.name)
+		if err != nil {
+			return nil, err
+		}
+		metaInfo, _, err := readTableMetaInfo(table.name)
+		if err != nil {
+			return nil, err
+		}
+		info := TableInfo{
+			Name:     path.Base(table.name),
+			Seq:      table.seq,
+			Size:     st.Size(),
+			KeyCount: metaInfo.KeyCount,
+			FirstKey: metaInfo.FirstKey,
+			LastKey:  metaInfo.LastKey,
+			Version:  metaInfo.Version,
+		}
+		info.ID, _ = tableID(table.name)
+		if metaInfo.Version < 4 {
+			blocks, err := table.loadBlocks()
+			if err != nil {
+				return nil, err
+			}
+			empty := true
+			for _, block := range blocks {
+				if block.Len() == 0 {
+					continue
+				}
+				info.KeyCount += uint64(block.Len())
+				if first := block.data[0].Key; empty || first < info.FirstKey {
+					info.FirstKey = first
+				}
+				if last := block.data[block.Len()-1].Key; empty || last > info.LastKey {
+					info.LastKey = last
+				}
+				empty = false
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// DumpSparseIndex return a copy of the sparse index entries of all disk tables oldest table first,
+// each entry has the first key of a block, its table and the key range of the table, no block is read
+func (t *MEMSSTable) DumpSparseIndex() ([]SparseIndex, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	entries := make([]SparseIndex, len(t.sparseIndex))
+	for i, index := range t.sparseIndex {
+		entries[i] = *index
+	}
+	return entries, nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 2)
+	defer db.Close()
+	if infos, err := db.ListTables(); err != nil || len(infos) != 0 {
+		t.Fatalf("tables of an empty database: %v, %v", infos, err)
+	}
+	for _, group := range [][]string{{"c", "a", "b"}, {"y", "x", "z", "x"}} {
+		for _, key := range group {
+			mustSet(t, db, key, key)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos, err := db.ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := tableFiles(t, dir)
+	if len(infos) != 2 || len(files) != 2 {
+		t.Fatalf("%d infos, %d files, want 2", len(infos), len(files))
+	}
+	for i, want := range []struct {
+		keys        uint64
+		first, last string
+	}{{3, "a", "c"}, {4, "x", "z"}} {
+		info := infos[i]
+		fi, err := os.Stat(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name != filepath.Base(files[i]) || info.Name != fmt.Sprintf("%d.sdb", info.ID) || info.Size != fi.Size() ||
+			info.KeyCount != want.keys || info.FirstKey != want.first || info.LastKey != want.last || info.Version != metaInfoVersion {
+			t.Fatalf("table %d: %+v, want %d keys in [%s, %s]", i, info, want.keys, want.first, want.last)
+		}
+	}
+	if infos[0].Seq >= infos[1].Seq {
+		t.Fatalf("tables are not oldest first: %+v", infos)
+	}
+}
+
+func TestDumpSparseIndex(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 2)
+	for _, group := range [][]string{{"c", "a", "b", "d"}, {"y", "x", "z"}, {"m"}} {
+		for _, key := range group {
+			mustSet(t, db, key, key)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	// the entries are loaded from the tables on open
+	db = openTestDB(t, dir, 2, 2)
+	defer db.Close()
+	entries, err := db.DumpSparseIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := db.ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("%d tables, want 3", len(infos))
+	}
+	blocks := make(map[string][]string)
+	var lastSeq uint64
+	for _, e := range entries {
+		if e.TableSeq < lastSeq {
+			t.Fatalf("entry %+v of an older table after seq %d", e, lastSeq)
+		}
+		lastSeq = e.TableSeq
+		blocks[filepath.Base(e.TableName)] = append(blocks[filepath.Base(e.TableName)], e.Key)
+	}
+	for _, info := range infos {
+		keys := blocks[info.Name]
+		if len(keys) == 0 || keys[0] != info.FirstKey {
+			t.Fatalf("table %s from %s: entries %v, want its first key first", info.Name, info.FirstKey, keys)
+		}
+	}
+	// the first table holds the blocks of c, a and b, d, each memory table is a block
+	if want := []string{"a", "b"}; fmt.Sprint(blocks[infos[0].Name]) != fmt.Sprint(want) {
+		t.Fatalf("entries of the first table %v, want the first keys of its blocks %v", blocks[infos[0].Name], want)
+	}
+
+	// the dump is a copy
+	entries[0].Key = "changed"
+	again, err := db.DumpSparseIndex()
+	if err != nil || again[0].Key == "changed" {
+		t.Fatalf("the dump shares the sparse index: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrSequenceUnavailable = errors.New("sequence is older than the current wal")
+
+// TailIterator is an Iterator of changes in sequence order, Seq is the sequence number of the
+// current change, the next tail can start after it
+type TailIterator interface {
+	Iterator
+	Seq() uint64
+}
+
+// Tail return the changes from fromSeq, the ones still in current wal are replayed first and then new
+// changes follow, Next blocks until a change is committed or Close is called from another goroutine,
+// ErrSequenceUnavailable if changes from fromSeq are already flushed and their wal removed, a tail
+// lagging walStreamBuffer changes behind stops with ErrWALStreamLagged, Seek is not supported
+func (t *MEMSSTable) Tail(fromSeq uint64) (TailIterator, error) {
+	t.lock.Lock()
+	if fromSeq < t.walSeq && fromSeq <= t.seq {
+		t.lock.Unlock()
+		return nil, ErrSequenceUnavailable
+	}
+	history, err := t.walHistory()
+	if err != nil {
+		t.lock.Unlock()
+		return nil, err
+	}
+	id, ch := t.subscribe()
+	t.lock.Unlock()
+
+	return &tailIterator{db: t, from: fromSeq, history: history, id: id, ch: ch, done: make(chan struct{})}, nil
+}
+
+type tailIterator struct {
+	db      *MEMSSTable
+	from    uint64
+	history []walRecord // records of the wal, replayed before new ones
+	id      int
+	ch      chan walRecord
+	done    chan struct{}
+	once    sync.Once
+	cur     Change
+	err     error
+}
+
+func (it *tailIterator) Next() bool {
+	for it.err == nil {
+		var rec walRecord
+		if len(it.history) > 0 {
+			rec, it.history = it.history[0], it.history[1:]
+		} else {
+			var ok bool
+			select {
+			case <-it.done:
+				return false
+			case rec, ok = <-it.ch:
+				if !ok {
+					select {
+					case <-it.done:
+					default:
+						it.err = ErrWALStreamLagged
+					}
+					return false
+				}
+			}
+		}
+		if rec.Seq < it.from {
+			continue
+		}
+		c, err := it.db.change(&rec)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.cur = c
+		return true
+	}
+	return false
+}
+
+// Seek does nothing, changes are returned in sequence order
+func (it *tailIterator) Seek(key string) {}
+
+func (it *tailIterator) Key() string {
+	return it.cur.Key
+}
+
+func (it *tailIterator) Value() string {
+	return it.cur.Value
+}
+
+func (it *tailIterator) Deleted() bool {
+	return it.cur.Type == CommandTypeDelete
+}
+
+func (it *tailIterator) Seq() uint64 {
+	return it.cur.Seq
+}
+
+func (it *tailIterator) Err() error {
+	return it.err
+}
+
+// Close stop the tail, a Next blocked in another goroutine returns false
+func (it *tailIterator) Close() error {
+	it.once.Do(func() {
+		close(it.done)
+		it.db.unsubscribe(it.id)
+	})
+	return nil
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTailAfterRotationMatchesLiveSequence(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	feed, cancel := db.Subscribe()
+	defer cancel()
+	for _, key := range []string{"x", "y", "b", "a"} {
+		mustSet(t, db, key, key)
+	}
+	live := make(map[string]uint64)
+	for i := 0; i < 4; i++ {
+		c := <-feed
+		live[c.Key] = c.Seq
+	}
+	db.RotateMemtable()
+	// x and y are flushed, b and a are rewritten to the new wal
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := db.Tail(live["b"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	for _, key := range []string{"b", "a"} {
+		if !it.Next() {
+			t.Fatalf("tail ended before %s: %v", key, it.Err())
+		}
+		if it.Key() != key || it.Seq() != live[key] {
+			t.Fatalf("tail %s at %d, want %s at %d", it.Key(), it.Seq(), key, live[key])
+		}
+	}
+
+	db.lock.Lock()
+	history, err := db.walHistory()
+	db.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history holds %d records, want 2", len(history))
+	}
+	for _, rec := range history {
+		if rec.Seq != live[rec.Command.Key] {
+			t.Fatalf("history %s at %d, want %d", rec.Command.Key, rec.Seq, live[rec.Command.Key])
+		}
+	}
+}
+
+func TestTailAfterRotationWithDedupGaps(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	db.SetDedupActiveTable(true)
+	for _, key := range []string{"x", "y", "z", "a", "a"} {
+		mustSet(t, db, key, key)
+	}
+	// x and y are flushed, z at 3 and a at 5 are rewritten, a at 4 was replaced
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+	it, err := db.Tail(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	for _, want := range []struct {
+		key string
+		seq uint64
+	}{{"z", 3}, {"a", 5}} {
+		if !it.Next() {
+			t.Fatalf("tail ended before %s: %v", want.key, it.Err())
+		}
+		if it.Key() != want.key || it.Seq() != want.seq {
+			t.Fatalf("tail %s at %d, want %s at %d", it.Key(), it.Seq(), want.key, want.seq)
+		}
+	}
+}
+
+func TestTailFromEarlierSeq(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 100, 10)
+	defer db.Close()
+	want := []struct {
+		key, val string
+		deleted  bool
+	}{{"a", "1", false}, {"b", "2", false}, {"a", "", true}, {"c", "3", false}, {"d", "4", false}}
+	for _, w := range want[:4] {
+		if w.deleted {
+			if err := db.Delete(w.key); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			mustSet(t, db, w.key, w.val)
+		}
+	}
+
+	expectNext := func(it TailIterator, i int) {
+		t.Helper()
+		if !it.Next() {
+			t.Fatalf("tail ended before change %d: %v", i+1, it.Err())
+		}
+		w := want[i]
+		if it.Key() != w.key || it.Value() != w.val || it.Deleted() != w.deleted || it.Seq() != uint64(i+1) {
+			t.Fatalf("tail %s=%q deleted %v at %d, want change %d %+v", it.Key(), it.Value(), it.Deleted(), it.Seq(), i+1, w)
+		}
+	}
+	// a consumer reads two changes and disconnects
+	it, err := db.Tail(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNext(it, 0)
+	expectNext(it, 1)
+	it.Close()
+
+	// it resumes from the second change, which it may not have handled, the history and then live changes follow
+	it, err = db.Tail(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	for i := 1; i < 4; i++ {
+		expectNext(it, i)
+	}
+	mustSet(t, db, "d", "4")
+	expectNext(it, 4)
+
+	// Close from another goroutine ends a Next waiting for a change
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		it.Close()
+	}()
+	if it.Next() {
+		t.Fatalf("tail returned %s after Close", it.Key())
+	}
+
+	// once flushed and the wal removed, the changes can not be tailed
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Tail(1); !errors.Is(err, ErrSequenceUnavailable) {
+		t.Fatalf("tail of flushed changes: %v, want ErrSequenceUnavailable", err)
+	}
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"container/list"
+	"sync"
+)
+
+// valueCache is a LRU cache of values of hot keys, a nil cache caches nothing
+type valueCache struct {
+	lock  sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type valueCacheEntry struct {
+	key string
+	val string
+}
+
+func newValueCache(size int) *valueCache {
+	return &valueCache{size: size, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *valueCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*valueCacheEntry).val, true
+}
+
+func (c *valueCache) add(key, val string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.items[key]; ok {
+		e.Value.(*valueCacheEntry).val = val
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&valueCacheEntry{key: key, val: val})
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*valueCacheEntry).key)
+	}
+}
+
+func (c *valueCache) remove(key string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+// EnableValueCache cache values of the size most recently read keys in memory,
+// a key is dropped from the cache when it is written, 0 disables the cache
+func (t *MEMSSTable) EnableValueCache(size int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if size <= 0 {
+		t.valueCache = nil
+		return
+	}
+	t.valueCache = newValueCache(size)
+}
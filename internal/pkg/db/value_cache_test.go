@@ -0,0 +1,59 @@
+package db
+
+import (
+	"os"
+	"testing"
+)
+
+func TestValueCacheLRU(t *testing.T) {
+	c := newValueCache(2)
+	c.add("a", "1")
+	c.add("b", "2")
+	c.get("a")
+	// b is the least recently used
+	c.add("c", "3")
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b was not evicted")
+	}
+	if val, ok := c.get("a"); !ok || val != "1" {
+		t.Fatalf("a: %q, %v", val, ok)
+	}
+	c.remove("a")
+	if _, ok := c.get("a"); ok {
+		t.Fatal("a was not removed")
+	}
+	var off *valueCache
+	off.add("a", "1")
+	if _, ok := off.get("a"); ok {
+		t.Fatal("the nil cache holds a value")
+	}
+}
+
+func TestValueCache(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	db.EnableValueCache(16)
+	mustSet(t, db, "k", "disk")
+	mustSet(t, db, "l", "l")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "k", "disk")
+	// the second read does not touch the table
+	for _, name := range tableFiles(t, dir) {
+		if err := os.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectValue(t, db, "k", "disk")
+
+	// a write is never shadowed by the cached value
+	mustSet(t, db, "k", "new")
+	expectValue(t, db, "k", "new")
+	expectValue(t, db, "k", "new")
+	if err := db.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	expectNotFound(t, db, "k")
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"errors"
+	"hash/crc32"
+)
+
+var ErrValueChecksum = errors.New("value checksum mismatch")
+
+// SetValueChecksum store a crc32 of the value with each set command written after it, the checksum
+// is verified when the value is read, so a corrupted value is found even if its block is rewritten,
+// for a value in the value log the checksum covers the pointer
+func (t *MEMSSTable) SetValueChecksum(enable bool) {
+	t.lock.Lock()
+	t.valueChecksum = enable
+	t.lock.Unlock()
+}
+
+// checksumValue return a copy of the set command with the checksum of its value if value checksum
+// is enabled, caller must hold the lock
+func (t *MEMSSTable) checksumValue(c *Command) *Command {
+	if !t.valueChecksum || c.Command == CommandTypeDelete {
+		return c
+	}
+	cc := *c
+	cc.checksum = crc32.ChecksumIEEE([]byte(c.Value))
+	cc.hasChecksum = true
+	return &cc
+}
+
+// verifyChecksum return ErrValueChecksum if the command has a checksum not matching its value
+func (t *Command) verifyChecksum() error {
+	if t.hasChecksum && crc32.ChecksumIEEE([]byte(t.Value)) != t.checksum {
+		return ErrValueChecksum
+	}
+	return nil
+}
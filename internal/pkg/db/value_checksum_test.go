@@ -0,0 +1,57 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValueChecksum(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 4, 1)
+	mustSet(t, db, "plain", "value")
+	db.SetValueChecksum(true)
+	mustSet(t, db, "checked", "value")
+	if err := db.Delete("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "checked", "value")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "checked", "value")
+	db.lock.RLock()
+	tables := groupSparseIndex(db.sparseIndex)
+	db.lock.RUnlock()
+	db.Close()
+
+	// both values are changed on disk and the block is written again with a valid frame checksum
+	blocks, err := tables[0].loadBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range blocks[0].data {
+		if c.Command == CommandTypeSet {
+			c.Value = "VALUE"
+		}
+	}
+	metaInfo, _, err := readTableMetaInfo(tables[0].name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newMetaInfo := &SSTableMetaInfo{Version: metaInfoVersion, Seq: metaInfo.Seq, BlockKeyNum: metaInfo.BlockKeyNum, TableBlockNum: metaInfo.TableBlockNum}
+	if _, _, err := writeTableFile(tables[0].name, blocks, newMetaInfo, CodecConfig{}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, dir, 4, 1)
+	defer db.Close()
+	if report, err := db.VerifyIntegrity(); err != nil || len(report.Problems) != 0 {
+		t.Fatalf("the rewritten table is not healthy: %+v, %v", report, err)
+	}
+	if _, err := db.Query("checked"); !errors.Is(err, ErrValueChecksum) {
+		t.Fatalf("query of a corrupted checked value: %v, want ErrValueChecksum", err)
+	}
+	// a value written before the checksum was enabled has none to verify
+	expectValue(t, db, "plain", "VALUE")
+	expectNotFound(t, db, "deleted")
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidValue = errors.New("invalid value")
+
+type ValueEncoding uint8
+
+const (
+	ValueEncodingRaw  ValueEncoding = iota // any bytes are accepted
+	ValueEncodingJSON                      // a set value must be well-formed json
+)
+
+// SetValueEncoding change the encoding the value of a set must have, a write of a value not in the encoding
+// returns ErrInvalidValue, values already stored and replayed from wal are not checked
+func (t *MEMSSTable) SetValueEncoding(e ValueEncoding) error {
+	if e > ValueEncodingJSON {
+		return fmt.Errorf("invalid value encoding: %d", e)
+	}
+	t.lock.Lock()
+	t.valueEncoding = e
+	t.lock.Unlock()
+	return nil
+}
+
+// checkValues return ErrInvalidValue if a set value of the commands is not in the encoding, caller must hold the lock
+func (t *MEMSSTable) checkValues(cmds []*Command) error {
+	if t.valueEncoding != ValueEncodingJSON {
+		return nil
+	}
+	for _, c := range cmds {
+		if c.Command == CommandTypeSet && !json.Valid([]byte(c.Value)) {
+			return fmt.Errorf("%w: value of key %q is not json", ErrInvalidValue, c.Key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValueEncodingJSON(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	if err := db.SetValueEncoding(ValueEncodingJSON + 1); err == nil {
+		t.Fatal("an unknown value encoding is accepted")
+	}
+	// raw by default, a stored value is not checked when the encoding changes
+	mustSet(t, db, "raw", "{not json")
+	if err := db.SetValueEncoding(ValueEncodingJSON); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "raw", "{not json")
+
+	for _, val := range []string{`{"a":1,"b":[true,null]}`, `[1, 2]`, `"text"`, `3.5`, `null`, ` {} `} {
+		mustSet(t, db, "doc", val)
+		expectValue(t, db, "doc", val)
+	}
+	for _, val := range []string{`{not json`, ``, `{"a":}`, `'single'`, `[1,]`, `{} {}`} {
+		if err := db.Set("doc", val); !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("set of %q: %v, want ErrInvalidValue", val, err)
+		}
+	}
+	expectValue(t, db, "doc", ` {} `)
+
+	// a batch with one malformed value writes nothing, a delete has no value to check
+	b := NewBatch()
+	b.Set("ok", `{}`)
+	b.Set("bad", `{`)
+	if err := db.Write(b); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("batch with a malformed value: %v, want ErrInvalidValue", err)
+	}
+	expectNotFound(t, db, "ok")
+	if err := db.Delete("raw"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetValueEncoding(ValueEncodingRaw); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "doc", "{not json")
+	expectValue(t, db, "doc", "{not json")
+}
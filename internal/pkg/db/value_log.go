@@ -0,0 +1,273 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// valuePointer locate a value in the value log
+type valuePointer struct {
+	Offset uint64
+	Length uint32
+}
+
+func (p valuePointer) String() string {
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint64(data, p.Offset)
+	binary.LittleEndian.PutUint32(data[8:], p.Length)
+	return string(data)
+}
+
+func (p *valuePointer) Restore(data string) error {
+	if len(data) != 12 {
+		return fmt.Errorf("invalid value pointer length: %d", len(data))
+	}
+	p.Offset = binary.LittleEndian.Uint64([]byte(data[:8]))
+	p.Length = binary.LittleEndian.Uint32([]byte(data[8:]))
+	return nil
+}
+
+// defaultValueLogSegmentSize is the size after which the value log starts a new segment file
+const defaultValueLogSegmentSize uint64 = 64 << 20
+
+// defaultValueLogGCRatio is the share of live bytes below which compaction moves the values out of a segment
+const defaultValueLogGCRatio = 0.5
+
+// valueLog store large values out of the sstable, values are only appended, the log is split into
+// segment files named by the offset of their first value, so a pointer keeps its offset when the
+// segments before it are removed, only the last segment is written
+type valueLog struct {
+	rootPath    string
+	segments    []uint64 // start offsets of the segments, sorted
+	files       map[uint64]*os.File
+	offset      uint64 // offset of the next value
+	segmentSize uint64
+	lock        sync.RWMutex
+}
+
+// valueLogSegments return the start offsets of the value log segments in rootPath, sorted
+func valueLogSegments(rootPath string) ([]uint64, error) {
+	fs, err := os.ReadDir(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]uint64, 0)
+	for _, f := range fs {
+		if path.Ext(f.Name()) != ".vlog" {
+			continue
+		}
+		if start, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), ".vlog"), 10, 64); err == nil {
+			segments = append(segments, start)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i] < segments[j]
+	})
+	return segments, nil
+}
+
+func newValueLog(rootPath string) (*valueLog, error) {
+	segments, err := valueLogSegments(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	t := &valueLog{rootPath: rootPath, files: make(map[uint64]*os.File), segmentSize: defaultValueLogSegmentSize}
+	if len(segments) == 0 {
+		segments = append(segments, 0)
+	}
+	for _, start := range segments {
+		f, err := os.OpenFile(t.segmentName(start), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		t.files[start] = f
+		t.segments = append(t.segments, start)
+	}
+	head := t.segments[len(t.segments)-1]
+	fi, err := t.files[head].Stat()
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	t.offset = head + uint64(fi.Size())
+	return t, nil
+}
+
+func (t *valueLog) segmentName(start uint64) string {
+	return fmt.Sprintf("%s/%d.vlog", t.rootPath, start)
+}
+
+// segmentOf return the start of the segment holding offset, caller must hold the lock
+func (t *valueLog) segmentOf(offset uint64) uint64 {
+	i := sort.Search(len(t.segments), func(i int) bool {
+		return t.segments[i] > offset
+	})
+	if i == 0 {
+		return 0
+	}
+	return t.segments[i-1]
+}
+
+// head return the start of the segment being written, caller must hold the lock
+func (t *valueLog) head() uint64 {
+	return t.segments[len(t.segments)-1]
+}
+
+func (t *valueLog) Append(val string) (valuePointer, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	// a value is never split, the segment being full starts a new one before it
+	if head := t.head(); t.offset > head && t.offset-head >= t.segmentSize {
+		if err := t.files[head].Sync(); err != nil {
+			return valuePointer{}, err
+		}
+		f, err := os.OpenFile(t.segmentName(t.offset), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return valuePointer{}, err
+		}
+		t.files[t.offset] = f
+		t.segments = append(t.segments, t.offset)
+	}
+	p := valuePointer{Offset: t.offset, Length: uint32(len(val))}
+	n, err := t.files[t.head()].WriteString(val)
+	t.offset += uint64(n)
+	if err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+func (t *valueLog) Read(p valuePointer) (string, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	start := t.segmentOf(p.Offset)
+	f, ok := t.files[start]
+	if !ok {
+		return "", fmt.Errorf("value log segment of offset %d is removed", p.Offset)
+	}
+	data := make([]byte, p.Length)
+	if _, err := f.ReadAt(data, int64(p.Offset-start)); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// sealed return the sealed segments and their sizes, the segment being written is not sealed
+func (t *valueLog) sealed() map[uint64]uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	sizes := make(map[uint64]uint64, len(t.segments)-1)
+	for i := 0; i+1 < len(t.segments); i++ {
+		sizes[t.segments[i]] = t.segments[i+1] - t.segments[i]
+	}
+	return sizes
+}
+
+// filenames return the segment files, the sealed ones first
+func (t *valueLog) filenames() []string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	names := make([]string, 0, len(t.segments))
+	for _, start := range t.segments {
+		names = append(names, t.segmentName(start))
+	}
+	return names
+}
+
+// remove close and delete a sealed segment
+func (t *valueLog) remove(start uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	f, ok := t.files[start]
+	if !ok || start == t.head() {
+		return nil
+	}
+	delete(t.files, start)
+	for i, s := range t.segments {
+		if s == start {
+			t.segments = append(t.segments[:i], t.segments[i+1:]...)
+			break
+		}
+	}
+	f.Close()
+	return os.Remove(t.segmentName(start))
+}
+
+func (t *valueLog) Sync() error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.files[t.head()].Sync()
+}
+
+func (t *valueLog) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var err error
+	for start, f := range t.files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		delete(t.files, start)
+	}
+	return err
+}
+
+// EnableValueLog store values larger than threshold bytes in the value log,
+// the sstable only keeps a pointer to the value, compaction reclaims the segments of
+// overwritten values as set by SetValueLogGC
+func (t *MEMSSTable) EnableValueLog(threshold int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.vlog != nil {
+		t.vlogThreshold = threshold
+		return nil
+	}
+	vlog, err := newValueLog(t.rootPath)
+	if err != nil {
+		return err
+	}
+	vlog.segmentSize = t.vlogSegment
+	t.vlog = vlog
+	t.vlogThreshold = threshold
+	return nil
+}
+
+// separateValue move the value of a large set command into the value log
+func (t *MEMSSTable) separateValue(c *Command) (*Command, error) {
+	if t.vlog == nil || c.Command != CommandTypeSet || len(c.Value) <= t.vlogThreshold {
+		return c, nil
+	}
+	p, err := t.vlog.Append(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&t.stats.valueLogBytes, uint64(len(c.Value)))
+	return &Command{Key: c.Key, Value: p.String(), Command: CommandTypeValuePointer}, nil
+}
+
+// value return the real value of a command, dereference the value pointer if need
+func (t *MEMSSTable) value(c *Command) (string, error) {
+	if err := c.verifyChecksum(); err != nil {
+		return "", err
+	}
+	if c.Command != CommandTypeValuePointer {
+		return c.Value, nil
+	}
+	if t.vlog == nil {
+		return "", errors.New("value log is not enabled")
+	}
+	var p valuePointer
+	if err := p.Restore(c.Value); err != nil {
+		return "", err
+	}
+	return t.vlog.Read(p)
+}
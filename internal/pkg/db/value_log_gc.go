@@ -0,0 +1,229 @@
+package db
+
+import (
+	"errors"
+	"hash/crc32"
+	"sync/atomic"
+)
+
+// SetValueLogGC set the bytes after which the value log starts a new segment and the share of live bytes
+// below which a compaction moves the values its tables point to out of a sealed segment, a sealed segment
+// no disk table and no memory command points into is removed after each compaction, 0 ratio moves nothing,
+// the segment size applies to the segments started after it
+func (t *MEMSSTable) SetValueLogGC(segmentSize uint64, ratio float64) error {
+	if segmentSize == 0 {
+		return errors.New("value log segment size must be positive")
+	}
+	if ratio < 0 || ratio > 1 {
+		return errors.New("value log gc ratio must be between 0 and 1")
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.vlogSegment = segmentSize
+	t.vlogGCRatio = ratio
+	if t.vlog != nil {
+		t.vlog.lock.Lock()
+		t.vlog.segmentSize = segmentSize
+		t.vlog.lock.Unlock()
+	}
+	return nil
+}
+
+// addRefs add the length of each value the commands point to to the segment holding it
+func (t *valueLog) addRefs(refs map[uint64]uint64, cmds CommandData) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for _, c := range cmds {
+		if c.Command != CommandTypeValuePointer {
+			continue
+		}
+		var p valuePointer
+		if p.Restore(c.Value) == nil {
+			refs[t.segmentOf(p.Offset)] += uint64(p.Length)
+		}
+	}
+}
+
+// setValueRefs record the value log references of the blocks of a disk table, caller must hold the lock
+func (t *MEMSSTable) setValueRefs(filename string, blocks []*SSTable) {
+	if t.vlog == nil {
+		return
+	}
+	refs := make(map[uint64]uint64)
+	for _, block := range blocks {
+		t.vlog.addRefs(refs, block.data)
+	}
+	t.vlogRefs[filename] = refs
+}
+
+// loadValueRefs read the value pointers of the disk tables whose references are not known, the tables
+// loaded by Open or added by ingest are read once, caller must hold the vlogGCLock and not the lock
+func (t *MEMSSTable) loadValueRefs() error {
+	t.lock.RLock()
+	unknown := make([]*tableIndex, 0)
+	for _, table := range groupSparseIndex(t.sparseIndex) {
+		if _, ok := t.vlogRefs[table.name]; !ok {
+			unknown = append(unknown, table)
+		}
+	}
+	t.lock.RUnlock()
+	for _, table := range unknown {
+		blocks, err := table.loadBlocks()
+		t.lock.Lock()
+		// a table merged away while it is read is not counted
+		live := false
+		for _, index := range t.sparseIndex {
+			if index.TableName == table.name {
+				live = true
+				break
+			}
+		}
+		if live && err == nil {
+			t.setValueRefs(table.name, blocks)
+		}
+		t.lock.Unlock()
+		if live && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueLogUsage return the bytes the disk tables except the excluded ones and memory commands point to
+// in each segment, false if the references of a disk table are not known, caller must hold the lock
+func (t *MEMSSTable) valueLogUsage(exclude map[string]bool) (map[uint64]uint64, bool) {
+	usage := make(map[uint64]uint64)
+	for _, table := range groupSparseIndex(t.sparseIndex) {
+		if _, ok := t.vlogRefs[table.name]; !ok && !exclude[table.name] {
+			return nil, false
+		}
+	}
+	// a table being written by a compaction is counted before it is added to the sparse index
+	for name, refs := range t.vlogRefs {
+		if exclude[name] {
+			continue
+		}
+		for start, n := range refs {
+			usage[start] += n
+		}
+	}
+	for _, table := range t.immutable {
+		t.vlog.addRefs(usage, table.data)
+	}
+	t.vlog.addRefs(usage, t.activeTable.data)
+	return usage, true
+}
+
+// moveValues append the values the blocks point to in sealed segments with less live bytes than the gc
+// ratio to the end of the value log and point the commands to the copies, the live bytes count the blocks
+// instead of the merged tables, the references of the blocks are recorded for filename before the segments
+// can be removed, caller must hold the vlogGCLock and not the lock
+func (t *MEMSSTable) moveValues(filename string, blocks []*SSTable, merged map[string]bool) error {
+	t.lock.RLock()
+	vlog, ratio := t.vlog, t.vlogGCRatio
+	t.lock.RUnlock()
+	if vlog == nil {
+		return nil
+	}
+	if ratio > 0 {
+		if err := t.loadValueRefs(); err != nil {
+			return err
+		}
+		t.lock.RLock()
+		usage, ok := t.valueLogUsage(merged)
+		t.lock.RUnlock()
+		for _, block := range blocks {
+			vlog.addRefs(usage, block.data)
+		}
+		move := make(map[uint64]bool)
+		for start, size := range vlog.sealed() {
+			if ok && float64(usage[start]) < float64(size)*ratio {
+				move[start] = true
+			}
+		}
+		if err := t.moveSegmentValues(vlog, blocks, move); err != nil {
+			return err
+		}
+	}
+	t.lock.Lock()
+	t.setValueRefs(filename, blocks)
+	t.lock.Unlock()
+	return nil
+}
+
+// moveSegmentValues copy the values in the segments to move to the end of the value log, a command
+// whose checksum does not match is kept as it is so the corruption is still found when it is read
+func (t *MEMSSTable) moveSegmentValues(vlog *valueLog, blocks []*SSTable, move map[uint64]bool) error {
+	if len(move) == 0 {
+		return nil
+	}
+	moved := false
+	for _, block := range blocks {
+		for i, c := range block.data {
+			if c.Command != CommandTypeValuePointer || c.verifyChecksum() != nil {
+				continue
+			}
+			var p valuePointer
+			if err := p.Restore(c.Value); err != nil {
+				return err
+			}
+			vlog.lock.RLock()
+			start := vlog.segmentOf(p.Offset)
+			vlog.lock.RUnlock()
+			if !move[start] {
+				continue
+			}
+			val, err := vlog.Read(p)
+			if err != nil {
+				return err
+			}
+			np, err := vlog.Append(val)
+			if err != nil {
+				return err
+			}
+			atomic.AddUint64(&t.stats.valueLogBytes, uint64(len(val)))
+			cc := *c
+			cc.Value = np.String()
+			if cc.hasChecksum {
+				cc.checksum = crc32.ChecksumIEEE([]byte(cc.Value))
+			}
+			block.data[i] = &cc
+			moved = true
+		}
+	}
+	if !moved {
+		return nil
+	}
+	// the table is written after its values are durable
+	return vlog.Sync()
+}
+
+// collectValueLog remove the sealed segments no disk table and no memory command points into, nothing
+// is removed while the references of a table are not known, caller must hold the vlogGCLock and not the lock
+func (t *MEMSSTable) collectValueLog() error {
+	t.lock.RLock()
+	vlog := t.vlog
+	t.lock.RUnlock()
+	if vlog == nil {
+		return nil
+	}
+	if err := t.loadValueRefs(); err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	usage, ok := t.valueLogUsage(nil)
+	if !ok {
+		return nil
+	}
+	for start := range vlog.sealed() {
+		if usage[start] > 0 {
+			continue
+		}
+		t.countRemoved(vlog.segmentName(start))
+		if err := vlog.remove(start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func largeValue(key string, n int) string {
+	return strings.Repeat(key, n/len(key)+1)[:n]
+}
+
+func vlogSegmentFiles(t *testing.T, db *MEMSSTable) int {
+	t.Helper()
+	segments, err := valueLogSegments(db.rootPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(segments)
+}
+
+func TestValueLog(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	if err := db.EnableValueLog(64); err != nil {
+		t.Fatal(err)
+	}
+	big := largeValue("a", 1000)
+	mustSet(t, db, "big", big)
+	mustSet(t, db, "small", "s")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.vlog.offset; got != 1000 {
+		t.Fatalf("value log holds %d bytes, want 1000", got)
+	}
+	expectValue(t, db, "big", big)
+	expectValue(t, db, "small", "s")
+
+	// the new value is appended, the old one is left as it is
+	newer := largeValue("b", 1000)
+	mustSet(t, db, "big", newer)
+	if got := db.vlog.offset; got != 2000 {
+		t.Fatalf("value log holds %d bytes, want 2000", got)
+	}
+	if v, err := db.vlog.Read(valuePointer{Offset: 0, Length: 1000}); err != nil || v != big {
+		t.Fatalf("old value is rewritten: %v", err)
+	}
+	expectValue(t, db, "big", newer)
+}
+
+func TestValueLogGC(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	if err := db.SetValueLogGC(250, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnableValueLog(10); err != nil {
+		t.Fatal(err)
+	}
+	// keep is the only live value of the first segment once the others are overwritten
+	mustSet(t, db, "keep", largeValue("keep", 100))
+	for i := 0; i < 8; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), largeValue("old", 100))
+	}
+	for i := 0; i < 8; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), largeValue("new", 100))
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// 3 values in each segment, the old values and keep fill the first 3
+	if n := vlogSegmentFiles(t, db); n != 6 {
+		t.Fatalf("%d value log segments, want 6", n)
+	}
+
+	if err := db.MajorCompact(); err != nil {
+		t.Fatal(err)
+	}
+	// keep is moved out of the first segment, the new values stay where they are
+	if n := vlogSegmentFiles(t, db); n != 3 {
+		t.Fatalf("%d value log segments after compaction, want 3", n)
+	}
+	if _, err := os.Stat(db.vlog.segmentName(0)); !os.IsNotExist(err) {
+		t.Fatalf("first segment is kept: %v", err)
+	}
+	check := func(db *MEMSSTable) {
+		t.Helper()
+		expectValue(t, db, "keep", largeValue("keep", 100))
+		for i := 0; i < 8; i++ {
+			expectValue(t, db, fmt.Sprintf("k%d", i), largeValue("new", 100))
+		}
+	}
+	check(db)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	if err := db.EnableValueLog(10); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+}
+
+func TestValueLogGCKeepsMemoryValues(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	if err := db.SetValueLogGC(150, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnableValueLog(10); err != nil {
+		t.Fatal(err)
+	}
+	// two tables of two keys
+	for i := 0; i < 4; i++ {
+		mustSet(t, db, fmt.Sprintf("k%d", i), largeValue("disk", 100))
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// mem fills a segment no table points into, k9 starts the next one
+	mustSet(t, db, "mem", largeValue("mem", 200))
+	mustSet(t, db, "k9", largeValue("head", 100))
+	if err := db.Compact(CompactionOptions{MinThreshold: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if tables, err := db.ListTables(); err != nil || len(tables) != 1 {
+		t.Fatalf("tables after compaction: %v, %v, want 1", tables, err)
+	}
+	expectValue(t, db, "mem", largeValue("mem", 200))
+	expectValue(t, db, "k9", largeValue("head", 100))
+	for i := 0; i < 4; i++ {
+		expectValue(t, db, fmt.Sprintf("k%d", i), largeValue("disk", 100))
+	}
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/pierrec/lz4"
+)
+
+// IntegrityProblem is a problem found in a disk table
+type IntegrityProblem struct {
+	Table   string
+	Message string
+}
+
+// IntegrityReport is the result of VerifyIntegrity, no problem means every table is healthy
+type IntegrityReport struct {
+	Tables   int
+	Blocks   int
+	Problems []IntegrityProblem
+}
+
+// VerifyIntegrity check every disk table of the database without modifying anything: the meta info
+// version and lengths, the sparse index order and its block offsets, the lz4 checksum of each block,
+// the order of keys in each block and the first key of each block in the sparse index, raw blocks
+// have no checksum and are only checked by restoring them
+func (t *MEMSSTable) VerifyIntegrity() (IntegrityReport, error) {
+	// tables are not removed by compaction during the check
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+
+	report := IntegrityReport{Problems: make([]IntegrityProblem, 0)}
+	fs, err := os.ReadDir(t.rootPath)
+	if err != nil {
+		return report, err
+	}
+	for _, f := range fs {
+		if path.Ext(f.Name()) != ".sdb" {
+			continue
+		}
+		name := t.rootPath + "/" + f.Name()
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return report, err
+		}
+		blocks, problems := verifyTable(data)
+		report.Tables++
+		report.Blocks += blocks
+		for _, p := range problems {
+			report.Problems = append(report.Problems, IntegrityProblem{Table: name, Message: p})
+		}
+	}
+	return report, nil
+}
+
+// verifyTable return the number of blocks checked and the problems of the table data
+func verifyTable(data []byte) (int, []string) {
+	problems := make([]string, 0)
+	metaInfo, n, err := readMetaInfo(bytes.NewReader(data))
+	if err == nil {
+		err = metaInfo.checkVersion()
+	}
+	if err != nil {
+		return 0, append(problems, fmt.Sprintf("meta info: %v", err))
+	}
+	if metaInfo.DataStart != 0 || metaInfo.IndexStart != metaInfo.DataStart+metaInfo.DataLength ||
+		metaInfo.IndexStart+metaInfo.IndexLength+uint64(n) != uint64(len(data)) {
+		return 0, append(problems, fmt.Sprintf("meta info lengths %+v do not match file size %d", metaInfo, len(data)))
+	}
+
+	// sparse index
+	indexData := data[metaInfo.IndexStart : metaInfo.IndexStart+metaInfo.IndexLength]
+	sparseIndex := make([]*SparseIndex, 0)
+	for len(indexData) > 0 {
+		if len(indexData) < 4 {
+			problems = append(problems, "sparse index: torn entry length")
+			break
+		}
+		l := binary.LittleEndian.Uint32(indexData)
+		if l < 12 || uint64(l)+4 > uint64(len(indexData)) {
+			problems = append(problems, fmt.Sprintf("sparse index: bad entry length %d", l))
+			break
+		}
+		index := new(SparseIndex)
+		index.Restore(indexData[4 : 4+l])
+		sparseIndex = append(sparseIndex, index)
+		indexData = indexData[4+l:]
+	}
+	if err := checkSparseIndex(metaInfo, sparseIndex); err != nil {
+		problems = append(problems, err.Error())
+	}
+	sort.SliceStable(sparseIndex, func(i, j int) bool {
+		return sparseIndex[i].DataStart < sparseIndex[j].DataStart
+	})
+
+	// blocks follow each other from the start of data
+	pos := metaInfo.DataStart
+	dataEnd := metaInfo.DataStart + metaInfo.DataLength
+	var keyCount, tombstoneCount uint64
+	for _, index := range sparseIndex {
+		if uint64(index.DataStart) != pos {
+			problems = append(problems, fmt.Sprintf("block %d starts at %d, expect %d", index.BlockIndex, index.DataStart, pos))
+			pos = uint64(index.DataStart)
+		}
+		if pos+4 > dataEnd {
+			problems = append(problems, fmt.Sprintf("block %d: offset %d out of data", index.BlockIndex, pos))
+			break
+		}
+		n := binary.LittleEndian.Uint32(data[pos:])
+		l := uint64(n &^ blockFlags)
+		if pos+4+l > dataEnd {
+			problems = append(problems, fmt.Sprintf("block %d: length %d out of data", index.BlockIndex, l))
+			break
+		}
+		block, err := decodeBlock(data[pos+4:pos+4+l], n&blockRawFlag != 0, n&blockPrefixFlag != 0)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("block %d: %v", index.BlockIndex, err))
+		} else {
+			keyCount += uint64(block.Len())
+			for _, c := range block.data {
+				if c.Command == CommandTypeDelete {
+					tombstoneCount++
+				}
+			}
+			for i := 1; i < block.Len(); i++ {
+				if block.data[i].Key < block.data[i-1].Key {
+					problems = append(problems, fmt.Sprintf("block %d: key %q after %q is not sorted", index.BlockIndex, block.data[i].Key, block.data[i-1].Key))
+					break
+				}
+			}
+			if block.Len() == 0 || block.data[0].Key != index.Key {
+				problems = append(problems, fmt.Sprintf("block %d: first key does not match sparse index key %q", index.BlockIndex, index.Key))
+			}
+			if metaInfo.Version >= 3 && block.Len() > 0 && (block.data[0].Key < metaInfo.FirstKey || block.data[block.Len()-1].Key > metaInfo.LastKey) {
+				problems = append(problems, fmt.Sprintf("block %d: keys out of table range [%q, %q]", index.BlockIndex, metaInfo.FirstKey, metaInfo.LastKey))
+			}
+		}
+		pos += 4 + l
+	}
+	if pos != dataEnd {
+		problems = append(problems, fmt.Sprintf("data ends at %d, blocks end at %d", dataEnd, pos))
+	}
+	if metaInfo.Version >= 4 && keyCount != metaInfo.KeyCount {
+		problems = append(problems, fmt.Sprintf("blocks hold %d commands, meta info counts %d", keyCount, metaInfo.KeyCount))
+	}
+	if metaInfo.Version >= 5 && tombstoneCount != metaInfo.TombstoneCount {
+		problems = append(problems, fmt.Sprintf("blocks hold %d tombstones, meta info counts %d", tombstoneCount, metaInfo.TombstoneCount))
+	}
+	return len(sparseIndex), problems
+}
+
+// decodeBlock decompress and restore a block, the lz4 frame checksum is verified, a raw block is only restored
+func decodeBlock(data []byte, raw, prefix bool) (*SSTable, error) {
+	if !raw {
+		lz4r := lz4.NewReader(bytes.NewReader(data))
+		unData := bytes.NewBuffer(nil)
+		if _, err := io.Copy(unData, lz4r); err != nil {
+			return nil, err
+		}
+		data = unData.Bytes()
+	}
+	return restoreBlock(data, prefix)
+}
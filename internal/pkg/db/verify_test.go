@@ -0,0 +1,69 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVerifyIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 2)
+	defer db.Close()
+	for _, key := range []string{"d", "b", "a", "c", "f", "e"} {
+		mustSet(t, db, key, strings.Repeat(key, 64))
+	}
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "g", "g")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := db.VerifyIntegrity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Tables != 2 || report.Blocks != 4 || len(report.Problems) != 0 {
+		t.Fatalf("report of a healthy database: %+v", report)
+	}
+
+	// a flipped byte in the first block and a truncated trailer
+	files := tableFiles(t, dir)
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[20] ^= 0xff
+	if err := os.WriteFile(files[0], data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(files[1], fi.Size()-2); err != nil {
+		t.Fatal(err)
+	}
+	report, err = db.VerifyIntegrity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped, truncated := false, false
+	for _, p := range report.Problems {
+		flipped = flipped || (p.Table == files[0] && strings.HasPrefix(p.Message, "block 0:"))
+		truncated = truncated || (p.Table == files[1] && strings.HasPrefix(p.Message, "meta info"))
+	}
+	if !flipped || !truncated {
+		t.Fatalf("problems %+v miss a corrupt table", report.Problems)
+	}
+	// the check does not modify the tables
+	after, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, data) {
+		t.Fatal("VerifyIntegrity modified a table")
+	}
+}
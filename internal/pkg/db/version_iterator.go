@@ -0,0 +1,68 @@
+package db
+
+import "container/heap"
+
+// versionIterator merge blocks of disk tables in key order, all versions of a key are returned
+// together from the newest to the oldest, it is used by compaction to pick the winner
+type versionIterator struct {
+	sources  sourceHeap
+	key      string
+	versions []*Command
+}
+
+// newVersionIterator load the blocks of tables, tables are ordered from the oldest to the newest
+func newVersionIterator(tables []*tableIndex) (*versionIterator, error) {
+	it := new(versionIterator)
+	priority := 0
+	for _, table := range tables {
+		blocks, err := table.loadBlocks()
+		if err != nil {
+			return nil, err
+		}
+		// a later block of a table is newer
+		for _, block := range blocks {
+			priority++
+			if block.Len() > 0 {
+				it.sources = append(it.sources, &rangeSource{priority: priority, data: block.data})
+			}
+		}
+	}
+	heap.Init(&it.sources)
+	return it, nil
+}
+
+func (it *versionIterator) Next() bool {
+	it.versions = it.versions[:0]
+	if len(it.sources) == 0 {
+		return false
+	}
+	// the top is the newest source of the smallest key
+	it.key = it.sources[0].key()
+	for len(it.sources) > 0 && it.sources[0].key() == it.key {
+		s := it.sources[0]
+		j := s.pos
+		for j < len(s.data) && s.data[j].Key == it.key {
+			j++
+		}
+		// the same key keeps the append order in a block, the last one is the newest
+		for k := j - 1; k >= s.pos; k-- {
+			it.versions = append(it.versions, s.data[k])
+		}
+		s.pos = j
+		if s.valid() {
+			heap.Fix(&it.sources, 0)
+		} else {
+			heap.Pop(&it.sources)
+		}
+	}
+	return true
+}
+
+func (it *versionIterator) Key() string {
+	return it.key
+}
+
+// Versions return the versions of the current key, the newest first
+func (it *versionIterator) Versions() []*Command {
+	return it.versions
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVersionIterator(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 4, 1)
+	defer db.Close()
+	// three overlapping tables, a is set twice in the same block of the second one
+	for _, table := range [][]string{{"a=1", "b=1"}, {"b=2", "a=2", "c=2", "a=2b"}, {"a=3", "d=3", "c=3"}} {
+		for _, kv := range table {
+			i := strings.IndexByte(kv, '=')
+			mustSet(t, db, kv[:i], kv[i+1:])
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.lock.RLock()
+	tables := groupSparseIndex(db.sparseIndex)
+	db.lock.RUnlock()
+	it, err := newVersionIterator(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for it.Next() {
+		values := make([]string, 0)
+		for _, v := range it.Versions() {
+			values = append(values, v.Value)
+		}
+		got = append(got, it.Key()+":"+strings.Join(values, ","))
+	}
+	want := []string{"a:3,2b,2,1", "b:2,1", "c:3,2", "d:3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("versions %v, want %v", got, want)
+	}
+}
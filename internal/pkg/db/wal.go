@@ -1,13 +1,40 @@
 package db
 
 import (
+	"bufio"
 	"encoding/binary"
+	"fmt"
+	"io"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pierrec/lz4"
+)
+
+type SyncPolicy uint8
+
+const (
+	SyncNever      SyncPolicy = iota // leave wal writes to the os page cache
+	SyncEveryWrite                   // fsync the wal before a write returns
 )
 
+// walFile is the file which wal writes to
+type walFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+// walCompressedFlag mark a compressed record in the record length
+const walCompressedFlag uint32 = 1 << 31
+
 type wal struct {
 	filename string
-	f        *os.File
+	f        walFile
+	buf      *bufio.Writer // buffer records before the file, nil means unbuffered
+	compress bool          // compress each record with lz4
 }
 
 func NewWAL(filename string) (*wal, error) {
@@ -15,16 +42,153 @@ func NewWAL(filename string) (*wal, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &wal{filename, f}, nil
+	return &wal{filename: filename, f: f}, nil
+}
+
+// openWAL open a wal to append after its first size bytes, a torn record after them is truncated,
+// otherwise a record appended after it could not be read
+func openWAL(filename string, size int64) (*wal, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > size {
+		if err := os.Truncate(filename, size); err != nil {
+			return nil, err
+		}
+	}
+	return NewWAL(filename)
+}
+
+// newSequenceCommand return the wal record of the sequence number of the next command and the sequence
+// before which versions are dropped from memory tables, a record of the older 8 bytes has only the first
+func newSequenceCommand(seq, dropped uint64) *Command {
+	value := make([]byte, 16)
+	binary.LittleEndian.PutUint64(value, seq)
+	binary.LittleEndian.PutUint64(value[8:], dropped)
+	return &Command{Command: CommandTypeSequence, Value: string(value)}
+}
+
+// commandDroppedSeq return the dropped sequence of a CommandTypeSequence record, 0 if it has none
+func commandDroppedSeq(c *Command) uint64 {
+	if len(c.Value) < 16 {
+		return 0
+	}
+	return binary.LittleEndian.Uint64([]byte(c.Value[8:]))
+}
+
+// commandSequence return the sequence number of a CommandTypeSequence record
+func commandSequence(c *Command) uint64 {
+	if len(c.Value) < 8 {
+		return 0
+	}
+	return binary.LittleEndian.Uint64([]byte(c.Value))
+}
+
+// walHasSequence report whether the first record of the wal file is the sequence number
+func walHasSequence(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	found := false
+	readWAL(f, func(cmd *Command) error {
+		found = cmd.Command == CommandTypeSequence
+		return io.EOF
+	})
+	return found
+}
+
+// setBuffer buffer records in memory up to size bytes before writing the file, 0 means unbuffered,
+// records already buffered are written first
+func (t *wal) setBuffer(size int) error {
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	t.buf = nil
+	if size > 0 {
+		t.buf = bufio.NewWriterSize(t.f, size)
+	}
+	return nil
 }
 
-func (t *wal) Append(c *Command) error {
+func (t *wal) writer() io.Writer {
+	if t.buf != nil {
+		return t.buf
+	}
+	return t.f
+}
+
+// Append write the command to wal and return the bytes written, a buffered record is not in the
+// file until the buffer is full or flushed
+func (t *wal) Append(c *Command) (int, error) {
 	n, body := c.Bytes()
-	binary.Write(t.f, binary.LittleEndian, uint32(n))
-	_, err := t.f.Write(body)
-	return err
+	return t.appendRecord(n, body)
+}
+
+// appendWithSeq write the command with its sequence number, as rotation rewrites the commands in memory,
+// so replay gives them back their sequence numbers
+func (t *wal) appendWithSeq(c *Command) (int, error) {
+	n, body := c.tableBytes()
+	return t.appendRecord(n, body)
 }
 
+func (t *wal) appendRecord(n int, body []byte) (int, error) {
+	if t.compress {
+		if data := compressWALRecord(body); data != nil {
+			n, body = len(data), data
+			n |= int(walCompressedFlag)
+		}
+	}
+	w := t.writer()
+	if err := binary.Write(w, binary.LittleEndian, uint32(n)); err != nil {
+		return 0, err
+	}
+	nn, err := w.Write(body)
+	return 4 + nn, err
+}
+
+// compressWALRecord return rawLength(4) + lz4 block of the record, nil if it is not smaller
+func compressWALRecord(body []byte) []byte {
+	data := make([]byte, 4+lz4.CompressBlockBound(len(body)))
+	binary.LittleEndian.PutUint32(data, uint32(len(body)))
+	n, err := lz4.CompressBlock(body, data[4:], nil)
+	if err != nil || n == 0 || 4+n >= len(body) {
+		return nil
+	}
+	return data[:4+n]
+}
+
+func uncompressWALRecord(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("wal record too short: %d", len(data))
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(data))
+	n, err := lz4.UncompressBlock(data[4:], body)
+	if err != nil {
+		return nil, err
+	}
+	return body[:n], nil
+}
+
+// Flush write the buffered records to the file without fsync
+func (t *wal) Flush() error {
+	if t.buf == nil {
+		return nil
+	}
+	return t.buf.Flush()
+}
+
+// Sync write the buffered records and fsync the file
+func (t *wal) Sync() error {
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	return t.f.Sync()
+}
+
+// Remove close and delete the wal, buffered records are dropped
 func (t *wal) Remove() error {
 	if err := t.f.Close(); err != nil {
 		return err
@@ -33,5 +197,15 @@ func (t *wal) Remove() error {
 }
 
 func (t *wal) Close() error {
+	if err := t.Flush(); err != nil {
+		t.f.Close()
+		return err
+	}
 	return t.f.Close()
 }
+
+// walID parse the id from the file name of a wal
+func walID(filename string) (uint64, bool) {
+	id, err := strconv.ParseUint(strings.TrimSuffix(path.Base(filename), ".wal"), 10, 64)
+	return id, err == nil
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// walStreamBuffer is the number of records buffered for a slow stream before it is dropped
+const walStreamBuffer = 1024
+
+var (
+	ErrWALStreamGap    = errors.New("wal stream sequence gap")
+	ErrWALStreamLagged = errors.New("wal stream lagged behind and was dropped")
+)
+
+// walRecord is a command with its sequence number
+type walRecord struct {
+	Seq     uint64
+	Command *Command
+}
+
+// Bytes encode the record as: seq(8), commandLength(4), command(N)
+func (r *walRecord) Bytes() (int, []byte) {
+	n, body := r.Command.Bytes()
+	data := make([]byte, 12+n)
+	binary.LittleEndian.PutUint64(data, r.Seq)
+	binary.LittleEndian.PutUint32(data[8:], uint32(n))
+	copy(data[12:], body)
+	return len(data), data
+}
+
+func readWALRecord(r io.Reader) (*walRecord, error) {
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.LittleEndian.Uint32(head[8:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	rec := &walRecord{Seq: binary.LittleEndian.Uint64(head), Command: new(Command)}
+	rec.Command.Restore(data)
+	return rec, nil
+}
+
+// publish send the record to all streams, a stream which can not keep up is dropped
+func (t *MEMSSTable) publish(rec walRecord) {
+	for id, ch := range t.streams {
+		select {
+		case ch <- rec:
+		default:
+			close(ch)
+			delete(t.streams, id)
+		}
+	}
+}
+
+func (t *MEMSSTable) subscribe() (int, chan walRecord) {
+	t.streamID++
+	ch := make(chan walRecord, walStreamBuffer)
+	t.streams[t.streamID] = ch
+	return t.streamID, ch
+}
+
+func (t *MEMSSTable) unsubscribe(id int) {
+	t.lock.Lock()
+	if ch, ok := t.streams[id]; ok {
+		close(ch)
+		delete(t.streams, id)
+	}
+	t.lock.Unlock()
+}
+
+// StreamWAL write the records of current wal and all new records to w, until ctx is done
+func (t *MEMSSTable) StreamWAL(ctx context.Context, w io.Writer) error {
+	t.lock.Lock()
+	history, err := t.walHistory()
+	if err != nil {
+		t.lock.Unlock()
+		return err
+	}
+	id, ch := t.subscribe()
+	t.lock.Unlock()
+	defer t.unsubscribe(id)
+
+	for i := range history {
+		// versions replaced in the active table leave gaps in the history, the follower is told to skip them
+		if i > 0 && history[i].Seq > history[i-1].Seq+1 {
+			skip := walRecord{Seq: history[i-1].Seq + 1, Command: newSequenceCommand(history[i].Seq, 0)}
+			if err := t.writeWALRecord(w, &skip); err != nil {
+				return err
+			}
+		}
+		if err := t.writeWALRecord(w, &history[i]); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case rec, ok := <-ch:
+			if !ok {
+				return ErrWALStreamLagged
+			}
+			if err := t.writeWALRecord(w, &rec); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// walHistory read the records of current wal with their sequence numbers, caller must hold the lock
+func (t *MEMSSTable) walHistory() ([]walRecord, error) {
+	// buffered records must be in the file to be read
+	if err := t.wal.Flush(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(t.wal.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	history := make([]walRecord, 0)
+	seq := t.walSeq
+	err = readWAL(f, func(cmd *Command) error {
+		cmd, _ = unwrapWriteID(cmd)
+		if cmd.Command == CommandTypeSequence {
+			seq = commandSequence(cmd)
+			return nil
+		}
+		if cmd.Command == CommandTypeWriteIDs {
+			return nil
+		}
+		for _, c := range unwrapBatch(cmd) {
+			// a command rewritten by rotation stores its sequence number, the next ones follow it
+			if c.seq != 0 {
+				seq = c.seq
+			}
+			history = append(history, walRecord{Seq: seq, Command: c})
+			seq++
+		}
+		return nil
+	})
+	return history, err
+}
+
+// writeWALRecord write a record to the stream, value pointers are resolved because
+// the follower does not share the value log
+func (t *MEMSSTable) writeWALRecord(w io.Writer, rec *walRecord) error {
+	if rec.Command.Command == CommandTypeValuePointer {
+		val, err := t.value(rec.Command)
+		if err != nil {
+			return err
+		}
+		rec = &walRecord{Seq: rec.Seq, Command: &Command{Key: rec.Command.Key, Value: val, Command: CommandTypeSet}}
+	}
+	_, data := rec.Bytes()
+	_, err := w.Write(data)
+	return err
+}
+
+// ApplyWALStream apply the records from a leader's StreamWAL until r is closed, a sequence record
+// moves the next expected sequence number past versions the leader no longer has
+func (t *MEMSSTable) ApplyWALStream(r io.Reader) error {
+	var last uint64
+	for {
+		rec, err := readWALRecord(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if last != 0 && rec.Seq != last+1 {
+			return fmt.Errorf("%w: expect %d, got %d", ErrWALStreamGap, last+1, rec.Seq)
+		}
+		last = rec.Seq
+		if rec.Command.Command == CommandTypeSequence {
+			last = commandSequence(rec.Command) - 1
+			continue
+		}
+		if err := t.command(rec.Command, false); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestStreamWAL(t *testing.T) {
+	leader := openTestDB(t, t.TempDir(), 2, 1)
+	defer leader.Close()
+	follower := openTestDB(t, t.TempDir(), 2, 1)
+	defer follower.Close()
+	// written before the stream starts, sent from the wal
+	mustSet(t, leader, "k0", "v0")
+	mustSet(t, leader, "k1", "v1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	streamed := make(chan error, 1)
+	go func() {
+		err := leader.StreamWAL(ctx, pw)
+		pw.Close()
+		streamed <- err
+	}()
+	applied := make(chan error, 1)
+	go func() {
+		applied <- follower.ApplyWALStream(pr)
+	}()
+
+	for i := 2; i < 6; i++ {
+		mustSet(t, leader, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+	if err := leader.Delete("k1"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the follower", func() bool {
+		return follower.LastSequence() == leader.LastSequence()
+	})
+	cancel()
+	if err := <-streamed; !errors.Is(err, context.Canceled) {
+		t.Fatalf("stream: %v", err)
+	}
+	if err := <-applied; err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		key := fmt.Sprintf("k%d", i)
+		want, werr := leader.Query(key)
+		got, gerr := follower.Query(key)
+		if got != want || gerr != werr {
+			t.Fatalf("%s: follower %q, %v, leader %q, %v", key, got, gerr, want, werr)
+		}
+	}
+}
+
+func TestApplyWALStreamGap(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	buf := bytes.NewBuffer(nil)
+	for _, rec := range []walRecord{
+		{Seq: 1, Command: &Command{Key: "a", Value: "1", Command: CommandTypeSet}},
+		{Seq: 3, Command: &Command{Key: "b", Value: "2", Command: CommandTypeSet}},
+	} {
+		_, data := rec.Bytes()
+		buf.Write(data)
+	}
+	if err := db.ApplyWALStream(buf); !errors.Is(err, ErrWALStreamGap) {
+		t.Fatalf("apply: %v, want ErrWALStreamGap", err)
+	}
+	expectValue(t, db, "a", "1")
+	expectNotFound(t, db, "b")
+}
+
+func TestStreamWALWithDedupGaps(t *testing.T) {
+	leader := openTestDB(t, t.TempDir(), 2, 1)
+	defer leader.Close()
+	leader.SetDedupActiveTable(true)
+	for _, key := range []string{"x", "y", "z", "a", "a"} {
+		mustSet(t, leader, key, key+"1")
+	}
+	// z at 3 and a at 5 are rewritten to the new wal, a at 4 was replaced
+	if _, err := leader.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := leader.StreamWAL(ctx, buf); !errors.Is(err, context.Canceled) {
+		t.Fatalf("stream: %v", err)
+	}
+
+	follower := openTestDB(t, t.TempDir(), 2, 1)
+	defer follower.Close()
+	if err := follower.ApplyWALStream(buf); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	expectValue(t, follower, "z", "z1")
+	expectValue(t, follower, "a", "a1")
+}
@@ -0,0 +1,414 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func isSequenceTooOld(err error) bool {
+	return errors.Is(err, ErrSequenceTooOld)
+}
+
+func TestRotateWALKeepsSequenceNumbers(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	for _, key := range []string{"x", "y", "b", "a"} {
+		mustSet(t, db, key, key)
+	}
+	db.RotateMemtable()
+	// flushes x, y and rewrites b, a, sorted by key in their table, to the new wal
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+	assertSeqs := func(db *MEMSSTable) {
+		t.Helper()
+		for key, seq := range map[string]uint64{"b": 3, "a": 4} {
+			db.lock.RLock()
+			c, err := db.getLocked(key)
+			db.lock.RUnlock()
+			if err != nil || c.seq != seq {
+				t.Fatalf("%s: seq %v, %v, want %d", key, c, err, seq)
+			}
+		}
+		if v, err := db.QueryAt("b", 3); err != nil || v != "b" {
+			t.Fatalf("b as of 3: %q, %v", v, err)
+		}
+		if _, err := db.QueryAt("a", 3); err != ErrKeyNotFound {
+			t.Fatalf("a as of 3: %v", err)
+		}
+		if seq := db.LastSequence(); seq != 4 {
+			t.Fatalf("last sequence %d, want 4", seq)
+		}
+	}
+	assertSeqs(db)
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	assertSeqs(db)
+	mustSet(t, db, "c", "c")
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	if seq := db.LastSequence(); seq != 5 {
+		t.Fatalf("last sequence %d, want 5", seq)
+	}
+	if _, err := db.QueryAt("c", 4); err != ErrKeyNotFound {
+		t.Fatalf("c as of 4: %v", err)
+	}
+	expectValue(t, db, "c", "c")
+	db.Close()
+}
+
+func TestRotateWALWithDedupGaps(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	db.SetDedupActiveTable(true)
+	mustSet(t, db, "x", "1")
+	mustSet(t, db, "y", "2")
+	mustSet(t, db, "z", "3") // x and y become immutable
+	mustSet(t, db, "a", "4") // replaced by the next write
+	mustSet(t, db, "a", "5")
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+	db.lock.RLock()
+	walSeq := db.walSeq
+	db.lock.RUnlock()
+	if walSeq != 3 {
+		t.Fatalf("wal seq %d, want 3", walSeq)
+	}
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	if v, err := db.QueryAt("a", 5); err != nil || v != "5" {
+		t.Fatalf("a as of 5: %q, %v", v, err)
+	}
+	// the version of a at 4 was dropped by dedup, the limit is kept by the wal
+	if _, err := db.QueryAt("a", 4); !isSequenceTooOld(err) {
+		t.Fatalf("a as of 4: %v, want ErrSequenceTooOld", err)
+	}
+	if seq := db.LastSequence(); seq != 5 {
+		t.Fatalf("last sequence %d, want 5", seq)
+	}
+	db.Close()
+}
+
+func TestSyncEveryWriteReturnsSyncError(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	db.SetSyncPolicy(SyncEveryWrite)
+	f := injectWALFault(db)
+
+	f.syncErr = errInjected
+	if err := db.Set("k", "v"); !errors.Is(err, errInjected) {
+		t.Fatalf("set with a failing sync: %v, want the sync error", err)
+	}
+	expectNotFound(t, db, "k")
+
+	f.syncErr = nil
+	mustSet(t, db, "k", "v")
+	expectValue(t, db, "k", "v")
+}
+
+func TestSyncNeverSkipsSync(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	f := injectWALFault(db)
+	// without SyncEveryWrite the write returns once the record is in the file
+	f.syncErr = errInjected
+	mustSet(t, db, "k", "v")
+	f.writeErr = errInjected
+	if err := db.Set("k", "w"); !errors.Is(err, errInjected) {
+		t.Fatalf("set with a failing write: %v, want the write error", err)
+	}
+	expectValue(t, db, "k", "v")
+	f.syncErr, f.writeErr = nil, nil
+}
+
+func TestCompressedWALRecovery(t *testing.T) {
+	walSize := func(c CodecConfig, dir string) int64 {
+		db := openTestDB(t, dir, 100, 10)
+		if err := db.SetCodec(c); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			mustSet(t, db, fmt.Sprintf("k%02d", i), strings.Repeat(fmt.Sprintf("value%d", i), 50))
+		}
+		// a short record does not get smaller and is kept raw
+		mustSet(t, db, "last", "x")
+		filename := db.wal.filename
+		crash(t, db)
+		fi, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	dir := t.TempDir()
+	rawSize := walSize(CodecConfig{}, t.TempDir())
+	size := walSize(CodecConfig{CompressWAL: true}, dir)
+	if size >= rawSize/2 {
+		t.Fatalf("compressed wal is %d bytes, raw wal is %d", size, rawSize)
+	}
+
+	// records carry their own flag, a store opened without compression replays them
+	check := func(db *MEMSSTable) {
+		t.Helper()
+		for i := 0; i < 20; i++ {
+			expectValue(t, db, fmt.Sprintf("k%02d", i), strings.Repeat(fmt.Sprintf("value%d", i), 50))
+		}
+	}
+	db := openTestDB(t, dir, 100, 10)
+	check(db)
+	expectValue(t, db, "last", "x")
+	if err := db.SetCodec(CodecConfig{CompressWAL: true}); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "torn", strings.Repeat("torn", 100))
+	filename := db.wal.filename
+	crash(t, db)
+
+	// a torn compressed record loses only itself
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filename, fi.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDB(t, dir, 100, 10)
+	check(db)
+	expectNotFound(t, db, "torn")
+	mustSet(t, db, "after", "after")
+	crash(t, db)
+
+	db = openTestDB(t, dir, 100, 10)
+	defer db.Close()
+	check(db)
+	expectValue(t, db, "after", "after")
+}
+
+func TestSyncReturnsFaults(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	f := injectWALFault(db)
+	if err := db.SetWALBufferSize(4096); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "k", "v")
+
+	f.syncErr = errInjected
+	if err := db.Sync(); !errors.Is(err, errInjected) {
+		t.Fatalf("sync with a failing fsync: %v, want the fsync error", err)
+	}
+	f.syncErr = nil
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the buffered record is written by Sync, a failing write is returned too
+	mustSet(t, db, "l", "v")
+	f.writeErr = errInjected
+	if err := db.Sync(); !errors.Is(err, errInjected) {
+		t.Fatalf("sync with a failing write: %v, want the write error", err)
+	}
+	f.writeErr = nil
+
+	// Sync does not rotate or flush the active table
+	db.lock.RLock()
+	immutable, active := len(db.immutable), db.activeTable.Len()
+	db.lock.RUnlock()
+	if immutable != 0 || active != 2 || len(tableFiles(t, dir)) != 0 {
+		t.Fatalf("sync left %d immutable tables, %d active commands, want 0 and 2", immutable, active)
+	}
+}
+
+func TestCrashDuringWALRotation(t *testing.T) {
+	for _, keepNewWAL := range []bool{false, true} {
+		dir := t.TempDir()
+		db := openTestDB(t, dir, 2, 1)
+		for i := 0; i < 6; i++ {
+			mustSet(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+		}
+		db.lock.Lock()
+		if err := db.wal.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		oldWAL := db.wal.filename
+		db.lock.Unlock()
+		data, err := os.ReadFile(oldWAL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// k0 and k1 are flushed, the rest is rewritten to a new wal
+		if _, err := db.FlushOne(); err != nil {
+			t.Fatal(err)
+		}
+		newWAL := db.wal.filename
+		crash(t, db)
+
+		// the crash happened after the table was renamed, before or after the new wal was written,
+		// the old wal was not removed yet
+		if !keepNewWAL {
+			if err := os.Remove(newWAL); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(oldWAL, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		db = openTestDB(t, dir, 2, 1)
+		check := func(db *MEMSSTable) {
+			t.Helper()
+			for i := 0; i < 6; i++ {
+				expectValue(t, db, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+			}
+			if seq := db.LastSequence(); seq != 6 {
+				t.Fatalf("keep new wal %v: last sequence %d, want 6", keepNewWAL, seq)
+			}
+		}
+		check(db)
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if n := tableKeyCount(t, db); n != 6 {
+			t.Fatalf("keep new wal %v: %d commands on disk, want 6", keepNewWAL, n)
+		}
+		db.Close()
+		db = openTestDB(t, dir, 2, 1)
+		check(db)
+		db.Close()
+	}
+}
+
+// kill release the database as a killed process would, the buffered wal records are lost
+func kill(t *testing.T, db *MEMSSTable) {
+	t.Helper()
+	db.lock.Lock()
+	db.wal.buf = nil
+	db.lock.Unlock()
+	crash(t, db)
+}
+
+func TestWALBuffer(t *testing.T) {
+	dir := t.TempDir()
+	reopen := func(db *MEMSSTable) *MEMSSTable {
+		t.Helper()
+		kill(t, db)
+		db = openTestDB(t, dir, 100, 1)
+		if err := db.SetWALBufferSize(4096); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	db := openTestDB(t, dir, 100, 1)
+	if err := db.SetWALBufferSize(-1); err == nil {
+		t.Fatal("a negative wal buffer size is accepted")
+	}
+	if err := db.SetWALBufferSize(4096); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "lost", "v")
+	db = reopen(db)
+	expectNotFound(t, db, "lost")
+
+	mustSet(t, db, "synced", "v")
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "written", "v")
+	if err := db.FlushWAL(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "lost", "v")
+	db = reopen(db)
+	expectValue(t, db, "synced", "v")
+	expectValue(t, db, "written", "v")
+	expectNotFound(t, db, "lost")
+
+	// SyncEveryWrite drains the buffer on each write, the wal after a flush is buffered too
+	db.SetSyncPolicy(SyncEveryWrite)
+	mustSet(t, db, "durable", "v")
+	db = reopen(db)
+	expectValue(t, db, "durable", "v")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "lost", "v")
+	db.lock.RLock()
+	buffered := db.wal.buf != nil && db.wal.buf.Buffered() > 0
+	db.lock.RUnlock()
+	if !buffered {
+		t.Fatal("the wal after a flush is not buffered")
+	}
+	db = reopen(db)
+	defer db.Close()
+	expectValue(t, db, "durable", "v")
+	expectNotFound(t, db, "lost")
+}
+
+func TestReopenReusesWAL(t *testing.T) {
+	dir := t.TempDir()
+	walFiles := func() []string {
+		t.Helper()
+		names, err := filepath.Glob(dir + "/*.wal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+	db := openTestDB(t, dir, 100, 10)
+	mustSet(t, db, "a", "1")
+	mustSet(t, db, "b", "2")
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	filename := db.wal.filename
+	crash(t, db)
+
+	// nothing was flushed, the commands are replayed and the wal is written on
+	db = openTestDB(t, dir, 100, 10)
+	expectNotFound(t, db, "a")
+	expectValue(t, db, "b", "2")
+	if db.wal.filename != filename || len(tableFiles(t, dir)) != 0 {
+		t.Fatalf("reopened with wal %s and %d tables, want %s reused and no table", db.wal.filename, len(tableFiles(t, dir)), filename)
+	}
+	if names := walFiles(); len(names) != 1 {
+		t.Fatalf("wal files %v, want only the reused one", names)
+	}
+	mustSet(t, db, "c", "3")
+	crash(t, db)
+
+	// a torn last record is cut, the next write follows the complete records
+	db = openTestDB(t, dir, 100, 10)
+	mustSet(t, db, "torn", "v")
+	crash(t, db)
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filename, fi.Size()-2); err != nil {
+		t.Fatal(err)
+	}
+	db = openTestDB(t, dir, 100, 10)
+	expectNotFound(t, db, "torn")
+	mustSet(t, db, "d", "4")
+	crash(t, db)
+
+	db = openTestDB(t, dir, 100, 10)
+	defer db.Close()
+	expectNotFound(t, db, "a")
+	expectNotFound(t, db, "torn")
+	for key, val := range map[string]string{"b": "2", "c": "3", "d": "4"} {
+		expectValue(t, db, key, val)
+	}
+	if seq := db.LastSequence(); seq != 5 {
+		t.Fatalf("last sequence %d, want 5", seq)
+	}
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+const warmupChunkSize = 1 << 20
+
+// Warmup read every disk table once so the first queries hit the page cache, sparse indexes are
+// already loaded by Open, the read stops when ctx is done
+func (t *MEMSSTable) Warmup(ctx context.Context) error {
+	t.lock.RLock()
+	tables := groupSparseIndex(t.sparseIndex)
+	t.lock.RUnlock()
+
+	buf := make([]byte, warmupChunkSize)
+	for _, table := range tables {
+		if err := warmupFile(ctx, table.name, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func warmupFile(ctx context.Context, filename string, buf []byte) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		// the table is removed by compaction
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := f.Read(buf); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWarmup(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		mustSet(t, db, key, key)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	// the sparse indexes are loaded by Open, a query only reads its block
+	db.lock.RLock()
+	indexes := len(db.sparseIndex)
+	db.lock.RUnlock()
+	if indexes != 2 {
+		t.Fatalf("%d sparse indexes after open, want 2", indexes)
+	}
+	if err := db.Warmup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "a", "a")
+	// a table removed by a compaction is skipped
+	if err := warmupFile(context.Background(), dir+"/missing.sdb", make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := db.Warmup(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("warmup with a canceled context: %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// recentWriteIDNum is the number of write ids remembered
+const recentWriteIDNum = 10000
+
+// writeIDSet remember the recent write ids, the oldest id is forgotten when it is full
+type writeIDSet struct {
+	ids   map[string]struct{}
+	order []string
+	pos   int
+}
+
+func newWriteIDSet(n int) *writeIDSet {
+	return &writeIDSet{ids: make(map[string]struct{}, n), order: make([]string, n)}
+}
+
+func (s *writeIDSet) has(id string) bool {
+	_, ok := s.ids[id]
+	return ok
+}
+
+func (s *writeIDSet) add(id string) {
+	if s.has(id) {
+		return
+	}
+	if old := s.order[s.pos]; old != "" {
+		delete(s.ids, old)
+	}
+	s.order[s.pos] = id
+	s.pos = (s.pos + 1) % len(s.order)
+	s.ids[id] = struct{}{}
+}
+
+// list return the ids from the oldest to the newest
+func (s *writeIDSet) list() []string {
+	ids := make([]string, 0, len(s.ids))
+	for i := range s.order {
+		if id := s.order[(s.pos+i)%len(s.order)]; id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// newWriteIDsCommand return the wal record of the recent write ids as: idLength(4), id, ... oldest first,
+// rotation writes it so the ids of flushed writes are still known after restart
+func newWriteIDsCommand(ids []string) *Command {
+	buf := bytes.NewBuffer(nil)
+	for _, id := range ids {
+		binary.Write(buf, binary.LittleEndian, uint32(len(id)))
+		buf.WriteString(id)
+	}
+	return &Command{Command: CommandTypeWriteIDs, Value: buf.String()}
+}
+
+// commandWriteIDs return the ids of a CommandTypeWriteIDs record, a torn id ends them
+func commandWriteIDs(c *Command) []string {
+	data := []byte(c.Value)
+	ids := make([]string, 0)
+	for len(data) >= 4 {
+		n := int(binary.LittleEndian.Uint32(data))
+		if 4+n > len(data) {
+			break
+		}
+		ids = append(ids, string(data[4:4+n]))
+		data = data[4+n:]
+	}
+	return ids
+}
+
+// wrapWriteID wrap the command with its write id for wal
+func wrapWriteID(writeID string, c *Command) *Command {
+	_, body := c.Bytes()
+	return &Command{Key: writeID, Value: string(body), Command: CommandTypeWriteID}
+}
+
+// unwrapWriteID return the wrapped command and write id, or the command itself with empty id
+func unwrapWriteID(c *Command) (*Command, string) {
+	if c.Command != CommandTypeWriteID {
+		return c, ""
+	}
+	cmd := new(Command)
+	cmd.Restore([]byte(c.Value))
+	return cmd, c.Key
+}
+
+// SetWithID set the key only once for the write id, a retry with the same id is a no-op,
+// applied reports whether this call wrote the key
+func (t *MEMSSTable) SetWithID(writeID, key, val string) (bool, error) {
+	return t.UpdateWithID(writeID, key, func(string, bool) string {
+		return val
+	})
+}
+
+// UpdateWithID set the key to fn(current value, exists) only once for the write id, the id is
+// recorded in wal with the write and the recent ids are kept by wal rotation, so replaying the same
+// id after restart is also a no-op
+func (t *MEMSSTable) UpdateWithID(writeID, key string, fn func(val string, ok bool) string) (bool, error) {
+	if err := checkRootKeys(key); err != nil {
+		return false, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	// the stall wait releases the lock, so the id is checked after it
+	if err := t.waitWriteStall(); err != nil {
+		return false, err
+	}
+	if t.writeIDs.has(writeID) {
+		return false, nil
+	}
+
+	val, ok := "", false
+	v, err := t.getLocked(key)
+	if err != nil && err != ErrKeyNotFound {
+		return false, err
+	}
+	if err == nil && v.Command != CommandTypeDelete {
+		if val, err = t.value(v); err != nil {
+			return false, err
+		}
+		ok = true
+	}
+
+	user := &Command{Key: key, Value: fn(val, ok), Command: CommandTypeSet}
+	if err := t.checkKeySize([]*Command{user}); err != nil {
+		return false, err
+	}
+	if err := t.checkValues([]*Command{user}); err != nil {
+		return false, err
+	}
+	delta, err := t.checkQuota([]*Command{user})
+	if err != nil {
+		return false, err
+	}
+	c, err := t.separateValue(user)
+	if err != nil {
+		return false, err
+	}
+	c = t.checksumValue(c)
+	if err := t.appendWAL(wrapWriteID(writeID, c)); err != nil {
+		return false, err
+	}
+	t.apply(c)
+	t.stats.addUser(user)
+	t.quota.keys += delta
+	t.writeIDs.add(writeID)
+	return true, nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func incr(val string, ok bool) string {
+	n, _ := strconv.Atoi(val)
+	return strconv.Itoa(n + 1)
+}
+
+func TestWriteIDSurvivesRotation(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir, 2, 1)
+	if applied, err := db.UpdateWithID("w1", "n", incr); err != nil || !applied {
+		t.Fatalf("first write: %v, %v", applied, err)
+	}
+	// close flushes the write and rotates the wal
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, dir, 2, 1)
+	if applied, err := db.UpdateWithID("w1", "n", incr); err != nil || applied {
+		t.Fatalf("retry after close: %v, %v", applied, err)
+	}
+	expectValue(t, db, "n", "1")
+	// the ids read from the wal are written again by the next rotation
+	for i := 0; i < 4; i++ {
+		mustSet(t, db, strconv.Itoa(i), "v")
+	}
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, db)
+
+	db = openTestDB(t, dir, 2, 1)
+	defer db.Close()
+	if applied, err := db.UpdateWithID("w1", "n", incr); err != nil || applied {
+		t.Fatalf("retry after crash: %v, %v", applied, err)
+	}
+	expectValue(t, db, "n", "1")
+}
+
+func TestWriteIDAfterWriteStall(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	db.SetMaxImmutableTables(1, true)
+	for i := 0; i < 4; i++ {
+		mustSet(t, db, strconv.Itoa(i), "v")
+	}
+	// the writers wait for the stall, only one of them may apply the id
+	var wg sync.WaitGroup
+	applied := make(chan bool, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := db.UpdateWithID("w1", "n", incr)
+			if err != nil {
+				t.Error(err)
+			}
+			applied <- ok
+		}()
+	}
+	// flush until the writers are done, a writer applying twice would stall again
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	for flushing := true; flushing; {
+		select {
+		case <-done:
+			flushing = false
+		default:
+			if _, err := db.FlushOne(); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(applied)
+	n := 0
+	for ok := range applied {
+		if ok {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Fatalf("%d writes applied, want 1", n)
+	}
+	expectValue(t, db, "n", "1")
+}
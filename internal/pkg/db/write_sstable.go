@@ -0,0 +1,64 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// KV is a key and its value given to WriteSSTable
+type KV struct {
+	Key   string
+	Value string
+}
+
+// Options configure the table written by WriteSSTable, there is no bloom filter option because the disk
+// table format written by Flush holds none, the prefix filters of a database are built in memory from the blocks
+type Options struct {
+	BlockKeyNum uint16      // each block contains N keys, default BlockKeyNum
+	Codec       CodecConfig // compression and key prefix compression of the blocks
+}
+
+// WriteSSTable write pairs sorted by key into a disk sstable file of the format written by Flush, to be
+// added by IngestFile, keys must be strictly increasing, the commands carry no sequence number and the
+// table seq is 0, the file is written through a temp file like a flushed table
+func WriteSSTable(filename string, pairs []KV, opts Options) error {
+	if len(pairs) == 0 {
+		return errors.New("WriteSSTable: no pair to write")
+	}
+	if err := opts.Codec.validate(); err != nil {
+		return err
+	}
+	blockKeyNum := int(opts.BlockKeyNum)
+	if blockKeyNum == 0 {
+		blockKeyNum = int(BlockKeyNum)
+	}
+	blocks := make([]*SSTable, 0, len(pairs)/blockKeyNum+1)
+	for i := 0; i < len(pairs); i += blockKeyNum {
+		j := i + blockKeyNum
+		if j > len(pairs) {
+			j = len(pairs)
+		}
+		block := NewSSTable()
+		block.data = make(CommandData, 0, j-i)
+		for k := i; k < j; k++ {
+			if k > 0 && pairs[k].Key <= pairs[k-1].Key {
+				return fmt.Errorf("WriteSSTable: key %q after %q is not strictly increasing", pairs[k].Key, pairs[k-1].Key)
+			}
+			block.data = append(block.data, &Command{Key: pairs[k].Key, Value: pairs[k].Value, Command: CommandTypeSet})
+		}
+		block.sorted = true
+		blocks = append(blocks, block)
+	}
+	tableBlockNum := len(blocks)
+	if tableBlockNum > math.MaxUint16 {
+		tableBlockNum = math.MaxUint16
+	}
+	metaInfo := &SSTableMetaInfo{
+		Version:       metaInfoVersion,
+		BlockKeyNum:   uint16(blockKeyNum),
+		TableBlockNum: uint16(tableBlockNum),
+	}
+	_, _, err := writeTableFile(filename, blocks, metaInfo, opts.Codec, 0)
+	return err
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestWriteSSTable(t *testing.T) {
+	pairs := make([]KV, 0, 10)
+	for i := 0; i < 10; i++ {
+		pairs = append(pairs, KV{Key: fmt.Sprintf("key%02d", i), Value: fmt.Sprintf("val%d", i)})
+	}
+	for name, codec := range map[string]CodecConfig{"plain": {}, "prefix": {PrefixKeys: true, KeyRestartInterval: 2}} {
+		t.Run(name, func(t *testing.T) {
+			filename := t.TempDir() + "/1.sdb"
+			if err := WriteSSTable(filename, pairs, Options{BlockKeyNum: 3, Codec: codec}); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metaInfo, sparseIndex, err := readSparseIndex(f)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sparseIndex) != 4 || metaInfo.FirstKey != "key00" || metaInfo.LastKey != "key09" {
+				t.Fatalf("%d blocks of [%q, %q], want 4 of [key00, key09]", len(sparseIndex), metaInfo.FirstKey, metaInfo.LastKey)
+			}
+
+			disk, err := NewDiskSSTable(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, kv := range pairs {
+				index := sparseIndex[0]
+				for _, i := range sparseIndex {
+					if i.Key <= kv.Key {
+						index = i
+					}
+				}
+				c, err := disk.Query(index.BlockIndex, index.DataStart, kv.Key)
+				if err != nil || c.Value != kv.Value {
+					t.Fatalf("disk query %s: %v, %v", kv.Key, c, err)
+				}
+			}
+
+			db := openTestDB(t, t.TempDir(), 3, 4)
+			defer db.Close()
+			f, err = os.Open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := db.LoadFromDiskTable(f); err != nil {
+				t.Fatal(err)
+			}
+			for _, kv := range pairs {
+				expectValue(t, db, kv.Key, kv.Value)
+			}
+			expectNotFound(t, db, "key10")
+		})
+	}
+}
+
+func TestWriteSSTableUnsorted(t *testing.T) {
+	filename := t.TempDir() + "/1.sdb"
+	if err := WriteSSTable(filename, []KV{{"b", "1"}, {"a", "2"}}, Options{}); err == nil {
+		t.Fatal("unsorted pairs are written")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("a table is left: %v", err)
+	}
+}
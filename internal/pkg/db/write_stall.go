@@ -0,0 +1,28 @@
+package db
+
+import "errors"
+
+var ErrWriteStall = errors.New("too many immutable tables, write stalled")
+
+// SetMaxImmutableTables limit the number of immutable tables waiting for flush, when the limit
+// is reached a write which needs a new table waits for a flush, or returns ErrWriteStall if
+// block is false, 0 means no limit
+func (t *MEMSSTable) SetMaxImmutableTables(n int, block bool) {
+	t.lock.Lock()
+	t.maxImmutable = n
+	t.stallBlock = block
+	t.lock.Unlock()
+	t.stallCond.Broadcast()
+}
+
+// waitWriteStall wait until the next write can switch table if need, caller must hold the lock
+func (t *MEMSSTable) waitWriteStall() error {
+	for t.maxImmutable > 0 && len(t.immutable) >= t.maxImmutable && t.activeTable.Len() >= int(t.blockKeyNum) {
+		if !t.stallBlock {
+			return ErrWriteStall
+		}
+		t.flusher.notify()
+		t.stallCond.Wait()
+	}
+	return nil
+}
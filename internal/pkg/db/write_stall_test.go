@@ -0,0 +1,104 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fillToStall write until one immutable table waits and the active table is full
+func fillToStall(t *testing.T, db *MEMSSTable) {
+	t.Helper()
+	for i := 0; i < 4; i++ {
+		mustSet(t, db, strconv.Itoa(i), "v")
+	}
+}
+
+func TestWriteStallError(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	db.SetMaxImmutableTables(1, false)
+	fillToStall(t, db)
+	if err := db.Set("x", "x"); !errors.Is(err, ErrWriteStall) {
+		t.Fatalf("set at the limit: %v, want ErrWriteStall", err)
+	}
+	expectNotFound(t, db, "x")
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "x", "x")
+	expectValue(t, db, "x", "x")
+}
+
+func TestWriteStallBlocks(t *testing.T) {
+	db := openTestDB(t, t.TempDir(), 2, 1)
+	defer db.Close()
+	db.SetMaxImmutableTables(1, true)
+	fillToStall(t, db)
+	done := make(chan error, 1)
+	go func() {
+		done <- db.Set("x", "x")
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("set at the limit returned %v, want it to wait", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// a flush frees a slot and the write resumes
+	if _, err := db.FlushOne(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("set still stalled after a flush")
+	}
+	expectValue(t, db, "x", "x")
+
+	// removing the limit releases a stalled write too, x and z fill the active table
+	mustSet(t, db, "z", "z")
+	go func() {
+		done <- db.Set("y", "y")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	db.SetMaxImmutableTables(0, true)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, db, "y", "y")
+}
+
+func TestWriteStallWakesBackgroundFlush(t *testing.T) {
+	for _, opts := range []BackgroundFlushOptions{{ImmutableNum: 4}, {Interval: time.Hour}} {
+		db := openTestDB(t, t.TempDir(), 2, 1)
+		// the limit is below the threshold of the flusher
+		db.SetMaxImmutableTables(1, true)
+		if err := db.StartBackgroundFlush(opts); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			for i := 0; i < 20; i++ {
+				if err := db.Set(strconv.Itoa(i), "v"); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("flush options %+v: writes still stalled", opts)
+		}
+		expectValue(t, db, "0", "v")
+		db.Close()
+	}
+}
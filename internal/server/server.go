@@ -1,22 +1,88 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
 	"github.com/hengfeiyang/lsmdb/internal/router"
 )
 
+// shutdownTimeout bound the wait for running requests, and then the final flush of the database
+const shutdownTimeout = 30 * time.Second
+
 type IServer interface {
 	Run(addr string) error
 }
 
-type server struct{}
+type server struct {
+	closeDB func() error // flush and close the database after the last request
+	timeout time.Duration
+}
 
 func New() IServer {
-	return &server{}
+	return &server{closeDB: db.DB.Close, timeout: shutdownTimeout}
 }
 
+// Run serve until SIGINT or SIGTERM, then stop accepting requests, wait for running ones and close
+// the database, so every acknowledged write is flushed to disk
 func (s *server) Run(addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return s.serve(ctx, addr)
+}
+
+// serve run the http server until ctx is done and shut it down
+func (s *server) serve(ctx context.Context, addr string) error {
 	app := gin.Default()
 	router.Route(app)
-	return app.Run(addr)
+	return s.serveHandler(ctx, addr, app)
+}
+
+// serveHandler is serve with the handler of the http server
+func (s *server) serveHandler(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{Addr: addr, Handler: handler}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		// the server failed to start or stopped by itself, the database is still closed
+		if cerr := s.closeDB(); err == nil {
+			err = cerr
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	shutdownErr := srv.Shutdown(shutdownCtx)
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) && shutdownErr == nil {
+		shutdownErr = err
+	}
+
+	// the close has its own timeout, a shutdown taking all of its time does not fail a close in time
+	done := make(chan error, 1)
+	go func() {
+		done <- s.closeDB()
+	}()
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+	case <-timer.C:
+		return errors.New("shutdown: close database timed out")
+	}
+	return shutdownErr
 }
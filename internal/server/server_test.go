@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+)
+
+// client dial a connection for each request, a spare connection dialed by a keep-alive client while
+// one is reused stays new and Shutdown waits five seconds for it
+var client = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+// freeAddr return a local address no one listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// waitServing poll addr until the server answers, the path has no route so the database is not read
+func waitServing(t *testing.T, addr string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err := client.Get(fmt.Sprintf("http://%s/", addr))
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server at %s does not answer: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// openDB open a database in dir as db.DB
+func openDB(t *testing.T, dir string) *db.MEMSSTable {
+	t.Helper()
+	store, err := db.Open(dir, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB = store
+	t.Cleanup(func() {
+		db.DB = nil
+	})
+	return store
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	store := openDB(t, dir)
+	closed := 0
+	s := &server{closeDB: func() error {
+		closed++
+		return store.Close()
+	}, timeout: 5 * time.Second}
+
+	addr := freeAddr(t)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(addr)
+	}()
+	waitServing(t, addr)
+	resp, err := client.Post(fmt.Sprintf("http://%s/api/v1/set/k", addr), "text/plain", strings.NewReader("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("set: %d", resp.StatusCode)
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("server did not stop on SIGTERM")
+	}
+	if closed != 1 {
+		t.Fatalf("database closed %d times, want once", closed)
+	}
+
+	// the acknowledged write was flushed to a disk table by Close
+	store = openDB(t, dir)
+	defer store.Close()
+	if tables, err := store.ListTables(); err != nil || len(tables) == 0 {
+		t.Fatalf("no disk table after shutdown: %v", err)
+	}
+	if v, err := store.Query("k"); err != nil || v != "v" {
+		t.Fatalf("query k after shutdown: %q, %v", v, err)
+	}
+}
+
+func TestShutdownCloseTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	release := make(chan struct{})
+	defer close(release)
+	s := &server{closeDB: func() error {
+		<-release
+		return nil
+	}, timeout: 50 * time.Millisecond}
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve(ctx, addr)
+	}()
+	waitServing(t, addr)
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("shutdown with a stuck close: %v, want a timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown waits for a stuck close")
+	}
+}
+
+func TestServeListenError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	errClose := errors.New("close failed")
+	closed := false
+	s := &server{closeDB: func() error {
+		closed = true
+		return errClose
+	}, timeout: time.Second}
+	// the address is taken, the server fails to start and the database is still closed
+	if err := s.serve(context.Background(), l.Addr().String()); err == nil || errors.Is(err, errClose) {
+		t.Fatalf("serve on a taken address: %v, want the listen error", err)
+	}
+	if !closed {
+		t.Fatal("database not closed after the server failed")
+	}
+}
+
+func TestShutdownSlowThenClose(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := openDB(t, t.TempDir())
+	// the slow request and the close together take longer than the timeout, each alone does not
+	router := gin.New()
+	router.GET("/slow", func(c *gin.Context) {
+		time.Sleep(300 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	s := &server{closeDB: func() error {
+		time.Sleep(800 * time.Millisecond)
+		return store.Close()
+	}, timeout: time.Second}
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serveHandler(ctx, addr, router)
+	}()
+	waitServing(t, addr)
+	slow := make(chan error, 1)
+	go func() {
+		resp, err := client.Get(fmt.Sprintf("http://%s/slow", addr))
+		if err == nil {
+			resp.Body.Close()
+		}
+		slow <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("shutdown with a slow request and a close in time: %v", err)
+	}
+	if err := <-slow; err != nil {
+		t.Fatalf("slow request: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+)
+
+func BatchDelete(c *gin.Context) {
+	var keys []string
+	if err := c.ShouldBindJSON(&keys); err != nil {
+		writeBadRequest(c, err)
+		return
+	}
+	// count is the number of keys which were live before the delete
+	n, err := db.DB.DeleteKeys(keys)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": 0, "message": "ok", "count": n})
+}
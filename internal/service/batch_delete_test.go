@@ -0,0 +1,38 @@
+package service_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+	"github.com/hengfeiyang/lsmdb/internal/service"
+)
+
+func TestBatchDelete(t *testing.T) {
+	app := newTestApp(t)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.DB.Set(key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status, body := do(t, app, newRequest(http.MethodPost, "/api/v1/batch-delete", `["a", "b", "missing", "a"]`))
+	// only the live keys are counted
+	if status != http.StatusOK || body["status"] != float64(0) || body["count"] != float64(2) {
+		t.Fatalf("batch delete: %d %v", status, body)
+	}
+	for _, key := range []string{"a", "b", "missing"} {
+		if _, err := db.DB.Query(key); err != db.ErrKeyNotFound {
+			t.Fatalf("query %s after batch delete: %v", key, err)
+		}
+	}
+	if val, err := db.DB.Query("c"); err != nil || val != "c" {
+		t.Fatalf("query c: %q, %v", val, err)
+	}
+
+	status, body = do(t, app, newRequest(http.MethodPost, "/api/v1/batch-delete", `{"keys": "a"}`))
+	expectError(t, status, body, http.StatusBadRequest, service.CodeBadRequest)
+	status, body = do(t, app, newRequest(http.MethodPost, "/api/v1/batch-delete", `[]`))
+	if status != http.StatusOK || body["count"] != float64(0) {
+		t.Fatalf("empty batch delete: %d %v", status, body)
+	}
+}
@@ -20,11 +20,14 @@ func Bulk(c *gin.Context) {
 			if err == io.EOF {
 				break
 			}
-			c.JSON(http.StatusOK, gin.H{"status": 1, "message": err.Error()})
+			writeBadRequest(c, err)
 			return
 		}
 		key := uuid.New().String()
-		db.DB.Set(key, string(val))
+		if err := db.DB.Set(key, string(val)); err != nil {
+			writeError(c, err)
+			return
+		}
 	}
 	c.JSON(http.StatusOK, gin.H{"status": 0, "message": "ok", "count": n})
 }
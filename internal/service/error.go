@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+)
+
+// error codes in the "code" field of a failed response
+const (
+	CodeBadRequest    = "bad_request"
+	CodeNotFound      = "not_found"
+	CodeQuotaExceeded = "quota_exceeded"
+	CodeKeyTooLarge   = "key_too_large"
+	CodeInvalidValue  = "invalid_value"
+	CodeInternal      = "internal"
+)
+
+// errorCode map a db error to the code and http status of the response
+func errorCode(err error) (string, int) {
+	switch {
+	case errors.Is(err, db.ErrKeyNotFound):
+		return CodeNotFound, http.StatusNotFound
+	case errors.Is(err, db.ErrQuotaExceeded):
+		return CodeQuotaExceeded, http.StatusInsufficientStorage
+	case errors.Is(err, db.ErrKeyTooLarge):
+		return CodeKeyTooLarge, http.StatusRequestEntityTooLarge
+	case errors.Is(err, db.ErrInvalidValue):
+		return CodeInvalidValue, http.StatusBadRequest
+	case errors.Is(err, db.ErrReservedKey):
+		return CodeBadRequest, http.StatusBadRequest
+	default:
+		return CodeInternal, http.StatusInternalServerError
+	}
+}
+
+// writeError write a failed response of a db error, every failed response has the same shape
+func writeError(c *gin.Context, err error) {
+	code, status := errorCode(err)
+	c.JSON(status, gin.H{"status": 1, "code": code, "message": err.Error()})
+}
+
+// writeBadRequest write a failed response of an invalid request
+func writeBadRequest(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{"status": 1, "code": CodeBadRequest, "message": err.Error()})
+}
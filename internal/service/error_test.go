@@ -0,0 +1,62 @@
+package service_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+	"github.com/hengfeiyang/lsmdb/internal/service"
+)
+
+func TestErrorCodes(t *testing.T) {
+	dir := t.TempDir()
+	app := newTestAppAt(t, dir)
+	if err := db.DB.SetMaxKeySize(8); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.SetValueEncoding(db.ValueEncodingJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := do(t, app, newRequest(http.MethodGet, "/api/v1/get/missing", ""))
+	expectError(t, status, body, http.StatusNotFound, service.CodeNotFound)
+	status, body = do(t, app, newRequest(http.MethodPost, "/api/v1/batch-delete", "not json"))
+	expectError(t, status, body, http.StatusBadRequest, service.CodeBadRequest)
+	status, body = do(t, app, newRequest(http.MethodPost, "/api/v1/set/"+strings.Repeat("k", 9), `"v"`))
+	expectError(t, status, body, http.StatusRequestEntityTooLarge, service.CodeKeyTooLarge)
+	status, body = do(t, app, newRequest(http.MethodPost, "/api/v1/set/k", "{not json"))
+	expectError(t, status, body, http.StatusBadRequest, service.CodeInvalidValue)
+
+	if err := db.DB.SetQuota(db.Quota{MaxKeys: 1}); err != nil {
+		t.Fatal(err)
+	}
+	status, body = do(t, app, newRequest(http.MethodPost, "/api/v1/set/a", `"a"`))
+	if status != http.StatusOK {
+		t.Fatalf("set under the quota: %d %v", status, body)
+	}
+	status, body = do(t, app, newRequest(http.MethodPost, "/api/v1/set/b", `"b"`))
+	expectError(t, status, body, http.StatusInsufficientStorage, service.CodeQuotaExceeded)
+
+	// a table which can not be read is an internal error
+	status, body = do(t, app, newRequest(http.MethodGet, "/api/v1/flush", ""))
+	if status != http.StatusOK {
+		t.Fatalf("flush: %d %v", status, body)
+	}
+	names, err := filepath.Glob(dir + "/*.sdb")
+	if err != nil || len(names) == 0 {
+		t.Fatalf("tables %v, %v", names, err)
+	}
+	for _, name := range names {
+		if err := os.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status, body = do(t, app, newRequest(http.MethodGet, "/api/v1/get/a", ""))
+	expectError(t, status, body, http.StatusInternalServerError, service.CodeInternal)
+	if msg, _ := body["message"].(string); msg == "" {
+		t.Fatalf("internal error without a message: %v", body)
+	}
+}
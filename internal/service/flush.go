@@ -9,7 +9,7 @@ import (
 
 func Flush(c *gin.Context) {
 	if err := db.DB.Flush(); err != nil {
-		c.JSON(http.StatusOK, gin.H{"status": 1, "message": err.Error()})
+		writeError(c, err)
 	} else {
 		c.JSON(http.StatusOK, gin.H{"status": 0, "message": "flush ok"})
 	}
@@ -1,17 +1,47 @@
 package service
 
 import (
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
 )
 
+// Get return the value of a key, the response carries an ETag of the value and a request whose
+// If-None-Match matches it gets 304 Not Modified without a body
 func Get(c *gin.Context) {
 	val, err := db.DB.Query(c.Param("key"))
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"status": 1, "message": err.Error()})
+		writeError(c, err)
+		return
+	}
+	etag := valueETag(val)
+	c.Header("ETag", etag)
+	if etagMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": 0, "value": val})
 }
+
+// valueETag is a strong entity tag of a value, the hash changes whenever the value does
+func valueETag(val string) string {
+	h := fnv.New64a()
+	h.Write([]byte(val))
+	return fmt.Sprintf("%q", fmt.Sprintf("%016x", h.Sum64()))
+}
+
+// etagMatch report whether an If-None-Match header matches the etag, the header is "*" or a list of
+// tags and the weak comparison of RFC 7232 is used, so a W/ prefix is ignored
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
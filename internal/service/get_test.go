@@ -0,0 +1,53 @@
+package service_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// get serve a GET of key with the If-None-Match header if set
+func get(app *gin.Engine, key, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := newRequest(http.MethodGet, "/api/v1/get/"+key, "")
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetETag(t *testing.T) {
+	app := newTestApp(t)
+	do(t, app, newRequest(http.MethodPost, "/api/v1/set/k", "v1"))
+	w := get(app, "k", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || etag[0] != '"' {
+		t.Fatalf("first get: %d with ETag %q", w.Code, etag)
+	}
+
+	// a matching tag, also weak or in a list, is not modified and has no body
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w = get(app, "k", header)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+			t.Fatalf("get if none match %s: %d with %d bytes, ETag %q", header, w.Code, w.Body.Len(), w.Header().Get("ETag"))
+		}
+	}
+	if w = get(app, "k", `"other"`); w.Code != http.StatusOK {
+		t.Fatalf("get with another tag: %d", w.Code)
+	}
+
+	// a new value has a new tag, the old one does not match
+	do(t, app, newRequest(http.MethodPost, "/api/v1/set/k", "v2"))
+	w = get(app, "k", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("get of a changed value with the old tag: %d with ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	// a missing key is not found even with a wildcard
+	if w = get(app, "missing", "*"); w.Code != http.StatusNotFound {
+		t.Fatalf("get of a missing key: %d", w.Code)
+	}
+}
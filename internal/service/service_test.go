@@ -0,0 +1,84 @@
+package service_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hengfeiyang/lsmdb/internal/pkg/db"
+	"github.com/hengfeiyang/lsmdb/internal/router"
+	"github.com/hengfeiyang/lsmdb/internal/service"
+)
+
+// newTestApp open a database in a temporary directory as db.DB and return the routed handlers
+func newTestApp(t *testing.T) *gin.Engine {
+	t.Helper()
+	return newTestAppAt(t, t.TempDir())
+}
+
+// newTestAppAt open the database in dir as db.DB and return the routed handlers
+func newTestAppAt(t *testing.T, dir string) *gin.Engine {
+	t.Helper()
+	store, err := db.Open(dir, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB = store
+	t.Cleanup(func() {
+		db.DB = nil
+		store.Close()
+	})
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	router.Route(app)
+	return app
+}
+
+// do serve the request and return the status and the decoded json body, nil if the body is empty
+func do(t *testing.T, app *gin.Engine, req *http.Request) (int, map[string]interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	if w.Body.Len() == 0 {
+		return w.Code, nil
+	}
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: decode %q: %v", req.Method, req.URL, w.Body.String(), err)
+	}
+	return w.Code, body
+}
+
+func newRequest(method, path, body string) *http.Request {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	return httptest.NewRequest(method, path, r)
+}
+
+// expectError check a failed response has the status and the code
+func expectError(t *testing.T, status int, body map[string]interface{}, wantStatus int, wantCode string) {
+	t.Helper()
+	if status != wantStatus || body["status"] != float64(1) || body["code"] != wantCode {
+		t.Fatalf("got %d %v, want %d with code %s", status, body, wantStatus, wantCode)
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	app := newTestApp(t)
+	status, body := do(t, app, newRequest(http.MethodPost, "/api/v1/set/k", "v"))
+	if status != http.StatusOK || body["status"] != float64(0) {
+		t.Fatalf("set: %d %v", status, body)
+	}
+	status, body = do(t, app, newRequest(http.MethodGet, "/api/v1/get/k", ""))
+	if status != http.StatusOK || body["value"] != "v" {
+		t.Fatalf("get: %d %v", status, body)
+	}
+	status, body = do(t, app, newRequest(http.MethodGet, "/api/v1/get/missing", ""))
+	expectError(t, status, body, http.StatusNotFound, service.CodeNotFound)
+}
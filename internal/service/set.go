@@ -12,12 +12,15 @@ func Set(c *gin.Context) {
 	key := c.Param("key")
 	val, err := c.GetRawData()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": 1, "message": err.Error()})
+		writeBadRequest(c, err)
 		return
 	}
 	if key == "" {
 		key = uuid.New().String()
 	}
-	db.DB.Set(key, string(val))
+	if err := db.DB.Set(key, string(val)); err != nil {
+		writeError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"status": 0, "message": "ok"})
 }